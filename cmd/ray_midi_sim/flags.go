@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"ray_midi_sim/internal/midi"
+	"ray_midi_sim/internal/sim"
+	"ray_midi_sim/internal/source"
+)
+
+// mapFlags are the flags shared by every command that generates a map
+type mapFlags struct {
+	fs *flag.FlagSet
+
+	midPath          *string
+	tracks           *string
+	selection        *string
+	squares          *string
+	timestamps       *string
+	timestampsFormat *string
+	csvColumn        *int
+	configPath       *string
+	timeout          *time.Duration
+	quiet            *bool
+
+	cfg *sim.Config
+}
+
+func registerMapFlags(fs *flag.FlagSet) mapFlags {
+	cfg := sim.DefaultConfig()
+	cfg.RegisterFlags(fs)
+
+	return mapFlags{
+		fs: fs,
+
+		midPath:          fs.String("mid", "", "path to the MIDI file (required unless the onsets come from -timestamps or a WAV file)"),
+		tracks:           fs.String("tracks", "", "comma separated MIDI track indexes used for the map (default all tracks)"),
+		selection:        fs.String("select", "", "pick the MIDI notes used for the map, like \"name=drums;drum=kick,snare;velocity=40\", keys are track, name, channel (1-16), program (1-128 or a GM instrument name), pitch, velocity and drum (default all notes)"),
+		squares:          fs.String("squares", "", "one square per selector separated by |, like \"name=drums|name=bass|name=lead\", each square bounces on the notes of the MIDI file its selector picks (default a single square for the notes of -tracks and -select)"),
+		timestamps:       fs.String("timestamps", "", "generate the map from the onsets in this file instead of the MIDI file, a MIDI, WAV, CSV, text or osu! file"),
+		timestampsFormat: fs.String("timestamps-format", "", "format of -timestamps, one of "+strings.Join(source.Formats, ", ")+" (default by the file extension)"),
+		csvColumn:        fs.Int("csv-column", 0, "zero based column of a CSV -timestamps file holding the seconds"),
+		configPath:       fs.String("config", "", "path to a JSON, TOML (.toml) or YAML (.yaml, .yml) config file, flags given on the command line take precedence"),
+		timeout:          fs.Duration("timeout", 0, "give up generating the map after this long (default no timeout)"),
+		quiet:            fs.Bool("q", false, "do not report the map generation progress"),
+
+		cfg: &cfg,
+	}
+}
+
+// config loads the config file, if any, and then reapplies the flags that were set explicitly
+func (f mapFlags) config() (sim.Config, error) {
+	if *f.configPath != "" {
+		overrides := make(map[string]string)
+		f.fs.Visit(func(fl *flag.Flag) {
+			overrides[fl.Name] = fl.Value.String()
+		})
+
+		if err := f.cfg.LoadFile(*f.configPath); err != nil {
+			return sim.Config{}, err
+		}
+
+		for name, value := range overrides {
+			if err := f.fs.Set(name, value); err != nil {
+				return sim.Config{}, err
+			}
+		}
+	}
+
+	if err := f.cfg.Validate(); err != nil {
+		return sim.Config{}, fmt.Errorf("%w: %w", errUsage, err)
+	}
+
+	return *f.cfg, nil
+}
+
+// selector combines -tracks and -select into the notes of the MIDI file the map is generated from
+func (f mapFlags) selector() (midi.Selector, error) {
+	trackIndexes, err := parseTrackIndexes(*f.tracks)
+	if err != nil {
+		return midi.Selector{}, err
+	}
+
+	selector, err := midi.ParseSelector(*f.selection)
+	if err != nil {
+		return midi.Selector{}, fmt.Errorf("%w: -select: %w", errUsage, err)
+	}
+	selector.Tracks = append(selector.Tracks, trackIndexes...)
+
+	return selector, nil
+}
+
+// source returns where the onsets of the map come from: the -timestamps file, the MIDI file,
+// or without a MIDI file the onsets detected in the WAV file
+func (f mapFlags) source(cfg sim.Config, wavPath string) (source.TimestampSource, error) {
+	selector, err := f.selector()
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline, err := cfg.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := source.Options{
+		Selector:          selector,
+		Pipeline:          pipeline,
+		OnsetToleranceSec: cfg.OnsetTolerance(),
+		Onset:             cfg.OnsetParams(),
+		CSVColumn:         *f.csvColumn,
+	}
+
+	switch {
+	case *f.timestamps != "":
+		src, err := source.Open(*f.timestamps, *f.timestampsFormat, opts)
+		if errors.Is(err, source.ErrUnknownFormat) || errors.Is(err, source.ErrInvalidColumn) {
+			return nil, fmt.Errorf("%w: %w", errUsage, err)
+		}
+		return src, err
+
+	case *f.midPath == "" && wavPath != "":
+		return source.NewWAVOnsets(wavPath, opts.Onset), nil
+
+	default:
+		if err := requireFlag(*f.midPath, "mid"); err != nil {
+			return nil, err
+		}
+
+		src := source.NewMIDI(*f.midPath, opts.Selector, opts.OnsetToleranceSec)
+		src.SetPipeline(opts.Pipeline)
+		return src, nil
+	}
+}
+
+// sources returns the source of every square, a MIDI source for each selector of -squares or else the single source
+// of source
+func (f mapFlags) sources(cfg sim.Config, wavPath string) ([]source.TimestampSource, error) {
+	if *f.squares == "" {
+		src, err := f.source(cfg, wavPath)
+		if err != nil {
+			return nil, err
+		}
+		return []source.TimestampSource{src}, nil
+	}
+
+	if *f.tracks != "" || *f.selection != "" || *f.timestamps != "" {
+		return nil, fmt.Errorf("%w: -squares can not be used with -tracks, -select or -timestamps", errUsage)
+	}
+	if err := requireFlag(*f.midPath, "mid"); err != nil {
+		return nil, err
+	}
+
+	pipeline, err := cfg.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	var srcs []source.TimestampSource
+	for i, selection := range strings.Split(*f.squares, "|") {
+		selector, err := midi.ParseSelector(selection)
+		if err != nil {
+			return nil, fmt.Errorf("%w: -squares: square %d: %w", errUsage, i+1, err)
+		}
+
+		src := source.NewMIDI(*f.midPath, selector, cfg.OnsetTolerance())
+		src.SetPipeline(pipeline)
+		srcs = append(srcs, src)
+	}
+
+	return srcs, nil
+}
+
+// context returns a context that is cancelled on an interrupt or once the timeout passes
+func (f mapFlags) context() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if *f.timeout <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *f.timeout)
+
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// progressFunc returns the progress reporter and a function that ends its line once generating stops
+func (f mapFlags) progressFunc() (sim.ProgressFunc, func()) {
+	if *f.quiet {
+		return nil, func() {}
+	}
+
+	printed := false
+
+	report := func(p sim.Progress) {
+		fmt.Fprintf(os.Stderr, "\rgenerating: note %d/%d, deepest %d, %d backtracks ", p.NoteIdx, p.NoteCount, p.DeepestIdx, p.Backtracks)
+		printed = true
+	}
+
+	done := func() {
+		if printed {
+			fmt.Fprintln(os.Stderr)
+			printed = false
+		}
+	}
+
+	return report, done
+}
+
+// printThinned lists the onsets of every square dropped as too close together for it, with the notes behind them
+func printThinned(w io.Writer, squareThinned [][]midi.ThinnedOnset) {
+	for i, thinned := range squareThinned {
+		if len(thinned) == 0 {
+			continue
+		}
+
+		square := "the square"
+		if len(squareThinned) > 1 {
+			square = fmt.Sprintf("square %d", i+1)
+		}
+
+		fmt.Fprintf(w, "thinned:  %d onsets too close together for %s\n", len(thinned), square)
+		printThinnedOnsets(w, thinned)
+	}
+}
+
+func printThinnedOnsets(w io.Writer, thinned []midi.ThinnedOnset) {
+	for _, onset := range thinned {
+		var notes []string
+		for _, note := range onset.Notes {
+			notes = append(notes, fmt.Sprintf("%d:%d", note.Track, note.Pitch))
+		}
+
+		fmt.Fprintf(w, "  %.3fs", onset.Time)
+		if len(notes) > 0 {
+			fmt.Fprintf(w, " (track:pitch %s)", strings.Join(notes, " "))
+		}
+		fmt.Fprintf(w, ": %s\n", onset.Reason)
+	}
+}
+
+// simulationFlags are the flags of the commands that run a Simulation, on top of the map flags
+type simulationFlags struct {
+	mapFlags
+
+	mapPath  *string
+	cacheDir *string
+	noCache  *bool
+	excerpt  excerptFlags
+}
+
+func registerSimulationFlags(fs *flag.FlagSet) simulationFlags {
+	return simulationFlags{
+		mapFlags: registerMapFlags(fs),
+
+		mapPath:  fs.String("map", "", "use a map saved by generate -o instead of generating one, -mid is optional then"),
+		cacheDir: fs.String("cache-dir", "", "directory of the map cache (default in the user cache directory)"),
+		noCache:  fs.Bool("no-cache", false, "always generate the map, without reading or writing the map cache"),
+		excerpt:  registerExcerptFlags(fs, "only use the excerpt of the song starting at these seconds, the map is generated for the excerpt alone"),
+	}
+}
+
+// simulation creates the Simulation described by the flags, it still has to be initialised
+func (f simulationFlags) simulation(cfg sim.Config, wavPath string, onProgress sim.ProgressFunc) (sim.Simulation, error) {
+	s := sim.New(cfg, *f.midPath, wavPath)
+	s.SetProgressFunc(onProgress)
+	s.SetMapPath(*f.mapPath)
+
+	startSec, endSec, ok, err := f.excerpt.bounds()
+	if err != nil {
+		return sim.Simulation{}, err
+	}
+	if ok {
+		if *f.mapPath != "" {
+			return sim.Simulation{}, fmt.Errorf("%w: -start and -duration can not be used with -map", errUsage)
+		}
+		s.SetExcerpt(startSec, endSec)
+	}
+
+	// a saved map only needs the MIDI file to check it was made from it
+	if *f.mapPath == "" {
+		srcs, err := f.sources(cfg, wavPath)
+		if err != nil {
+			return sim.Simulation{}, err
+		}
+		s.SetTimestampSources(srcs...)
+	}
+
+	if !*f.noCache {
+		cacheDir := *f.cacheDir
+		if cacheDir == "" {
+			var err error
+			cacheDir, err = sim.DefaultMapCacheDir()
+			if err != nil {
+				return sim.Simulation{}, err
+			}
+		}
+
+		mapCache := sim.NewMapCache(cacheDir)
+		s.SetMapCache(&mapCache)
+	}
+
+	return s, nil
+}
+
+// excerptFlags pick a part of the song
+type excerptFlags struct {
+	start    *float64
+	duration *float64
+}
+
+func registerExcerptFlags(fs *flag.FlagSet, startUsage string) excerptFlags {
+	return excerptFlags{
+		start:    fs.Float64("start", 0, startUsage),
+		duration: fs.Float64("duration", 0, "seconds of the excerpt, like 30 for a clip (default the rest of the song)"),
+	}
+}
+
+// bounds returns the start and end of the excerpt in seconds, the end is +Inf without -duration. ok is false if
+// neither flag was given.
+func (f excerptFlags) bounds() (startSec, endSec float64, ok bool, err error) {
+	if *f.start < 0 || *f.duration < 0 {
+		return 0, 0, false, fmt.Errorf("%w: -start and -duration can not be negative", errUsage)
+	}
+	if *f.start == 0 && *f.duration == 0 {
+		return 0, 0, false, nil
+	}
+
+	endSec = math.Inf(1)
+	if *f.duration > 0 {
+		endSec = *f.start + *f.duration
+	}
+
+	return *f.start, endSec, true, nil
+}
+
+// synthFlags are the flags of the commands that turn MIDI into audio
+type synthFlags struct {
+	engine        *string
+	soundFontPath *string
+	sampleRate    *int
+	fluidSynth    *string
+}
+
+func registerSynthFlags(fs *flag.FlagSet, soundFontUsage string) synthFlags {
+	return synthFlags{
+		engine:        fs.String("synth", "fluidsynth", "synthesizer used for the audio, fluidsynth or builtin (pure Go, no filters or effects)"),
+		soundFontPath: fs.String("sf2", "", soundFontUsage),
+		sampleRate:    fs.Int("sample-rate", midi.DefaultSampleRate, "sample rate of the synthesized audio in Hz"),
+		fluidSynth:    fs.String("fluidsynth", "fluidsynth", "name or path of the fluidsynth executable"),
+	}
+}
+
+func (f synthFlags) synthesizer() (midi.Synthesizer, error) {
+	switch *f.engine {
+	case "fluidsynth":
+		synth := midi.NewFluidSynth(*f.soundFontPath)
+		synth.SetExecutable(*f.fluidSynth)
+		synth.SetSampleRate(*f.sampleRate)
+
+		return synth, nil
+
+	case "builtin":
+		soundFont, err := midi.LoadSoundFont(*f.soundFontPath)
+		if err != nil {
+			return nil, err
+		}
+
+		synth := midi.NewSoundFontSynth(soundFont)
+		synth.SetSampleRate(*f.sampleRate)
+
+		return synth, nil
+
+	default:
+		return nil, fmt.Errorf("%w: unknown -synth %q, expected fluidsynth or builtin", errUsage, *f.engine)
+	}
+}
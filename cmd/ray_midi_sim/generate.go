@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ray_midi_sim/internal/midi"
+	"ray_midi_sim/internal/sim"
+	"ray_midi_sim/internal/source"
+)
+
+func generateCommand(fs *flag.FlagSet) func() error {
+	mf := registerMapFlags(fs)
+	outPath := fs.String("o", "", "save the map to this path, as JSON if it ends in .json and in the binary format otherwise")
+	wavPath := fs.String("wav", "", "generate the map from the onsets detected in this WAV file instead of -mid")
+	excerpt := registerExcerptFlags(fs, "only use the onsets of the excerpt of the song starting at these seconds")
+
+	return func() error {
+		cfg, err := mf.config()
+		if err != nil {
+			return err
+		}
+
+		srcs, err := mf.sources(cfg, *wavPath)
+		if err != nil {
+			return err
+		}
+
+		startSec, endSec, ok, err := excerpt.bounds()
+		if err != nil {
+			return err
+		}
+
+		var (
+			squareTimestamps [][]float64
+			squareThinned    [][]midi.ThinnedOnset
+			sourceHashes     []string
+		)
+		for _, src := range srcs {
+			// the whole song is thinned so an excerpt keeps the onsets it has in the song
+			thinned, err := cfg.ThinSource(src)
+			if err != nil {
+				return err
+			}
+			src = thinned
+
+			if ok {
+				src = source.Slice(src, startSec, endSec)
+			}
+
+			timestamps, err := src.Timestamps()
+			if err != nil {
+				return err
+			}
+			squareTimestamps = append(squareTimestamps, timestamps)
+			squareThinned = append(squareThinned, thinned.Removed())
+
+			sourceHash, err := src.Hash()
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(sourceHashes, sourceHash) {
+				sourceHashes = append(sourceHashes, sourceHash)
+			}
+		}
+
+		ctx, cancel := mf.context()
+		defer cancel()
+
+		onProgress, progressDone := mf.progressFunc()
+
+		start := time.Now()
+
+		generatedMap, err := sim.GenerateMap(ctx, squareTimestamps, cfg, onProgress)
+		progressDone()
+		if err != nil {
+			return err
+		}
+		generatedMap.SetSourceHash(strings.Join(sourceHashes, ","))
+
+		floating := 0
+		for _, bounce := range generatedMap.Bounces() {
+			if bounce.IsFloating() {
+				floating++
+			}
+		}
+
+		fmt.Printf("seed:     %d\n", generatedMap.Seed())
+		notes := make([]string, len(squareTimestamps))
+		for i, timestamps := range squareTimestamps {
+			notes[i] = strconv.Itoa(len(timestamps))
+		}
+
+		fmt.Printf("notes:    %s\n", strings.Join(notes, " + "))
+		fmt.Printf("bounces:  %d (%d floating)\n", len(generatedMap.Bounces()), floating)
+		fmt.Printf("took:     %v\n", time.Since(start).Round(time.Millisecond))
+		printThinned(os.Stdout, squareThinned)
+
+		if *outPath != "" {
+			if err := sim.SaveMap(generatedMap, *outPath); err != nil {
+				return err
+			}
+			fmt.Printf("saved:    %s\n", *outPath)
+		}
+
+		return nil
+	}
+}
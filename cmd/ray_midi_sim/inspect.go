@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gitlab.com/gomidi/midi/v2/gm"
+
+	"ray_midi_sim/internal/midi"
+)
+
+func inspectCommand(fs *flag.FlagSet) func() error {
+	midPath := fs.String("mid", "", "path to the MIDI file (required)")
+	selectorFlag := fs.String("select", "", "also count the notes picked by a selector, see the -select flag of generate")
+
+	return func() error {
+		if err := requireFlag(*midPath, "mid"); err != nil {
+			return err
+		}
+
+		selector, err := midi.ParseSelector(*selectorFlag)
+		if err != nil {
+			return fmt.Errorf("%w: -select: %w", errUsage, err)
+		}
+
+		m, err := midi.New(*midPath)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("file:     %s\n", *midPath)
+		fmt.Printf("duration: %.3fs\n", m.Duration())
+		fmt.Printf("tracks:   %d\n\n", m.TrackCount())
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "track\tname\tnotes\tonsets\tfirst\tlast\tchannels\tprograms")
+
+		for trackIndex := range m.TrackCount() {
+			name := m.TrackName(trackIndex)
+			if name == "" {
+				name = "-"
+			}
+
+			notes := m.ExtractNotes(midi.TrackSelector(trackIndex))
+			if len(notes) == 0 {
+				fmt.Fprintf(w, "%d\t%s\t0\t0\t-\t-\t-\t-\n", trackIndex, name)
+				continue
+			}
+
+			noteOnTimestamps := m.ExtractNoteOnTimestamps(midi.TrackSelector(trackIndex))
+			channels, programs := channelsAndPrograms(notes)
+
+			fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%.3fs\t%.3fs\t%s\t%s\n", trackIndex, name, len(notes), len(noteOnTimestamps),
+				noteOnTimestamps[0], noteOnTimestamps[len(noteOnTimestamps)-1], channels, programs)
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if *selectorFlag != "" {
+			fmt.Printf("\nselected: %d notes, %d onsets in tracks %v\n", len(m.ExtractNotes(selector)), len(m.ExtractNoteOnTimestamps(selector)), m.SelectTracks(selector))
+		}
+
+		return nil
+	}
+}
+
+// channelsAndPrograms lists the channels, counted from 1, and the GM programs the notes are played with
+func channelsAndPrograms(notes []midi.Note) (string, string) {
+	var channels, programs []string
+
+	for _, note := range notes {
+		channel := strconv.Itoa(int(note.Channel) + 1)
+		if !slices.Contains(channels, channel) {
+			channels = append(channels, channel)
+		}
+
+		program := "drums"
+		if note.Channel != midi.DrumChannel {
+			program = fmt.Sprintf("%d %s", note.Program+1, gm.Instr(note.Program))
+		}
+		if !slices.Contains(programs, program) {
+			programs = append(programs, program)
+		}
+	}
+
+	return strings.Join(channels, ","), strings.Join(programs, ", ")
+}
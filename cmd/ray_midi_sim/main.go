@@ -1,6 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
 	"ray_midi_sim/internal/sim"
 )
 
@@ -8,21 +16,125 @@ import (
 // - warped grid effect
 // - grid colors that move and change on bounce
 // - start animation mini grid turns into square
-// - multiple squares in the same map, generate multi square map (with max distance between squares)
 // - multiple maps at the same time
 // - connect bounce rects with outer grid based on distance (possible collisions could be checked using path polygons)
 // - particles
 
+// exit codes
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitNoPathFound = 3
+	exitCanceled    = 4
+)
+
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	name        string
+	description string
+
+	// setup registers the command flags and returns the action to run once they are parsed
+	setup func(fs *flag.FlagSet) func() error
+}
+
+var commands = []command{
+	{name: "play", description: "generate a map and play it in a window along with the WAV", setup: playCommand},
+	{name: "generate", description: "generate a map without opening a window", setup: generateCommand},
+	{name: "inspect", description: "print the tracks and notes of a MIDI file", setup: inspectCommand},
+	{name: "render", description: "render the map to a video at a fixed frame rate, without showing a window or playing audio", setup: renderCommand},
+	{name: "synth", description: "render a MIDI file to WAV using a SoundFont", setup: synthCommand},
+	{name: "slice", description: "cut the same excerpt out of a MIDI file and its WAV", setup: sliceCommand},
+}
+
 func main() {
-	midPath := `C:\Users\ingma\Desktop\RhythmVisualizer\18.03.25\__Maretu2.mid` // `C:\Users\ingma\Desktop\mids\Transcribed_ Calix Huang - Carry You Home.mid`
-	wavFilePath := `C:\Users\ingma\Desktop\RhythmVisualizer\18.03.25\__Maretu2.wav`
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) < 1 {
+		printUsage()
+		return exitUsage
+	}
 
-	sim := sim.New(midPath, wavFilePath)
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
 
-	err := sim.Init()
-	if err != nil {
-		panic(err)
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		action := cmd.setup(fs)
+
+		// the flag package already reports parse errors itself
+		if err := fs.Parse(args[1:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			return exitUsage
+		}
+
+		if err := action(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+			return exitCode(err)
+		}
+
+		return exitOK
 	}
 
-	sim.Run()
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+	printUsage()
+
+	return exitUsage
+}
+
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errUsage), errors.Is(err, sim.ErrInvalidSquares):
+		return exitUsage
+	case errors.Is(err, sim.ErrNoPathFound):
+		return exitNoPathFound
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return exitCanceled
+	default:
+		return exitFailure
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: ray_midi_sim <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `run "ray_midi_sim <command> -h" for the flags of a command`)
+}
+
+// parseTrackIndexes parses a comma separated list of track indexes, an empty string selects all tracks
+func parseTrackIndexes(s string) ([]int, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var trackIndexes []int
+	for _, field := range strings.Split(s, ",") {
+		index, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("%w: invalid track index %q", errUsage, field)
+		}
+		trackIndexes = append(trackIndexes, index)
+	}
+
+	return trackIndexes, nil
+}
+
+func requireFlag(value, name string) error {
+	if value == "" {
+		return fmt.Errorf("%w: -%s is required", errUsage, name)
+	}
+	return nil
 }
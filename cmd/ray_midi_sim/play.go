@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func playCommand(fs *flag.FlagSet) func() error {
+	sf := registerSimulationFlags(fs)
+	wavPath := fs.String("wav", "", "path to the WAV file played along with the map, synthesized from -mid with -sf2 if not given. Without -mid the map is generated from its onsets")
+	synf := registerSynthFlags(fs, "path to the SoundFont used to synthesize the audio when -wav is not given")
+
+	return func() error {
+		if *wavPath == "" {
+			if *synf.soundFontPath == "" {
+				return fmt.Errorf("%w: -wav or -sf2 is required", errUsage)
+			}
+			// the audio is synthesized from the MIDI file, even when playing a saved map
+			if err := requireFlag(*sf.midPath, "mid"); err != nil {
+				return err
+			}
+		}
+		cfg, err := sf.config()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := sf.context()
+		defer cancel()
+
+		onProgress, progressDone := sf.progressFunc()
+
+		s, err := sf.simulation(cfg, *wavPath, onProgress)
+		if err != nil {
+			return err
+		}
+		if *wavPath == "" {
+			synth, err := synf.synthesizer()
+			if err != nil {
+				return err
+			}
+			s.SetSynthesizer(synth)
+		}
+
+		err = s.Init(ctx)
+		progressDone()
+		if err != nil {
+			return err
+		}
+		if !*sf.quiet {
+			printThinned(os.Stderr, s.ThinnedOnsets())
+		}
+
+		s.Run()
+
+		return nil
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"ray_midi_sim/internal/sim"
+	"ray_midi_sim/internal/video"
+)
+
+func renderCommand(fs *flag.FlagSet) func() error {
+	sf := registerSimulationFlags(fs)
+	outPath := fs.String("o", "", "video file encoded by ffmpeg, the frames are piped to it at -fps frames per second")
+	pngDir := fs.String("png-dir", "", "write the frames as a numbered PNG sequence into this directory instead")
+	ffmpegPath := fs.String("ffmpeg", "ffmpeg", "ffmpeg executable used for -o")
+	software := fs.Bool("software", false, "draw the frames in software, for machines without a GPU")
+
+	return func() error {
+		if (*outPath == "") == (*pngDir == "") {
+			return fmt.Errorf("%w: exactly one of -o and -png-dir is required", errUsage)
+		}
+		cfg, err := sf.config()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := sf.context()
+		defer cancel()
+
+		onProgress, progressDone := sf.progressFunc()
+
+		s, err := sf.simulation(cfg, "", onProgress)
+		if err != nil {
+			return err
+		}
+
+		var w video.FrameWriter
+		if *pngDir != "" {
+			w, err = video.NewPNGSequence(*pngDir)
+		} else {
+			w, err = video.NewPipe(*ffmpegPath, video.FFmpegArgs(cfg.WindowWidth, cfg.WindowHeight, cfg.FPS, *outPath)...)
+		}
+		if err != nil {
+			return err
+		}
+
+		onRenderProgress := func(p sim.RenderProgress) {
+			// the map is ready once the first frame is rendered
+			if p.Frame == 1 {
+				progressDone()
+			}
+			if !*sf.quiet {
+				fmt.Fprintf(os.Stderr, "\rrendering: frame %d/%d ", p.Frame, p.FrameCount)
+			}
+		}
+
+		backend := sim.RaylibBackend
+		if *software {
+			backend = sim.SoftwareBackend
+		}
+
+		err = s.Render(ctx, backend, w, onRenderProgress)
+		progressDone()
+		if !*sf.quiet {
+			fmt.Fprintln(os.Stderr)
+			printThinned(os.Stderr, s.ThinnedOnsets())
+		}
+
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"ray_midi_sim/internal/audio"
+	"ray_midi_sim/internal/midi"
+)
+
+func sliceCommand(fs *flag.FlagSet) func() error {
+	midPath := fs.String("mid", "", "path to the MIDI file to slice")
+	wavPath := fs.String("wav", "", "path to the WAV file to slice")
+	midOut := fs.String("mid-out", "slice.mid", "output MIDI path")
+	wavOut := fs.String("wav-out", "slice.wav", "output WAV path")
+	excerpt := registerExcerptFlags(fs, "seconds of the song the slice starts at")
+
+	return func() error {
+		if *midPath == "" && *wavPath == "" {
+			return fmt.Errorf("%w: -mid or -wav is required", errUsage)
+		}
+
+		startSec, endSec, ok, err := excerpt.bounds()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: -start or -duration is required", errUsage)
+		}
+
+		if *midPath != "" {
+			m, err := midi.New(*midPath)
+			if err != nil {
+				return err
+			}
+
+			if err := m.Slice(startSec, endSec); err != nil {
+				return err
+			}
+
+			if err := m.SaveMidi(*midOut); err != nil {
+				return err
+			}
+		}
+
+		if *wavPath != "" {
+			return audio.SliceWAV(*wavPath, *wavOut, startSec, endSec)
+		}
+
+		return nil
+	}
+}
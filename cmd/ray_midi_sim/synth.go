@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+
+	"ray_midi_sim/internal/midi"
+)
+
+func synthCommand(fs *flag.FlagSet) func() error {
+	midPath := fs.String("mid", "", "path to the MIDI file (required)")
+	synf := registerSynthFlags(fs, "path to the SoundFont (required)")
+	outPath := fs.String("o", "out.wav", "output WAV path")
+
+	return func() error {
+		if err := requireFlag(*midPath, "mid"); err != nil {
+			return err
+		}
+		if err := requireFlag(*synf.soundFontPath, "sf2"); err != nil {
+			return err
+		}
+
+		m, err := midi.New(*midPath)
+		if err != nil {
+			return err
+		}
+
+		synth, err := synf.synthesizer()
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		return m.ToWav(ctx, synth, *outPath)
+	}
+}
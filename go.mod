@@ -3,8 +3,10 @@ module ray_midi_sim
 go 1.23.5
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/gen2brain/raylib-go/raylib v0.0.0-20250215042252-db8e47f0e5c5
 	gitlab.com/gomidi/midi/v2 v2.2.19
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
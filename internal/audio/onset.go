@@ -0,0 +1,177 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+const (
+	onsetFrameSize = 1024  // samples of a spectrum frame, a power of 2
+	onsetHopSec    = 0.005 // time between spectrum frames, the resolution of the onsets
+
+	// spectra are compressed with log(1 + onsetCompression*magnitude), so quiet notes count as well
+	onsetCompression = 100
+
+	// the threshold of a frame is the mean flux around it plus a fixed delta that shrinks with the sensitivity
+	onsetMeanWindowSec = 0.1
+	onsetMaxDelta      = 0.3
+
+	// a peak has to be the largest flux this close to it
+	onsetPeakWindowSec = 0.03
+)
+
+// OnsetParams tune the onset detector
+type OnsetParams struct {
+	Sensitivity    float64 // between 0 and 1, higher finds quieter onsets
+	MinIntervalSec float64 // onsets closer than this to the previous one are dropped
+}
+
+func DefaultOnsetParams() OnsetParams {
+	return OnsetParams{
+		Sensitivity:    0.5,
+		MinIntervalSec: 0.05,
+	}
+}
+
+// DetectOnsets returns the times in seconds at which notes start, found as peaks of the spectral flux,
+// the increase of the compressed magnitude spectrum from one frame to the next.
+func DetectOnsets(pcm PCM, params OnsetParams) []float64 {
+	flux, hopSec := spectralFlux(pcm)
+	if len(flux) == 0 {
+		return nil
+	}
+
+	meanWindow := max(1, int(onsetMeanWindowSec/hopSec))
+	peakWindow := max(1, int(onsetPeakWindowSec/hopSec))
+	delta := onsetMaxDelta * (1 - max(0, min(1, params.Sensitivity)))
+
+	// running sums for the mean around each frame
+	prefix := make([]float64, len(flux)+1)
+	for i, f := range flux {
+		prefix[i+1] = prefix[i] + f
+	}
+
+	var onsets []float64
+	lastOnsetSec := math.Inf(-1)
+
+	for i, f := range flux {
+		lo, hi := max(0, i-meanWindow), min(len(flux), i+meanWindow+1)
+		threshold := (prefix[hi]-prefix[lo])/float64(hi-lo) + delta
+		if f <= threshold {
+			continue
+		}
+
+		isPeak := true
+		for j := max(0, i-peakWindow); j < min(len(flux), i+peakWindow+1); j++ {
+			// ties go to the earliest frame
+			if flux[j] > f || (flux[j] == f && j < i) {
+				isPeak = false
+				break
+			}
+		}
+		if !isPeak {
+			continue
+		}
+
+		timeSec := float64(i) * hopSec
+		if timeSec-lastOnsetSec < params.MinIntervalSec {
+			continue
+		}
+
+		onsets = append(onsets, timeSec)
+		lastOnsetSec = timeSec
+	}
+
+	return onsets
+}
+
+// spectralFlux returns the half wave rectified spectral flux of frames ending every onsetHopSec,
+// normalised so the largest value is 1, and the exact time between the frames
+func spectralFlux(pcm PCM) ([]float64, float64) {
+	if len(pcm.Samples) == 0 {
+		return nil, 0
+	}
+
+	hop := max(1, int(math.Round(onsetHopSec*float64(pcm.SampleRate))))
+	frameCount := len(pcm.Samples)/hop + 1
+
+	window := make([]float64, onsetFrameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/onsetFrameSize)
+	}
+
+	bins := onsetFrameSize/2 + 1
+	previous := make([]float64, bins)
+	current := make([]float64, bins)
+	frame := make([]complex128, onsetFrameSize)
+
+	flux := make([]float64, frameCount)
+	var maxFlux float64
+
+	for n := range frameCount {
+		// frame n ends one hop after sample n*hop, samples outside the audio are silence.
+		// the flux peaks at the first or second frame reaching an onset, so this puts it within a hop of the onset
+		// where a centered frame would find it up to half a frame early
+		start := (n+1)*hop - onsetFrameSize
+		for i := range frame {
+			var sample float64
+			if idx := start + i; idx >= 0 && idx < len(pcm.Samples) {
+				sample = pcm.Samples[idx]
+			}
+			frame[i] = complex(sample*window[i], 0)
+		}
+
+		fft(frame)
+
+		var sum float64
+		for k := range bins {
+			current[k] = math.Log1p(onsetCompression * cmplx.Abs(frame[k]))
+			if n > 0 {
+				sum += max(0, current[k]-previous[k])
+			}
+		}
+
+		flux[n] = sum
+		maxFlux = max(maxFlux, sum)
+		previous, current = current, previous
+	}
+
+	if maxFlux > 0 {
+		for i := range flux {
+			flux[i] /= maxFlux
+		}
+	}
+
+	return flux, float64(hop) / float64(pcm.SampleRate)
+}
+
+// fft is an in place iterative radix 2 FFT, len(x) has to be a power of 2
+func fft(x []complex128) {
+	n := len(x)
+
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := range size / 2 {
+				even, odd := x[start+k], x[start+k+size/2]*w
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+type click struct {
+	sec       float64
+	amplitude float64
+}
+
+// clickPCM returns silence with a quickly decaying 1 kHz tone starting at every click
+func clickPCM(sampleRate int, durationSec float64, clicks ...click) PCM {
+	pcm := PCM{Samples: make([]float64, int(durationSec*float64(sampleRate))), SampleRate: sampleRate}
+	for _, c := range clicks {
+		start := int(math.Round(c.sec * float64(sampleRate)))
+		for i := start; i < len(pcm.Samples) && i < start+sampleRate/4; i++ {
+			sec := float64(i-start) / float64(sampleRate)
+			pcm.Samples[i] += c.amplitude * math.Exp(-sec/0.01) * math.Sin(2*math.Pi*1000*sec)
+		}
+	}
+
+	return pcm
+}
+
+func TestDetectOnsets(t *testing.T) {
+	clicks := []click{{0.25, 0.5}, {0.7, 0.8}, {1.2013, 0.3}, {1.65, 0.5}, {2.3007, 0.8}}
+
+	for _, sampleRate := range []int{22050, 44100, 48000} {
+		pcm := clickPCM(sampleRate, 2.5, clicks...)
+		onsets := DetectOnsets(pcm, DefaultOnsetParams())
+
+		if len(onsets) != len(clicks) {
+			t.Fatalf("%d Hz: got onsets %v, want one for each of %v", sampleRate, onsets, clicks)
+		}
+		for i, c := range clicks {
+			if math.Abs(onsets[i]-c.sec) > onsetHopSec {
+				t.Errorf("%d Hz: got an onset at %.4fs for the click at %.4fs, want it within %vs", sampleRate, onsets[i], c.sec, onsetHopSec)
+			}
+		}
+	}
+}
+
+func TestDetectOnsetsSilence(t *testing.T) {
+	for name, pcm := range map[string]PCM{
+		"empty":  {SampleRate: 44100},
+		"silent": {Samples: make([]float64, 44100), SampleRate: 44100},
+	} {
+		if onsets := DetectOnsets(pcm, OnsetParams{Sensitivity: 1}); onsets != nil {
+			t.Errorf("%s: got onsets %v, want none", name, onsets)
+		}
+	}
+}
+
+func TestDetectOnsetsSensitivity(t *testing.T) {
+	pcm := clickPCM(44100, 1.5, click{0.5, 0.8}, click{1, 0.01})
+
+	tests := []struct {
+		sensitivity float64
+		want        []float64
+	}{
+		{0, []float64{0.5}},
+		{0.5, []float64{0.5}},
+		{0.9, []float64{0.5, 1}},
+	}
+
+	for _, tt := range tests {
+		onsets := DetectOnsets(pcm, OnsetParams{Sensitivity: tt.sensitivity, MinIntervalSec: 0.05})
+		if len(onsets) != len(tt.want) {
+			t.Fatalf("sensitivity %v: got onsets %v, want %v", tt.sensitivity, onsets, tt.want)
+		}
+		for i, want := range tt.want {
+			if math.Abs(onsets[i]-want) > onsetHopSec {
+				t.Errorf("sensitivity %v: got onsets %v, want %v", tt.sensitivity, onsets, tt.want)
+			}
+		}
+	}
+
+	// the sensitivity is clamped between 0 and 1
+	for _, bounds := range [][2]float64{{-1, 0}, {2, 1}} {
+		got := DetectOnsets(pcm, OnsetParams{Sensitivity: bounds[0], MinIntervalSec: 0.05})
+		if want := DetectOnsets(pcm, OnsetParams{Sensitivity: bounds[1], MinIntervalSec: 0.05}); !reflect.DeepEqual(got, want) {
+			t.Errorf("sensitivity %v: got onsets %v, want the %v of sensitivity %v", bounds[0], got, want, bounds[1])
+		}
+	}
+}
+
+func TestDetectOnsetsMinInterval(t *testing.T) {
+	pcm := clickPCM(44100, 1, click{0.5, 0.8}, click{0.54, 0.8})
+
+	// the later onset is dropped
+	onsets := DetectOnsets(pcm, OnsetParams{Sensitivity: 0.5, MinIntervalSec: 0.05})
+	if len(onsets) != 1 || math.Abs(onsets[0]-0.5) > onsetHopSec {
+		t.Errorf("got onsets %v, want only the one at 0.5s", onsets)
+	}
+
+	onsets = DetectOnsets(pcm, OnsetParams{Sensitivity: 0.5, MinIntervalSec: 0.02})
+	if len(onsets) != 2 {
+		t.Errorf("got onsets %v, want both clicks 40ms apart", onsets)
+	}
+}
+
+func TestFFT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, n := range []int{1, 2, 4, 8, 64, 1024} {
+		x := make([]complex128, n)
+		for i := range x {
+			x[i] = complex(rng.Float64()*2-1, rng.Float64()*2-1)
+		}
+
+		// the naive DFT
+		want := make([]complex128, n)
+		for k := range want {
+			for i, v := range x {
+				want[k] += v * cmplx.Exp(complex(0, -2*math.Pi*float64(k*i)/float64(n)))
+			}
+		}
+
+		got := append([]complex128(nil), x...)
+		fft(got)
+		for k := range want {
+			if cmplx.Abs(got[k]-want[k]) > 1e-9*float64(n) {
+				t.Errorf("size %d, bin %d: got %v, want %v", n, k, got[k], want[k])
+				break
+			}
+		}
+	}
+}
+
+// wavFormat returns the body of a fmt chunk at 8000 Hz, an extensible one carries the format in its sub format GUID
+func wavFormat(format, channels, bitsPerSample uint16, extensible bool) []byte {
+	tag := format
+	if extensible {
+		tag = wavFormatExtensible
+	}
+
+	blockAlign := channels * bitsPerSample / 8
+	b := binary.LittleEndian.AppendUint16(nil, tag)
+	b = binary.LittleEndian.AppendUint16(b, channels)
+	b = binary.LittleEndian.AppendUint32(b, 8000)
+	b = binary.LittleEndian.AppendUint32(b, 8000*uint32(blockAlign))
+	b = binary.LittleEndian.AppendUint16(b, blockAlign)
+	b = binary.LittleEndian.AppendUint16(b, bitsPerSample)
+	if extensible {
+		b = binary.LittleEndian.AppendUint16(b, 22)
+		b = binary.LittleEndian.AppendUint16(b, bitsPerSample)
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = binary.LittleEndian.AppendUint16(b, format)
+		b = append(b, "\x00\x00\x00\x00\x10\x00\x80\x00\x00\xaa\x00\x38\x9b\x71"...)
+	}
+
+	return b
+}
+
+// wavFile returns a RIFF WAVE file of the chunks, given as id and body pairs
+func wavFile(chunks ...any) []byte {
+	var body []byte
+	for i := 0; i+1 < len(chunks); i += 2 {
+		data := chunks[i+1].([]byte)
+		body = append(body, chunks[i].(string)...)
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+		body = append(body, data...)
+		if len(data)%2 == 1 {
+			body = append(body, 0)
+		}
+	}
+
+	file := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(4+len(body)))...)
+	file = append(file, "WAVE"...)
+	return append(file, body...)
+}
+
+func float32Bytes(values ...float32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+
+	return b
+}
+
+func TestDecodeWAV(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []float64
+	}{
+		{
+			name: "8 bit",
+			data: wavFile("fmt ", wavFormat(wavFormatPCM, 1, 8, false), "data", []byte{128, 192, 0, 255}),
+			want: []float64{0, 0.5, -1, 127.0 / 128},
+		},
+		{
+			name: "16 bit",
+			data: wavFile("fmt ", wavFormat(wavFormatPCM, 1, 16, false), "data", []byte{0, 0, 0, 0x40, 0, 0x80, 0xff, 0x7f}),
+			want: []float64{0, 0.5, -1, 32767.0 / 32768},
+		},
+		{
+			name: "24 bit",
+			data: wavFile("fmt ", wavFormat(wavFormatPCM, 1, 24, false), "data", []byte{0, 0, 0, 0, 0, 0x40, 0, 0, 0x80, 0, 0, 0xc0}),
+			want: []float64{0, 0.5, -1, -0.5},
+		},
+		{
+			name: "32 bit",
+			data: wavFile("fmt ", wavFormat(wavFormatPCM, 1, 32, false), "data", []byte{0, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 0, 0x80}),
+			want: []float64{0, 0.5, -1},
+		},
+		{
+			name: "32 bit float",
+			data: wavFile("fmt ", wavFormat(wavFormatFloat, 1, 32, false), "data", float32Bytes(0, 0.25, -1)),
+			want: []float64{0, 0.25, -1},
+		},
+		{
+			name: "extensible 24 bit",
+			data: wavFile("fmt ", wavFormat(wavFormatPCM, 1, 24, true), "data", []byte{0, 0, 0x40, 0, 0, 0x80}),
+			want: []float64{0.5, -1},
+		},
+		{
+			name: "extensible float",
+			data: wavFile("fmt ", wavFormat(wavFormatFloat, 1, 32, true), "data", float32Bytes(0.25, -0.5)),
+			want: []float64{0.25, -0.5},
+		},
+		{
+			name: "the channels are averaged",
+			data: wavFile("fmt ", wavFormat(wavFormatPCM, 2, 16, false), "data", []byte{0, 0x40, 0, 0xc0, 0, 0x40, 0, 0x40}),
+			want: []float64{0, 0.5},
+		},
+		{
+			name: "other chunks are skipped with their padding",
+			data: wavFile("LIST", []byte("odd"), "fmt ", wavFormat(wavFormatPCM, 1, 8, false), "junk", []byte{1}, "data", []byte{192}),
+			want: []float64{0.5},
+		},
+		{
+			name: "a cut off frame is dropped",
+			data: wavFile("fmt ", wavFormat(wavFormatPCM, 2, 16, false), "data", []byte{0, 0x40, 0, 0x40, 0, 0x40}),
+			want: []float64{0.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pcm, err := decodeWAV(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if pcm.SampleRate != 8000 {
+				t.Errorf("got %d Hz, want 8000", pcm.SampleRate)
+			}
+			if !reflect.DeepEqual(pcm.Samples, tt.want) {
+				t.Errorf("got samples %v, want %v", pcm.Samples, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeWAVInvalid(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":            nil,
+		"not a wave":       []byte("RIFF\x04\x00\x00\x00AVI "),
+		"no data chunk":    wavFile("fmt ", wavFormat(wavFormatPCM, 1, 16, false)),
+		"no fmt chunk":     wavFile("data", []byte{0, 0}),
+		"short fmt":        wavFile("fmt ", wavFormat(wavFormatPCM, 1, 16, false)[:14], "data", []byte{0, 0}),
+		"no channels":      wavFile("fmt ", wavFormat(wavFormatPCM, 0, 16, false), "data", []byte{0, 0}),
+		"12 bit":           wavFile("fmt ", wavFormat(wavFormatPCM, 1, 12, false), "data", []byte{0, 0}),
+		"64 bit float":     wavFile("fmt ", wavFormat(wavFormatFloat, 1, 64, false), "data", make([]byte, 8)),
+		"ADPCM":            wavFile("fmt ", wavFormat(2, 1, 4, false), "data", []byte{0, 0}),
+		"extensible A-law": wavFile("fmt ", wavFormat(6, 1, 8, true), "data", []byte{0, 0}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decodeWAV(data); !errors.Is(err, ErrUnsupportedWAV) {
+				t.Errorf("got %v, want ErrUnsupportedWAV", err)
+			}
+		})
+	}
+}
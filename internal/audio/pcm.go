@@ -0,0 +1,140 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+var ErrUnsupportedWAV = errors.New("unsupported WAV file")
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// PCM is decoded audio mixed down to mono, with samples between -1 and 1
+type PCM struct {
+	Samples    []float64
+	SampleRate int
+}
+
+func (p PCM) Duration() float64 {
+	return float64(len(p.Samples)) / float64(p.SampleRate)
+}
+
+// ReadWAV decodes a WAV file with 8, 16, 24 or 32 bit integer or 32 bit float samples, the channels are averaged
+func ReadWAV(path string) (PCM, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PCM{}, err
+	}
+
+	pcm, err := decodeWAV(data)
+	if err != nil {
+		return PCM{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return pcm, nil
+}
+
+// wavChunks returns the bodies of the fmt and data chunks of a WAV file
+func wavChunks(data []byte) ([]byte, []byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, nil, fmt.Errorf("%w: not a RIFF WAVE file", ErrUnsupportedWAV)
+	}
+
+	var format, samples []byte
+
+	for rest := data[12:]; len(rest) >= 8; {
+		id := string(rest[:4])
+		size := int(binary.LittleEndian.Uint32(rest[4:8]))
+		body := rest[8:min(len(rest), 8+size)] // a cut off data chunk is played as far as it goes
+
+		switch id {
+		case "fmt ":
+			format = body
+		case "data":
+			samples = body
+		}
+
+		rest = rest[min(len(rest), 8+size+size%2):]
+	}
+
+	if format == nil || samples == nil {
+		return nil, nil, fmt.Errorf("%w: missing fmt or data chunk", ErrUnsupportedWAV)
+	}
+	if len(format) < 16 {
+		return nil, nil, fmt.Errorf("%w: fmt chunk too short", ErrUnsupportedWAV)
+	}
+
+	return format, samples, nil
+}
+
+func decodeWAV(data []byte) (PCM, error) {
+	formatChunk, samples, err := wavChunks(data)
+	if err != nil {
+		return PCM{}, err
+	}
+
+	format := binary.LittleEndian.Uint16(formatChunk[0:])
+	channels := binary.LittleEndian.Uint16(formatChunk[2:])
+	sampleRate := binary.LittleEndian.Uint32(formatChunk[4:])
+	bitsPerSample := binary.LittleEndian.Uint16(formatChunk[14:])
+
+	// the actual format is the start of the sub format GUID
+	if format == wavFormatExtensible && len(formatChunk) >= 26 {
+		format = binary.LittleEndian.Uint16(formatChunk[24:])
+	}
+
+	if channels == 0 || sampleRate == 0 {
+		return PCM{}, fmt.Errorf("%w: %d channels at %d Hz", ErrUnsupportedWAV, channels, sampleRate)
+	}
+
+	decode, err := sampleDecoder(format, bitsPerSample)
+	if err != nil {
+		return PCM{}, err
+	}
+
+	bytesPerSample := int(bitsPerSample / 8)
+	frameSize := bytesPerSample * int(channels)
+	frames := len(samples) / frameSize
+
+	pcm := PCM{
+		Samples:    make([]float64, frames),
+		SampleRate: int(sampleRate),
+	}
+
+	for i := range frames {
+		var sum float64
+		for c := range int(channels) {
+			offset := i*frameSize + c*bytesPerSample
+			sum += decode(samples[offset : offset+bytesPerSample])
+		}
+		pcm.Samples[i] = sum / float64(channels)
+	}
+
+	return pcm, nil
+}
+
+func sampleDecoder(format, bitsPerSample uint16) (func([]byte) float64, error) {
+	switch {
+	case format == wavFormatPCM && bitsPerSample == 8:
+		return func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }, nil
+	case format == wavFormatPCM && bitsPerSample == 16:
+		return func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }, nil
+	case format == wavFormatPCM && bitsPerSample == 24:
+		return func(b []byte) float64 {
+			return float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+		}, nil
+	case format == wavFormatPCM && bitsPerSample == 32:
+		return func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }, nil
+	case format == wavFormatFloat && bitsPerSample == 32:
+		return func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }, nil
+	default:
+		return nil, fmt.Errorf("%w: format %d with %d bits per sample", ErrUnsupportedWAV, format, bitsPerSample)
+	}
+}
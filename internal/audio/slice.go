@@ -0,0 +1,89 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+var ErrInvalidSlice = errors.New("invalid slice")
+
+// SliceWAV writes the audio of the WAV file at srcPath between startSec and endSec to dstPath, keeping its format.
+// An endSec past the end of the audio slices up to the end.
+func SliceWAV(srcPath, dstPath string, startSec, endSec float64) error {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return err
+	}
+
+	format, samples, err := wavChunks(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", srcPath, err)
+	}
+
+	sampleRate := float64(binary.LittleEndian.Uint32(format[4:]))
+	frameSize := int(binary.LittleEndian.Uint16(format[12:])) // block align, the bytes of a sample of every channel
+	if sampleRate == 0 || frameSize == 0 {
+		return fmt.Errorf("%s: %w: %v Hz with %d byte frames", srcPath, ErrUnsupportedWAV, sampleRate, frameSize)
+	}
+
+	frames := len(samples) / frameSize
+	if startSec < 0 || endSec <= startSec || startSec*sampleRate >= float64(frames) {
+		return fmt.Errorf("%s: %w: from %vs to %vs of %.3fs", srcPath, ErrInvalidSlice, startSec, endSec, float64(frames)/sampleRate)
+	}
+
+	startFrame := int(math.Round(startSec * sampleRate))
+	endFrame := frames
+	if endSec*sampleRate < float64(frames) {
+		endFrame = int(math.Round(endSec * sampleRate))
+	}
+
+	return writeWAV(dstPath, format, samples[startFrame*frameSize:endFrame*frameSize])
+}
+
+// writeWAV writes a WAV file made of a fmt chunk and a data chunk with the given bodies
+func writeWAV(path string, format, samples []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+
+	riffSize := 4 + 8 + len(format) + len(format)%2 + 8 + len(samples) + len(samples)%2
+	if riffSize > math.MaxUint32 {
+		f.Close()
+		os.Remove(path)
+		return ErrWAVTooLarge
+	}
+
+	w.WriteString("RIFF")
+	binary.Write(w, binary.LittleEndian, uint32(riffSize))
+	w.WriteString("WAVE")
+
+	for _, chunk := range []struct {
+		id   string
+		body []byte
+	}{{"fmt ", format}, {"data", samples}} {
+		w.WriteString(chunk.id)
+		binary.Write(w, binary.LittleEndian, uint32(len(chunk.body)))
+		w.Write(chunk.body)
+		if len(chunk.body)%2 == 1 {
+			w.WriteByte(0)
+		}
+	}
+
+	// a bufio.Writer keeps the first error, Flush returns it
+	err = w.Flush()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+
+	return err
+}
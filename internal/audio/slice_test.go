@@ -0,0 +1,98 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeRampWAV writes a stereo WAV file at 1000 Hz whose frames mix down to their own index divided by 32768
+func writeRampWAV(t *testing.T, frames int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ramp.wav")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ww, err := NewWAVWriter(f, 1000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range frames {
+		if err := ww.Write([]int16{int16(2 * i), 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ww.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestSliceWAV(t *testing.T) {
+	srcPath := writeRampWAV(t, 1000)
+
+	tests := []struct {
+		name             string
+		startSec, endSec float64
+		wantFirst        int // the index of the first frame kept
+		wantFrames       int
+	}{
+		{"whole file", 0, 1, 0, 1000},
+		{"middle", 0.25, 0.5, 250, 250},
+		{"rounded to the nearest frame", 0.2504, 0.4996, 250, 250},
+		{"past the end", 0.5, 5, 500, 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dstPath := filepath.Join(t.TempDir(), "slice.wav")
+			if err := SliceWAV(srcPath, dstPath, tt.startSec, tt.endSec); err != nil {
+				t.Fatal(err)
+			}
+
+			pcm, err := ReadWAV(dstPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pcm.Samples) != tt.wantFrames {
+				t.Fatalf("got %d frames, want %d", len(pcm.Samples), tt.wantFrames)
+			}
+			for i, sample := range pcm.Samples {
+				if got := int(math.Round(sample * 32768)); got != tt.wantFirst+i {
+					t.Fatalf("frame %d: got frame %d of the source, want %d", i, got, tt.wantFirst+i)
+				}
+			}
+
+			data, err := os.ReadFile(dstPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			format, _, err := wavChunks(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if channels := binary.LittleEndian.Uint16(format[2:]); channels != 2 {
+				t.Errorf("got %d channels, want the 2 of the source", channels)
+			}
+		})
+	}
+}
+
+func TestSliceWAVInvalid(t *testing.T) {
+	srcPath := writeRampWAV(t, 1000)
+
+	for _, bounds := range [][2]float64{{-0.1, 0.5}, {0.5, 0.5}, {0.5, 0.25}, {1, 2}} {
+		dstPath := filepath.Join(t.TempDir(), "slice.wav")
+		if err := SliceWAV(srcPath, dstPath, bounds[0], bounds[1]); !errors.Is(err, ErrInvalidSlice) {
+			t.Errorf("slice %v: got %v, want ErrInvalidSlice", bounds, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const wavHeaderSize = 44
+
+var ErrWAVTooLarge = errors.New("WAV data larger than 4 GiB")
+
+// WAVWriter writes 16 bit PCM samples to a WAV file, the sizes in the header are filled in on Close
+type WAVWriter struct {
+	w          io.WriteSeeker
+	buf        *bufio.Writer
+	sampleRate int
+	channels   int
+	dataSize   int64
+}
+
+// NewWAVWriter writes a placeholder header to w, which is usually a file
+func NewWAVWriter(w io.WriteSeeker, sampleRate, channels int) (*WAVWriter, error) {
+	ww := &WAVWriter{
+		w:          w,
+		buf:        bufio.NewWriter(w),
+		sampleRate: sampleRate,
+		channels:   channels,
+	}
+
+	if err := ww.writeHeader(); err != nil {
+		return nil, err
+	}
+
+	return ww, nil
+}
+
+// Write writes interleaved samples, a multiple of the channel count
+func (ww *WAVWriter) Write(samples []int16) error {
+	if ww.dataSize+int64(len(samples))*2 > 0xFFFFFFFF-wavHeaderSize {
+		return ErrWAVTooLarge
+	}
+	ww.dataSize += int64(len(samples)) * 2
+
+	return binary.Write(ww.buf, binary.LittleEndian, samples)
+}
+
+// Close writes the final header, it does not close the underlying writer
+func (ww *WAVWriter) Close() error {
+	if err := ww.buf.Flush(); err != nil {
+		return err
+	}
+	if _, err := ww.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := ww.writeHeader(); err != nil {
+		return err
+	}
+
+	_, err := ww.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (ww *WAVWriter) writeHeader() error {
+	blockAlign := ww.channels * 2
+
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(wavHeaderSize - 8 + ww.dataSize),
+		[4]byte{'W', 'A', 'V', 'E'},
+
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),
+		uint16(1), // PCM
+		uint16(ww.channels),
+		uint32(ww.sampleRate),
+		uint32(ww.sampleRate * blockAlign),
+		uint16(blockAlign),
+		uint16(16),
+
+		[4]byte{'d', 'a', 't', 'a'},
+		uint32(ww.dataSize),
+	}
+
+	for _, field := range header {
+		if err := binary.Write(ww.buf, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	return ww.buf.Flush()
+}
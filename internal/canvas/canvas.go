@@ -0,0 +1,114 @@
+package canvas
+
+import (
+	"image/color"
+	"math"
+)
+
+// Vec2 is a point or a size, it has the layout of rl.Vector2 so one converts to the other
+type Vec2 struct {
+	X, Y float32
+}
+
+// Rect has the layout of rl.Rectangle so one converts to the other
+type Rect struct {
+	X, Y, Width, Height float32
+}
+
+// Camera is a 2D camera like rl.Camera2D, Target is seen at Offset on the screen, rotated and zoomed around it
+type Camera struct {
+	Offset   Vec2
+	Target   Vec2
+	Rotation float32
+	Zoom     float32
+}
+
+// Canvas is what the simulation draws on. Positions are transformed by the active camera and transforms,
+// line widths are in screen pixels like they are in raylib.
+type Canvas interface {
+	Clear(c color.RGBA)
+
+	DrawLine(start, end Vec2, c color.RGBA)
+	DrawRectangle(rect Rect, c color.RGBA)
+	DrawRectangleLines(rect Rect, thickness float32, c color.RGBA)
+	DrawRectangleGradientV(rect Rect, top, bottom color.RGBA)
+
+	// PushTransform saves the current transform, Translate, Rotate and Scale change it until the matching PopTransform
+	PushTransform()
+	PopTransform()
+	Translate(x, y float32)
+	Rotate(degrees float32)
+	Scale(x, y float32)
+
+	// BeginCamera draws in world coordinates seen through the camera until EndCamera.
+	// Like rl.BeginMode2D it replaces the current transform instead of adding to it.
+	BeginCamera(camera Camera)
+	EndCamera()
+}
+
+// Transform is a 2D affine transform, a point p maps to (a*p.X + c*p.Y + tx, b*p.X + d*p.Y + ty)
+type Transform struct {
+	a, b, c, d float32
+	tx, ty     float32
+}
+
+func Identity() Transform {
+	return Transform{a: 1, d: 1}
+}
+
+func Translation(x, y float32) Transform {
+	return Transform{a: 1, d: 1, tx: x, ty: y}
+}
+
+func Rotation(degrees float32) Transform {
+	sin, cos := math.Sincos(float64(degrees) * math.Pi / 180)
+	return Transform{a: float32(cos), b: float32(sin), c: float32(-sin), d: float32(cos)}
+}
+
+func Scaling(x, y float32) Transform {
+	return Transform{a: x, d: y}
+}
+
+// CameraTransform maps world coordinates to screen coordinates the same way rl.BeginMode2D does
+func CameraTransform(camera Camera) Transform {
+	return Translation(camera.Offset.X, camera.Offset.Y).
+		Then(Rotation(camera.Rotation)).
+		Then(Scaling(camera.Zoom, camera.Zoom)).
+		Then(Translation(-camera.Target.X, -camera.Target.Y))
+}
+
+// Then returns the transform that applies next first and t after it,
+// the order rlgl uses when a translation, rotation or scale is added to the current matrix
+func (t Transform) Then(next Transform) Transform {
+	return Transform{
+		a:  t.a*next.a + t.c*next.b,
+		b:  t.b*next.a + t.d*next.b,
+		c:  t.a*next.c + t.c*next.d,
+		d:  t.b*next.c + t.d*next.d,
+		tx: t.a*next.tx + t.c*next.ty + t.tx,
+		ty: t.b*next.tx + t.d*next.ty + t.ty,
+	}
+}
+
+func (t Transform) Apply(p Vec2) Vec2 {
+	return Vec2{X: t.a*p.X + t.c*p.Y + t.tx, Y: t.b*p.X + t.d*p.Y + t.ty}
+}
+
+// Inverse returns false if the transform collapses the plane, for example with a zoom of 0
+func (t Transform) Inverse() (Transform, bool) {
+	det := t.a*t.d - t.b*t.c
+	if det == 0 {
+		return Transform{}, false
+	}
+
+	inv := Transform{
+		a: t.d / det,
+		b: -t.b / det,
+		c: -t.c / det,
+		d: t.a / det,
+	}
+	inv.tx = -(inv.a*t.tx + inv.c*t.ty)
+	inv.ty = -(inv.b*t.tx + inv.d*t.ty)
+
+	return inv, true
+}
@@ -0,0 +1,74 @@
+// Package rlcanvas draws the canvas API with raylib, it is kept out of package canvas so the software canvas
+// and everything drawn with it builds and tests without raylib
+package rlcanvas
+
+import (
+	"image/color"
+
+	"ray_midi_sim/internal/canvas"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Canvas draws with raylib on whatever render target is active, the window or a render texture
+type Canvas struct{}
+
+var _ canvas.Canvas = Canvas{}
+
+func New() Canvas {
+	return Canvas{}
+}
+
+func (Canvas) Clear(c color.RGBA) {
+	rl.ClearBackground(c)
+}
+
+func (Canvas) DrawLine(start, end canvas.Vec2, c color.RGBA) {
+	rl.DrawLineV(rl.Vector2(start), rl.Vector2(end), c)
+}
+
+func (Canvas) DrawRectangle(rect canvas.Rect, c color.RGBA) {
+	rl.DrawRectangleRec(rl.Rectangle(rect), c)
+}
+
+func (Canvas) DrawRectangleLines(rect canvas.Rect, thickness float32, c color.RGBA) {
+	rl.DrawRectangleLinesEx(rl.Rectangle(rect), thickness, c)
+}
+
+func (Canvas) DrawRectangleGradientV(rect canvas.Rect, top, bottom color.RGBA) {
+	// raylib takes the corners counter clockwise from the top left, so both bottom corners are in the middle
+	rl.DrawRectangleGradientEx(rl.Rectangle(rect), top, bottom, bottom, top)
+}
+
+func (Canvas) PushTransform() {
+	rl.PushMatrix()
+}
+
+func (Canvas) PopTransform() {
+	rl.PopMatrix()
+}
+
+func (Canvas) Translate(x, y float32) {
+	rl.Translatef(x, y, 0)
+}
+
+func (Canvas) Rotate(degrees float32) {
+	rl.Rotatef(degrees, 0, 0, 1)
+}
+
+func (Canvas) Scale(x, y float32) {
+	rl.Scalef(x, y, 1)
+}
+
+func (Canvas) BeginCamera(camera canvas.Camera) {
+	rl.BeginMode2D(rl.Camera2D{
+		Offset:   rl.Vector2(camera.Offset),
+		Target:   rl.Vector2(camera.Target),
+		Rotation: camera.Rotation,
+		Zoom:     camera.Zoom,
+	})
+}
+
+func (Canvas) EndCamera() {
+	rl.EndMode2D()
+}
@@ -0,0 +1,203 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Software draws into an image.RGBA in pure Go, it needs neither a GPU nor a window
+type Software struct {
+	img *image.RGBA
+
+	transform Transform
+	stack     []Transform
+}
+
+func NewSoftware(width, height int) *Software {
+	return &Software{
+		img:       image.NewRGBA(image.Rect(0, 0, width, height)),
+		transform: Identity(),
+	}
+}
+
+// Image returns the image drawn on, it is reused for the next frame
+func (s *Software) Image() *image.RGBA {
+	return s.img
+}
+
+func (s *Software) Clear(c color.RGBA) {
+	for i := 0; i < len(s.img.Pix); i += 4 {
+		s.img.Pix[i+0] = c.R
+		s.img.Pix[i+1] = c.G
+		s.img.Pix[i+2] = c.B
+		s.img.Pix[i+3] = c.A
+	}
+}
+
+// DrawLine draws a 1 pixel wide line between the transformed end points
+func (s *Software) DrawLine(start, end Vec2, c color.RGBA) {
+	start = s.transform.Apply(start)
+	end = s.transform.Apply(end)
+
+	dx := end.X - start.X
+	dy := end.Y - start.Y
+	length := max(abs(dx), abs(dy))
+
+	if length == 0 {
+		s.blend(int(math.Floor(float64(start.X))), int(math.Floor(float64(start.Y))), c)
+		return
+	}
+
+	// step one pixel along the longer axis, interpolating both ends with a fraction would round
+	// 102.99999 down and leave gaps in lines between whole coordinates
+	stepX, stepY := dx/length, dy/length
+	steps := int(math.Ceil(float64(length)))
+
+	for i := 0; i <= steps; i++ {
+		d := min(float32(i), length)
+		s.blend(int(math.Floor(float64(start.X+stepX*d))), int(math.Floor(float64(start.Y+stepY*d))), c)
+	}
+}
+
+func (s *Software) DrawRectangle(rect Rect, c color.RGBA) {
+	s.fill(rect, func(float32) color.RGBA { return c })
+}
+
+// DrawRectangleLines draws the outline inside of rect, like rl.DrawRectangleLinesEx
+func (s *Software) DrawRectangleLines(rect Rect, thickness float32, c color.RGBA) {
+	if thickness*2 >= rect.Width || thickness*2 >= rect.Height {
+		s.DrawRectangle(rect, c)
+		return
+	}
+
+	s.DrawRectangle(Rect{rect.X, rect.Y, rect.Width, thickness}, c)
+	s.DrawRectangle(Rect{rect.X, rect.Y + rect.Height - thickness, rect.Width, thickness}, c)
+	s.DrawRectangle(Rect{rect.X, rect.Y + thickness, thickness, rect.Height - thickness*2}, c)
+	s.DrawRectangle(Rect{rect.X + rect.Width - thickness, rect.Y + thickness, thickness, rect.Height - thickness*2}, c)
+}
+
+func (s *Software) DrawRectangleGradientV(rect Rect, top, bottom color.RGBA) {
+	s.fill(rect, func(t float32) color.RGBA {
+		return color.RGBA{
+			R: lerpByte(top.R, bottom.R, t),
+			G: lerpByte(top.G, bottom.G, t),
+			B: lerpByte(top.B, bottom.B, t),
+			A: lerpByte(top.A, bottom.A, t),
+		}
+	})
+}
+
+func (s *Software) PushTransform() {
+	s.stack = append(s.stack, s.transform)
+}
+
+func (s *Software) PopTransform() {
+	if len(s.stack) == 0 {
+		return
+	}
+
+	s.transform = s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+}
+
+func (s *Software) Translate(x, y float32) {
+	s.transform = s.transform.Then(Translation(x, y))
+}
+
+func (s *Software) Rotate(degrees float32) {
+	s.transform = s.transform.Then(Rotation(degrees))
+}
+
+func (s *Software) Scale(x, y float32) {
+	s.transform = s.transform.Then(Scaling(x, y))
+}
+
+// BeginCamera replaces the current transform with the camera, raylib does the same in rl.BeginMode2D
+func (s *Software) BeginCamera(camera Camera) {
+	s.transform = CameraTransform(camera)
+}
+
+func (s *Software) EndCamera() {
+	s.transform = Identity()
+}
+
+// fill fills the transformed rect, colorAt gets the vertical position inside the rect from 0 (top) to 1 (bottom).
+// Every pixel center inside the bounds of the transformed corners is mapped back into the rect,
+// which works for rotated rects as well.
+func (s *Software) fill(rect Rect, colorAt func(t float32) color.RGBA) {
+	if rect.Width <= 0 || rect.Height <= 0 {
+		return
+	}
+
+	inverse, ok := s.transform.Inverse()
+	if !ok {
+		return
+	}
+
+	corners := [4]Vec2{
+		s.transform.Apply(Vec2{rect.X, rect.Y}),
+		s.transform.Apply(Vec2{rect.X + rect.Width, rect.Y}),
+		s.transform.Apply(Vec2{rect.X + rect.Width, rect.Y + rect.Height}),
+		s.transform.Apply(Vec2{rect.X, rect.Y + rect.Height}),
+	}
+
+	minX, minY := corners[0].X, corners[0].Y
+	maxX, maxY := minX, minY
+	for _, corner := range corners[1:] {
+		minX = min(minX, corner.X)
+		minY = min(minY, corner.Y)
+		maxX = max(maxX, corner.X)
+		maxY = max(maxY, corner.Y)
+	}
+
+	bounds := s.img.Rect
+	startX := max(bounds.Min.X, int(math.Floor(float64(minX))))
+	endX := min(bounds.Max.X, int(math.Ceil(float64(maxX))))
+	startY := max(bounds.Min.Y, int(math.Floor(float64(minY))))
+	endY := min(bounds.Max.Y, int(math.Ceil(float64(maxY))))
+
+	for py := startY; py < endY; py++ {
+		for px := startX; px < endX; px++ {
+			p := inverse.Apply(Vec2{float32(px) + 0.5, float32(py) + 0.5})
+
+			if p.X < rect.X || p.X >= rect.X+rect.Width || p.Y < rect.Y || p.Y >= rect.Y+rect.Height {
+				continue
+			}
+
+			s.blend(px, py, colorAt((p.Y-rect.Y)/rect.Height))
+		}
+	}
+}
+
+// blend draws color over the pixel using its alpha
+func (s *Software) blend(x, y int, c color.RGBA) {
+	if !(image.Point{X: x, Y: y}).In(s.img.Rect) || c.A == 0 {
+		return
+	}
+
+	i := s.img.PixOffset(x, y)
+	pix := s.img.Pix[i : i+4 : i+4]
+
+	if c.A == 255 {
+		pix[0], pix[1], pix[2], pix[3] = c.R, c.G, c.B, 255
+		return
+	}
+
+	alpha := uint32(c.A)
+	pix[0] = uint8((uint32(c.R)*alpha + uint32(pix[0])*(255-alpha)) / 255)
+	pix[1] = uint8((uint32(c.G)*alpha + uint32(pix[1])*(255-alpha)) / 255)
+	pix[2] = uint8((uint32(c.B)*alpha + uint32(pix[2])*(255-alpha)) / 255)
+	pix[3] = uint8(alpha + uint32(pix[3])*(255-alpha)/255)
+}
+
+func lerpByte(from, to uint8, t float32) uint8 {
+	return uint8(math.Round(float64(float32(from) + (float32(to)-float32(from))*t)))
+}
+
+func abs(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,65 @@
+package canvas
+
+import (
+	"image/color"
+	"testing"
+)
+
+var (
+	black = color.RGBA{A: 255}
+	white = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+)
+
+func TestDrawLineHasNoGaps(t *testing.T) {
+	s := NewSoftware(200, 20)
+	s.Clear(black)
+
+	// a camera with an offset puts the ends on coordinates that float32 can not step to exactly
+	s.BeginCamera(Camera{Offset: Vec2{X: 80, Y: 10}, Target: Vec2{X: -0.3}, Zoom: 1})
+	for x := float32(0); x < 100; x += 10 {
+		s.DrawLine(Vec2{X: x, Y: 0}, Vec2{X: x + 10, Y: 0}, white)
+	}
+	s.EndCamera()
+
+	img := s.Image()
+	for x := 80; x <= 180; x++ {
+		if got := img.RGBAAt(x, 10); got != white {
+			t.Errorf("pixel %d: got %v, want white", x, got)
+		}
+	}
+}
+
+func TestDrawRectangleGradientV(t *testing.T) {
+	s := NewSoftware(10, 100)
+	s.DrawRectangleGradientV(Rect{Width: 10, Height: 100}, white, black)
+
+	img := s.Image()
+	if top := img.RGBAAt(5, 0); top.R < 250 {
+		t.Errorf("top: got %v, want close to white", top)
+	}
+	if bottom := img.RGBAAt(5, 99); bottom.R > 5 {
+		t.Errorf("bottom: got %v, want close to black", bottom)
+	}
+	if left, right := img.RGBAAt(0, 50), img.RGBAAt(9, 50); left != right {
+		t.Errorf("the gradient is not vertical, left %v, right %v", left, right)
+	}
+}
+
+func TestTransformInverse(t *testing.T) {
+	transform := CameraTransform(Camera{Offset: Vec2{X: 40, Y: 30}, Target: Vec2{X: 7, Y: -3}, Rotation: 30, Zoom: 2})
+
+	inverse, ok := transform.Inverse()
+	if !ok {
+		t.Fatal("the camera transform should be invertible")
+	}
+
+	p := Vec2{X: 12, Y: 5}
+	got := inverse.Apply(transform.Apply(p))
+	if abs(got.X-p.X) > 1e-4 || abs(got.Y-p.Y) > 1e-4 {
+		t.Errorf("got %v, want %v", got, p)
+	}
+
+	if _, ok := CameraTransform(Camera{Zoom: 0}).Inverse(); ok {
+		t.Error("a zoom of 0 should not be invertible")
+	}
+}
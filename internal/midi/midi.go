@@ -2,8 +2,10 @@ package midi
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
 	"os"
-	"os/exec"
 	"slices"
 
 	gomidi "gitlab.com/gomidi/midi/v2"
@@ -24,80 +26,63 @@ func New(path string) (Midi, error) {
 	return Midi{smf: *parsedSMF}, nil
 }
 
-func (m Midi) getTrackIndexSet(trackIndexes ...int) (map[int]struct{}, bool) {
-	trackIndexMap := make(map[int]struct{})
-	for _, index := range trackIndexes {
-		trackIndexMap[index] = struct{}{}
+// HashFile returns the hex encoded sha256 of the file at path, used to tell which MIDI file a map was made from
+func HashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
 	}
 
-	shouldIncludeAllTracks := len(trackIndexMap) == 0
-
-	return trackIndexMap, shouldIncludeAllTracks
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
 }
 
-func (m *Midi) TrimByDuration(maxSeconds float64, trackIndexes ...int) {
-	// Determine which tracks to process
-	trackIndexMap, shouldIncludeAllTracks := m.getTrackIndexSet(trackIndexes...)
+func (m Midi) TrackCount() int {
+	return len(m.smf.Tracks)
+}
 
-	threshold := int64(maxSeconds * 1_000_000) // convert seconds to microseconds
+// Duration returns the time in seconds of the last event across all tracks
+func (m Midi) Duration() float64 {
+	var maxTicks int64
+	for _, tr := range m.smf.Tracks {
+		maxTicks = max(maxTicks, trackEndTick(tr))
+	}
 
-	for trIdx, tr := range m.smf.Tracks {
-		// If not processing all tracks, skip this one if not in the map
-		if !shouldIncludeAllTracks {
-			if _, exists := trackIndexMap[trIdx]; !exists {
-				continue
-			}
-		}
+	return m.TempoMap().TickToSeconds(float64(maxTicks))
+}
 
-		var (
-			newTrack []smf.Event
-			absTicks int64
-		)
+// TrimByDuration drops everything after maxSeconds from the tracks picked by the selector, the events at
+// maxSeconds itself are kept. Notes still sounding at maxSeconds are released there.
+func (m *Midi) TrimByDuration(maxSeconds float64, selector Selector) {
+	// Determine which tracks to process
+	selectedTracks := m.trackSet(selector)
 
-		for _, ev := range tr {
-			absTicks += int64(ev.Delta)
-			// Get the event time in microseconds
-			eventTimeMicro := m.smf.TimeAt(absTicks)
-
-			// If the event's time is within the desired threshold, keep it
-			if eventTimeMicro <= threshold {
-				newTrack = append(newTrack, ev)
-			} else {
-				// Once we exceed the threshold, stop processing further events
-				break
-			}
-		}
+	endTick := int64(math.Round(m.TempoMap().SecondsToTick(max(0, maxSeconds))))
 
-		// Ensure there's an End-Of-Track event if needed
-		if len(newTrack) > 0 {
-			lastEvent := newTrack[len(newTrack)-1]
-			if lastEvent.Message.Type() != smf.MetaEndOfTrackMsg {
-				// Add an End-Of-Track event with 0 delta
-				newTrack = append(newTrack, smf.Event{
-					Delta:   0,
-					Message: smf.EOT,
-				})
-			}
+	for trIdx, tr := range m.smf.Tracks {
+		// Skip the tracks the selector does not pick and the ones that are already short enough
+		if !selectedTracks[trIdx] || trackEndTick(tr) <= endTick {
+			continue
 		}
 
 		// Update the track in the SMF
-		m.smf.Tracks[trIdx] = newTrack
+		m.smf.Tracks[trIdx] = sliceTrack(tr, 0, endTick, true)
 	}
 }
 
-func (m *Midi) RemoveLeadingSilence(trackIndexes ...int) {
+// RemoveLeadingSilence moves the tracks picked by the selector back so their first note starts right away. It returns
+// the seconds removed, audio that goes with the file has to be cut by as much, see audio.SliceWAV.
+func (m *Midi) RemoveLeadingSilence(selector Selector) float64 {
 	// Determine which tracks to process
-	trackIndexMap, shouldIncludeAllTracks := m.getTrackIndexSet(trackIndexes...)
+	selectedTracks := m.trackSet(selector)
 
 	// Find the minimal absolute tick of the first note-on event among the specified tracks
 	var minTick int64 = -1
 
 	for trIdx, tr := range m.smf.Tracks {
-		// Skip tracks not in our set (if we're *not* including all tracks)
-		if !shouldIncludeAllTracks {
-			if _, exists := trackIndexMap[trIdx]; !exists {
-				continue
-			}
+		// Skip the tracks the selector does not pick
+		if !selectedTracks[trIdx] {
+			continue
 		}
 
 		var absTick int64
@@ -117,16 +102,16 @@ func (m *Midi) RemoveLeadingSilence(trackIndexes ...int) {
 
 	// If minTick <= 0, there's either no note-on event or no leading silence to remove
 	if minTick <= 0 {
-		return
+		return 0
 	}
 
+	removedSec := m.TempoMap().TickToSeconds(float64(minTick))
+
 	// Adjust each specified track's events to remove the initial silence
 	for trIdx, tr := range m.smf.Tracks {
-		// Skip tracks not in our set (if we're *not* including all tracks)
-		if !shouldIncludeAllTracks {
-			if _, exists := trackIndexMap[trIdx]; !exists {
-				continue
-			}
+		// Skip the tracks the selector does not pick
+		if !selectedTracks[trIdx] {
+			continue
 		}
 
 		var newEvents []smf.Event
@@ -153,70 +138,43 @@ func (m *Midi) RemoveLeadingSilence(trackIndexes ...int) {
 		// Update the track with the adjusted events
 		m.smf.Tracks[trIdx] = newEvents
 	}
+
+	return removedSec
 }
 
-func (m *Midi) RemoveTracks(trackIndexes ...int) {
-	trackIndexMap, shouldIncludeAllTracks := m.getTrackIndexSet(trackIndexes...)
+// RemoveTracks removes the tracks picked by the selector, an empty selector removes nothing rather than every track
+func (m *Midi) RemoveTracks(selector Selector) {
+	if selector.isEmpty() {
+		return
+	}
+
+	selectedTracks := m.trackSet(selector)
 
 	var remainingTracks []smf.Track
 
 	for trackIndex, track := range m.smf.Tracks {
-		if !shouldIncludeAllTracks {
-			if _, exists := trackIndexMap[trackIndex]; !exists {
-				remainingTracks = append(remainingTracks, track)
-			}
+		if !selectedTracks[trackIndex] {
+			remainingTracks = append(remainingTracks, track)
 		}
 	}
 
 	m.smf.Tracks = remainingTracks
 }
 
-func (m Midi) ExtractNoteOnTimestamps(trackIndexes ...int) []float64 {
-	trackIndexMap, shouldIncludeAllTracks := m.getTrackIndexSet(trackIndexes...)
-
-	var noteOnTimestamps []float64
-
-	for trIdx, tr := range m.smf.Tracks {
-		if !shouldIncludeAllTracks {
-			if _, exists := trackIndexMap[trIdx]; !exists {
-				continue
-			}
-		}
-
-		var absTicks int64
-
-		for _, ev := range tr {
-			absTicks += int64(ev.Delta)
-
-			// Skip if multiple events have the same absolute tick
-			if ev.Delta == 0 {
-				continue
-			}
-
-			if ev.Message.GetNoteStart(nil, nil, nil) {
-				noteStartMicro := m.smf.TimeAt(absTicks) // returns int64 microseconds
-				noteStartSeconds := float64(noteStartMicro) / 1_000_000.0
-				noteOnTimestamps = append(noteOnTimestamps, noteStartSeconds)
-			}
-		}
-	}
-
-	// If multiple tracks are processed, sort the timestamps
-	if len(m.smf.Tracks) > 1 && (shouldIncludeAllTracks || len(trackIndexes) > 1) {
-		slices.Sort(noteOnTimestamps)
-	}
-
-	return noteOnTimestamps
+// ExtractNoteOnTimestamps returns the sorted start times in seconds of the notes picked by the selector,
+// notes starting at the same time are only counted once
+func (m Midi) ExtractNoteOnTimestamps(selector Selector) []float64 {
+	return OnsetTimes(m.ExtractNoteGroups(selector, 0))
 }
 
-func (m *Midi) SetInstrument(instrument gm.Instr, trackIndexes ...int) {
-	trackIndexMap, shouldIncludeAllTracks := m.getTrackIndexSet(trackIndexes...)
+// SetInstrument replaces the program changes of the tracks picked by the selector, only those
+// on the selected channels if the selector has any
+func (m *Midi) SetInstrument(instrument gm.Instr, selector Selector) {
+	selectedTracks := m.trackSet(selector)
 
 	for trIdx, tr := range m.smf.Tracks {
-		if !shouldIncludeAllTracks {
-			if _, exists := trackIndexMap[trIdx]; !exists {
-				continue
-			}
+		if !selectedTracks[trIdx] {
+			continue
 		}
 
 		var usedChannels []uint8
@@ -226,15 +184,18 @@ func (m *Midi) SetInstrument(instrument gm.Instr, trackIndexes ...int) {
 		for eventIndex, event := range tr {
 			var channel uint8
 
-			if event.Message.GetProgramChange(&channel, nil) {
+			if event.Message.GetProgramChange(&channel, nil) && selector.matchesChannel(channel) {
 				usedChannels = append(usedChannels, channel)
 				programChangeEventIndices = append(programChangeEventIndices, eventIndex)
 			}
 		}
 
-		// Remove all program change events, accounting for index shifting
+		// Remove all program change events, accounting for index shifting and keeping the timing of the next event
 		for i, eventIndex := range programChangeEventIndices {
 			adjustedIndex := eventIndex - i
+			if adjustedIndex+1 < len(tr) {
+				tr[adjustedIndex+1].Delta += tr[adjustedIndex].Delta
+			}
 			tr = slices.Delete(tr, adjustedIndex, adjustedIndex+1)
 		}
 
@@ -265,47 +226,3 @@ func (m Midi) ToBytes() ([]byte, error) {
 
 	return buffer.Bytes(), nil
 }
-
-func (m Midi) ToWav(soundFontPath string) (string, error) {
-	midFilePath := os.TempDir() + `\_.mid`
-	wavFilePath := os.TempDir() + `\_.wav`
-
-	m.SaveMidi(midFilePath)
-
-	cmd := exec.Command(
-		"fluidsynth",
-		"-ni",
-		soundFontPath,
-		midFilePath,
-		"-F", wavFilePath,
-		"-r 44100",
-	)
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return "", err
-	}
-
-	return wavFilePath, nil
-}
-
-func FilterTimestampsByCloseness(timestamps []float64, closenessThresholdMs int32) []float64 {
-	if closenessThresholdMs <= 0 || len(timestamps) == 0 {
-		return timestamps
-	}
-
-	closenessThresholdSec := float64(closenessThresholdMs) / 1000
-	filteredTimestamps := []float64{timestamps[0]}
-	lastAcceptedTime := timestamps[0]
-
-	for _, currentTimestamp := range timestamps[1:] {
-		if currentTimestamp-lastAcceptedTime >= closenessThresholdSec {
-			filteredTimestamps = append(filteredTimestamps, currentTimestamp)
-			lastAcceptedTime = currentTimestamp
-		}
-	}
-
-	return filteredTimestamps
-}
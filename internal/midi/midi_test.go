@@ -0,0 +1,134 @@
+package midi
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"ray_midi_sim/internal/audio"
+
+	gomidi "gitlab.com/gomidi/midi/v2"
+)
+
+func TestTrimByDuration(t *testing.T) {
+	runTransformTests(t, []transformTest{
+		{
+			// the notes starting right at the bound stay, released at once
+			name:  "events at the bound are kept",
+			apply: func(m *Midi) error { m.TrimByDuration(1, Selector{}); return nil },
+			wantNotes: []string{
+				"0:1/60 v100 @0+960", "1:10/36 v100 @0+240", "0:2/48 v80 @480+480", "0:1/120 v127 @960+0", "1:10/38 v90 @960+0",
+			},
+		},
+		{
+			name:      "notes sounding at the bound are released there",
+			apply:     func(m *Midi) error { m.TrimByDuration(0.75, Selector{}); return nil },
+			wantNotes: []string{"0:1/60 v100 @0+720", "1:10/36 v100 @0+240", "0:2/48 v80 @480+240"},
+		},
+		{
+			name:  "only the selected tracks",
+			apply: func(m *Midi) error { m.TrimByDuration(0.75, TrackSelector(1)); return nil },
+			wantNotes: []string{
+				"0:1/60 v100 @0+960", "1:10/36 v100 @0+240", "0:2/48 v80 @480+480", "0:1/120 v127 @960+480",
+			},
+		},
+		{
+			name:  "past the end nothing changes",
+			apply: func(m *Midi) error { m.TrimByDuration(5, Selector{}); return nil },
+			wantNotes: []string{
+				"0:1/60 v100 @0+960", "1:10/36 v100 @0+240", "0:2/48 v80 @480+480", "0:1/120 v127 @960+480", "1:10/38 v90 @960+240",
+			},
+		},
+	})
+}
+
+func TestTrimByDurationKeepsEventsAtTheBound(t *testing.T) {
+	m := testMidi(t, testTrack(1920,
+		on(0, 0, 60, 100),
+		testEvent{960, gomidi.ControlChange(0, 7, 80)},
+		testEvent{961, gomidi.ControlChange(0, 7, 90)},
+	))
+	m.TrimByDuration(1, Selector{})
+
+	ticks, messages := trackTicks(m.smf.Tracks[0])
+
+	// the volume change at the bound stays, the one a tick later goes, the note is released and the track ends at the bound
+	wantTicks := []int64{0, 960, 960, 960}
+	if !reflect.DeepEqual(ticks, wantTicks) {
+		t.Fatalf("got ticks %v, want %v", ticks, wantTicks)
+	}
+	var value uint8
+	if !messages[1].GetControlChange(nil, nil, &value) || value != 80 {
+		t.Errorf("got %v at the bound, want the volume change to 80", messages[1])
+	}
+	if !messages[2].GetNoteOff(nil, nil, nil) {
+		t.Errorf("got %v, want the note-off", messages[2])
+	}
+	if got := m.Duration(); got != 1 {
+		t.Errorf("got a duration of %v, want 1", got)
+	}
+}
+
+// firstSoundFrame returns the index of the first sample of the WAV file louder than silence, -1 if there is none
+func firstSoundFrame(t *testing.T, path string) int {
+	t.Helper()
+
+	pcm, err := audio.ReadWAV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, sample := range pcm.Samples {
+		if math.Abs(sample) > 1e-3 {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// TestSliceMatchesSliceWAV checks that the audio cut by SliceWAV lines up with the file cut by Slice over the same span
+func TestSliceMatchesSliceWAV(t *testing.T) {
+	const startSec, endSec = 0.5, 1.25
+
+	dir := t.TempDir()
+	synth := NewSoundFontSynth(loadTestSoundFont(t))
+	synth.SetSampleRate(22050)
+
+	m := testMidi(t, testTrack(1920, on(960, 0, 57, 100), off(1440, 0, 57)))
+	wavPath := filepath.Join(dir, "song.wav")
+	if err := synth.Synthesize(context.Background(), m, wavPath); err != nil {
+		t.Fatal(err)
+	}
+	slicedWAVPath := filepath.Join(dir, "sliced.wav")
+	if err := audio.SliceWAV(wavPath, slicedWAVPath, startSec, endSec); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Slice(startSec, endSec); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Duration(); got != endSec-startSec {
+		t.Errorf("got a duration of %v, want %v", got, endSec-startSec)
+	}
+	notes := m.ExtractNotes(Selector{})
+	if len(notes) != 1 || notes[0].Time != 0.5 {
+		t.Fatalf("got %+v, want the note at 0.5 s", notes)
+	}
+
+	resynthesizedPath := filepath.Join(dir, "resynthesized.wav")
+	if err := synth.Synthesize(context.Background(), m, resynthesizedPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sine starts at a zero crossing, so it is heard a few frames after the note-on
+	sliced, resynthesized := firstSoundFrame(t, slicedWAVPath), firstSoundFrame(t, resynthesizedPath)
+	if sliced != resynthesized {
+		t.Errorf("the sliced audio starts sounding at frame %d, the sliced file at frame %d", sliced, resynthesized)
+	}
+	if want := int(notes[0].Time * 22050); sliced < want || sliced > want+22 {
+		t.Errorf("the sliced audio starts sounding at frame %d, want within a millisecond after frame %d", sliced, want)
+	}
+}
@@ -0,0 +1,154 @@
+package midi
+
+import (
+	"cmp"
+	"slices"
+
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+// Note is a single note of the MIDI file, the note-on combined with its matching note-off
+type Note struct {
+	Time     float64 // start in seconds
+	Duration float64 // seconds until the note-off, or until the end of the track for notes that are never released
+	Pitch    uint8
+	Velocity uint8
+	Channel  uint8
+	Program  uint8 // GM program of the channel when the note starts
+	Track    int
+}
+
+func (n Note) End() float64 {
+	return n.Time + n.Duration
+}
+
+// ExtractNotes returns the notes picked by the selector sorted by their start time, paired up by trackNotes
+func (m Midi) ExtractNotes(selector Selector) []Note {
+	var notes []Note
+
+	tempoMap := m.TempoMap()
+	programChanges := m.programChanges()
+
+	for trIdx, tr := range m.smf.Tracks {
+		if !selector.matchesTrack(trIdx, m.TrackName(trIdx)) {
+			continue
+		}
+
+		events := absoluteEvents(tr)
+		trackEndSec := tempoMap.TickToSeconds(float64(trackEndTick(tr)))
+
+		for _, note := range trackNotes(tr, trIdx, programChanges) {
+			if !selector.matchesNote(note.Note) {
+				continue
+			}
+
+			// notes that are never released last until the end of the track
+			endSec := trackEndSec
+			if note.off >= 0 {
+				endSec = tempoMap.TickToSeconds(float64(events[note.off].tick))
+			}
+
+			note.Time = tempoMap.TickToSeconds(float64(events[note.on].tick))
+			note.Duration = endSec - note.Time
+			notes = append(notes, note.Note)
+		}
+	}
+
+	slices.SortStableFunc(notes, func(a, b Note) int {
+		return cmp.Compare(a.Time, b.Time)
+	})
+
+	return notes
+}
+
+// trackNote is a note of a track by the indexes of its events, Time and Duration are not set
+type trackNote struct {
+	Note
+	on  int
+	off int // -1 for a note that is never released
+}
+
+// trackNotes pairs the note-ons and note-offs of the track in the order of the note-ons. A note-off ends the earliest
+// note still sounding with the same channel and pitch, a note-on with velocity 0 counts as a note-off.
+func trackNotes(tr smf.Track, trackIndex int, programChanges map[uint8][]programChange) []trackNote {
+	var (
+		notes    []trackNote
+		absTicks int64
+	)
+
+	// indexes into notes of the notes still sounding, keyed by channel and pitch
+	sounding := make(map[[2]uint8][]int)
+
+	for i, ev := range tr {
+		absTicks += int64(ev.Delta)
+
+		var channel, pitch, velocity uint8
+
+		switch {
+		case ev.Message.GetNoteStart(&channel, &pitch, &velocity):
+			key := [2]uint8{channel, pitch}
+			sounding[key] = append(sounding[key], len(notes))
+
+			notes = append(notes, trackNote{
+				Note: Note{
+					Pitch:    pitch,
+					Velocity: velocity,
+					Channel:  channel,
+					Program:  programAt(programChanges[channel], absTicks),
+					Track:    trackIndex,
+				},
+				on:  i,
+				off: -1,
+			})
+
+		case ev.Message.GetNoteEnd(&channel, &pitch):
+			key := [2]uint8{channel, pitch}
+			if len(sounding[key]) == 0 {
+				continue
+			}
+
+			notes[sounding[key][0]].off = i
+			sounding[key] = sounding[key][1:]
+		}
+	}
+
+	return notes
+}
+
+// NoteGroup is the set of notes that start together, like a chord
+type NoteGroup struct {
+	Time  float64 // start of the earliest note of the group
+	Notes []Note
+}
+
+// GroupOnsets groups the notes, sorted by their start time, into one group per onset. A note joins the current
+// group if it starts within toleranceSec of the first note of the group, so groups never span more than the tolerance.
+func GroupOnsets(notes []Note, toleranceSec float64) []NoteGroup {
+	var groups []NoteGroup
+
+	for _, note := range notes {
+		if len(groups) > 0 && note.Time-groups[len(groups)-1].Time <= toleranceSec {
+			groups[len(groups)-1].Notes = append(groups[len(groups)-1].Notes, note)
+			continue
+		}
+
+		groups = append(groups, NoteGroup{Time: note.Time, Notes: []Note{note}})
+	}
+
+	return groups
+}
+
+// ExtractNoteGroups returns the notes picked by the selector grouped by their onset, across all selected tracks
+func (m Midi) ExtractNoteGroups(selector Selector, toleranceSec float64) []NoteGroup {
+	return GroupOnsets(m.ExtractNotes(selector), toleranceSec)
+}
+
+// OnsetTimes returns the start time of every group, the timestamps a map is generated from
+func OnsetTimes(groups []NoteGroup) []float64 {
+	timestamps := make([]float64, len(groups))
+	for i, group := range groups {
+		timestamps[i] = group.Time
+	}
+
+	return timestamps
+}
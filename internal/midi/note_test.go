@@ -0,0 +1,210 @@
+package midi
+
+import (
+	"reflect"
+	"testing"
+
+	gomidi "gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+// testTicksPerQuarter at the default 120 bpm makes a tick 1/960 of a second
+const testTicksPerQuarter = 480
+
+type testEvent struct {
+	tick    uint32 // absolute, the events of a track are in tick order
+	message []byte
+}
+
+func testTrack(endTick uint32, events ...testEvent) smf.Track {
+	var (
+		tr   smf.Track
+		tick uint32
+	)
+
+	for _, ev := range events {
+		tr.Add(ev.tick-tick, ev.message)
+		tick = ev.tick
+	}
+	tr.Close(endTick - tick)
+
+	return tr
+}
+
+func testMidi(t testing.TB, tracks ...smf.Track) Midi {
+	t.Helper()
+
+	s := smf.NewSMF1()
+	s.TimeFormat = smf.MetricTicks(testTicksPerQuarter)
+
+	for _, tr := range tracks {
+		if err := s.Add(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return Midi{smf: *s}
+}
+
+func on(tick uint32, channel, pitch, velocity uint8) testEvent {
+	return testEvent{tick, gomidi.NoteOn(channel, pitch, velocity)}
+}
+
+func off(tick uint32, channel, pitch uint8) testEvent {
+	return testEvent{tick, gomidi.NoteOff(channel, pitch)}
+}
+
+func TestExtractNotes(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []testEvent
+		want   []Note
+	}{
+		{
+			name:   "note-on and note-off",
+			events: []testEvent{on(0, 0, 60, 100), off(480, 0, 60)},
+			want:   []Note{{Time: 0, Duration: 0.5, Pitch: 60, Velocity: 100}},
+		},
+		{
+			name:   "note-on with velocity 0 ends the note",
+			events: []testEvent{on(480, 1, 64, 90), on(960, 1, 64, 0)},
+			want:   []Note{{Time: 0.5, Duration: 0.5, Pitch: 64, Velocity: 90, Channel: 1}},
+		},
+		{
+			name: "overlapping notes of the same pitch end in the order they started",
+			events: []testEvent{
+				on(0, 0, 60, 100),
+				on(240, 0, 60, 80),
+				off(480, 0, 60),
+				off(960, 0, 60),
+			},
+			want: []Note{
+				{Time: 0, Duration: 0.5, Pitch: 60, Velocity: 100},
+				{Time: 0.25, Duration: 0.75, Pitch: 60, Velocity: 80},
+			},
+		},
+		{
+			name: "a note-off only ends a note of its channel",
+			events: []testEvent{
+				on(0, 0, 60, 100),
+				on(0, 2, 60, 100),
+				off(480, 2, 60),
+				off(960, 0, 60),
+			},
+			want: []Note{
+				{Time: 0, Duration: 1, Pitch: 60, Velocity: 100},
+				{Time: 0, Duration: 0.5, Pitch: 60, Velocity: 100, Channel: 2},
+			},
+		},
+		{
+			name:   "a note that is never released lasts until the end of the track",
+			events: []testEvent{on(960, 0, 60, 100)},
+			want:   []Note{{Time: 1, Duration: 1, Pitch: 60, Velocity: 100}},
+		},
+		{
+			name:   "a note-off without a note is ignored",
+			events: []testEvent{off(0, 0, 60), on(480, 0, 60, 100), off(960, 0, 60)},
+			want:   []Note{{Time: 0.5, Duration: 0.5, Pitch: 60, Velocity: 100}},
+		},
+		{
+			name: "the program is the one of the channel when the note starts",
+			events: []testEvent{
+				{0, gomidi.ProgramChange(0, 24)},
+				on(0, 0, 60, 100),
+				{480, gomidi.ProgramChange(0, 40)},
+				on(480, 0, 62, 100),
+				off(960, 0, 60),
+				off(960, 0, 62),
+			},
+			want: []Note{
+				{Time: 0, Duration: 1, Pitch: 60, Velocity: 100, Program: 24},
+				{Time: 0.5, Duration: 0.5, Pitch: 62, Velocity: 100, Program: 40},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMidi(t, testTrack(1920, tt.events...))
+
+			if got := m.ExtractNotes(Selector{}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractNotesAcrossTracks(t *testing.T) {
+	m := testMidi(t,
+		testTrack(1920, on(480, 0, 60, 100), off(960, 0, 60)),
+		testTrack(1920, on(0, 1, 48, 100), off(960, 1, 48), on(960, 1, 50, 100), off(1440, 1, 50)),
+	)
+
+	want := []Note{
+		{Time: 0, Duration: 1, Pitch: 48, Velocity: 100, Channel: 1, Track: 1},
+		{Time: 0.5, Duration: 0.5, Pitch: 60, Velocity: 100, Track: 0},
+		{Time: 1, Duration: 0.5, Pitch: 50, Velocity: 100, Channel: 1, Track: 1},
+	}
+	if got := m.ExtractNotes(Selector{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got := m.ExtractNotes(TrackSelector(0)); !reflect.DeepEqual(got, want[1:2]) {
+		t.Errorf("track 0: got %+v, want %+v", got, want[1:2])
+	}
+}
+
+func TestGroupOnsets(t *testing.T) {
+	notes := func(times ...float64) []Note {
+		var notes []Note
+		for _, time := range times {
+			notes = append(notes, Note{Time: time})
+		}
+		return notes
+	}
+
+	tests := []struct {
+		name      string
+		times     []float64
+		tolerance float64
+		want      [][]float64 // the start times of the notes of each group
+	}{
+		{"no notes", nil, 0.03, nil},
+		{"zero tolerance only groups equal times", []float64{0, 0, 0.01, 0.5}, 0, [][]float64{{0, 0}, {0.01}, {0.5}}},
+		{"notes within the tolerance make a chord", []float64{1, 1.01, 1.02, 2}, 0.03, [][]float64{{1, 1.01, 1.02}, {2}}},
+		{"a note exactly at the tolerance joins the group", []float64{1, 1.25}, 0.25, [][]float64{{1, 1.25}}},
+		{"a note just past the tolerance starts a new group", []float64{1, 1.2500001}, 0.25, [][]float64{{1}, {1.2500001}}},
+		// measured from the first note of the group, a chain of close notes does not grow the group past the tolerance
+		{"groups never span more than the tolerance", []float64{0, 0.02, 0.04, 0.06}, 0.03, [][]float64{{0, 0.02}, {0.04, 0.06}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := GroupOnsets(notes(tt.times...), tt.tolerance)
+
+			var got [][]float64
+			for _, group := range groups {
+				if group.Time != group.Notes[0].Time {
+					t.Errorf("group time %v is not the time of its first note %v", group.Time, group.Notes[0].Time)
+				}
+
+				var times []float64
+				for _, note := range group.Notes {
+					times = append(times, note.Time)
+				}
+				got = append(got, times)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			onsets := OnsetTimes(groups)
+			for i, group := range groups {
+				if onsets[i] != group.Time {
+					t.Errorf("onset %d: got %v, want %v", i, onsets[i], group.Time)
+				}
+			}
+		})
+	}
+}
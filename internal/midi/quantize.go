@@ -0,0 +1,241 @@
+package midi
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+var ErrInvalidTransform = errors.New("invalid transform")
+
+// Grid is the set of positions Quantize moves notes to, it restarts at every time signature
+type Grid struct {
+	Division int     // grid lines per whole note, 16 for sixteenths
+	Triplet  bool    // three lines in the time of two
+	Swing    float64 // delays every second line by this fraction of a step, 1/3 swings straight lines into triplets
+}
+
+// ParseGrid parses a note value like "1/16", or "1/8t" for triplets
+func ParseGrid(s string) (Grid, error) {
+	var grid Grid
+
+	value := strings.ToLower(strings.TrimSpace(s))
+	value, grid.Triplet = strings.CutSuffix(value, "t")
+
+	division, err := strconv.Atoi(strings.TrimPrefix(value, "1/"))
+	if err != nil || !strings.HasPrefix(value, "1/") {
+		return Grid{}, fmt.Errorf("%w: grid %q, expected a note value like 1/16 or 1/8t", ErrInvalidTransform, s)
+	}
+	grid.Division = division
+
+	return grid, grid.validate()
+}
+
+func (g Grid) validate() error {
+	if g.Division <= 0 {
+		return fmt.Errorf("%w: grid division %d", ErrInvalidTransform, g.Division)
+	}
+	if g.Swing < 0 || g.Swing >= 1 {
+		return fmt.Errorf("%w: swing %v, expected at least 0 and less than 1", ErrInvalidTransform, g.Swing)
+	}
+
+	return nil
+}
+
+// GridTick returns the grid line nearest to the tick
+func (t TempoMap) GridTick(tick float64, grid Grid) float64 {
+	step := t.ticksPerQuarter * 4 / float64(grid.Division)
+	if grid.Triplet {
+		step = step * 2 / 3
+	}
+
+	// grid lines come in pairs, the second one of each pair is delayed by the swing
+	ts := t.timeSignatureAtTick(tick)
+	pairStart := float64(ts.Tick) + math.Floor((tick-float64(ts.Tick))/(2*step))*2*step
+
+	nearest := pairStart
+	for _, line := range []float64{pairStart + step*(1+grid.Swing), pairStart + 2*step} {
+		if math.Abs(line-tick) < math.Abs(nearest-tick) {
+			nearest = line
+		}
+	}
+
+	return nearest
+}
+
+// Quantize moves the starts of the notes picked by the selector towards the nearest grid line, by the strength
+// between 0 (not at all) and 1 (onto the line). See moveNotes for what happens to the other events.
+func (m *Midi) Quantize(grid Grid, strength float64, selector Selector) error {
+	if err := grid.validate(); err != nil {
+		return err
+	}
+	if err := validateStrength(strength); err != nil {
+		return err
+	}
+
+	tempoMap := m.TempoMap()
+
+	m.moveNotes(selector, func(note Note, tick int64) (int64, uint8) {
+		target := tempoMap.GridTick(float64(tick), grid)
+		return int64(math.Round(float64(tick) + strength*(target-float64(tick)))), note.Velocity
+	})
+
+	return nil
+}
+
+func validateStrength(strength float64) error {
+	if strength < 0 || strength > 1 {
+		return fmt.Errorf("%w: quantize strength %v, expected 0 to 1", ErrInvalidTransform, strength)
+	}
+
+	return nil
+}
+
+// Humanization is the random variation Humanize adds to the notes
+type Humanization struct {
+	TimingSec float64 // note starts move by up to this much either way
+	Velocity  int     // velocities change by up to this much either way
+	Seed      uint64  // the same seed always gives the same variation
+}
+
+func (h Humanization) validate() error {
+	if h.TimingSec < 0 || h.Velocity < 0 {
+		return fmt.Errorf("%w: negative humanization %+v", ErrInvalidTransform, h)
+	}
+
+	return nil
+}
+
+// Humanize moves the starts and changes the velocities of the notes picked by the selector at random,
+// notes never move before the start of the file. See moveNotes for what happens to the other events.
+func (m *Midi) Humanize(humanization Humanization, selector Selector) error {
+	if err := humanization.validate(); err != nil {
+		return err
+	}
+
+	tempoMap := m.TempoMap()
+	rng := rand.New(rand.NewPCG(humanization.Seed, 0))
+
+	m.moveNotes(selector, func(note Note, tick int64) (int64, uint8) {
+		sec := tempoMap.TickToSeconds(float64(tick)) + (rng.Float64()*2-1)*humanization.TimingSec
+		velocity := int(note.Velocity) + rng.IntN(2*humanization.Velocity+1) - humanization.Velocity
+
+		return int64(math.Round(tempoMap.SecondsToTick(max(0, sec)))), uint8(max(1, min(127, velocity)))
+	})
+
+	return nil
+}
+
+// movedEvent is an event of a track while moveNotes works on it
+type movedEvent struct {
+	smf.Event
+	tick    int64
+	newTick int64
+	rank    int // orders events sharing a tick: note-offs of earlier notes, then the rest as they were, then the end of track
+}
+
+// moveNotes lets move pick the new tick and velocity of every note-on picked by the selector. The note-off of a
+// moved note moves by as much, but never past the next note-on with the same channel and pitch and never onto or
+// before its own note-on. Controller and program changes sent on the channel of a note right before it at the same
+// tick move with it. All other events keep their tick.
+func (m *Midi) moveNotes(selector Selector, move func(note Note, tick int64) (int64, uint8)) {
+	programChanges := m.programChanges()
+
+	for trIdx, tr := range m.smf.Tracks {
+		if !selector.matchesTrack(trIdx, m.TrackName(trIdx)) {
+			continue
+		}
+
+		events := make([]movedEvent, len(tr))
+		var absTicks int64
+		for i, ev := range tr {
+			absTicks += int64(ev.Delta)
+			events[i] = movedEvent{Event: ev, tick: absTicks, newTick: absTicks, rank: 1}
+		}
+
+		moved := make([]bool, len(events))
+		notes := trackNotes(tr, trIdx, programChanges)
+
+		for _, note := range notes {
+			if !selector.matchesNote(note.Note) {
+				continue
+			}
+
+			i, tick := note.on, events[note.on].tick
+
+			newTick, newVelocity := move(note.Note, tick)
+			events[i].newTick = max(0, newTick)
+			events[i].Message = withData(events[i].Message, 2, newVelocity)
+			moved[i] = true
+
+			for j := i - 1; j >= 0 && events[j].tick == tick; j-- {
+				var channel uint8
+				isSetup := events[j].Message.GetControlChange(&channel, nil, nil) || events[j].Message.GetProgramChange(&channel, nil)
+				if isSetup && !moved[j] && channel == note.Channel {
+					events[j].newTick = events[i].newTick
+					moved[j] = true
+				}
+			}
+		}
+
+		// the next note-on with the same channel and pitch of every note-on
+		nextNoteOns := make(map[int]int)
+		lastNoteOns := make(map[[2]uint8]int)
+		for _, note := range notes {
+			key := [2]uint8{note.Channel, note.Pitch}
+			if last, ok := lastNoteOns[key]; ok {
+				nextNoteOns[last] = note.on
+			}
+			lastNoteOns[key] = note.on
+		}
+
+		for _, note := range notes {
+			on, off := note.on, note.off
+			if off < 0 {
+				continue
+			}
+
+			end := events[off].tick + events[on].newTick - events[on].tick
+			if next, ok := nextNoteOns[on]; ok {
+				end = min(end, events[next].newTick)
+			}
+			if events[off].tick > events[on].tick {
+				end = max(end, events[on].newTick+1)
+				events[off].rank = 0
+			}
+
+			events[off].newTick = max(end, events[on].newTick)
+		}
+
+		// the end of track stays behind everything else
+		var lastTick int64
+		for _, ev := range events {
+			lastTick = max(lastTick, ev.newTick)
+		}
+		for i, ev := range events {
+			if ev.Message.Type() == smf.MetaEndOfTrackMsg {
+				events[i].newTick, events[i].rank = lastTick, 2
+			}
+		}
+
+		slices.SortStableFunc(events, func(a, b movedEvent) int {
+			return cmp.Or(cmp.Compare(a.newTick, b.newTick), cmp.Compare(a.rank, b.rank))
+		})
+
+		newTrack := make(smf.Track, len(events))
+		var previousTick int64
+		for i, ev := range events {
+			newTrack[i] = smf.Event{Delta: uint32(ev.newTick - previousTick), Message: ev.Message}
+			previousTick = ev.newTick
+		}
+
+		m.smf.Tracks[trIdx] = newTrack
+	}
+}
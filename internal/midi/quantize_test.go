@@ -0,0 +1,240 @@
+package midi
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"slices"
+	"testing"
+
+	gomidi "gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+// trackTicks returns the absolute tick of every event of the track, with the events
+func trackTicks(tr smf.Track) ([]int64, []smf.Message) {
+	var (
+		ticks    []int64
+		messages []smf.Message
+		absTicks int64
+	)
+
+	for _, ev := range tr {
+		absTicks += int64(ev.Delta)
+		ticks = append(ticks, absTicks)
+		messages = append(messages, ev.Message)
+	}
+
+	return ticks, messages
+}
+
+// checkTrackTicks fails if the track has a delta that wrapped around from a negative one
+func checkTrackTicks(t *testing.T, m Midi) {
+	t.Helper()
+
+	for trIdx, tr := range m.smf.Tracks {
+		for i, ev := range tr {
+			if ev.Delta > 1<<30 {
+				t.Errorf("track %d event %d: delta %d wrapped around", trIdx, i, ev.Delta)
+			}
+		}
+	}
+}
+
+// roundNotes rounds the times of the notes to whole ticks of testMidi, so they compare equal
+func roundNotes(notes []Note) []Note {
+	rounded := slices.Clone(notes)
+	for i := range rounded {
+		rounded[i].Time = math.Round(rounded[i].Time*960) / 960
+		rounded[i].Duration = math.Round(rounded[i].Duration*960) / 960
+	}
+
+	return rounded
+}
+
+func TestParseGrid(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Grid
+	}{
+		{"1/16", Grid{Division: 16}},
+		{"1/8t", Grid{Division: 8, Triplet: true}},
+		{" 1/4T ", Grid{Division: 4, Triplet: true}},
+	}
+	for _, tt := range tests {
+		if got, err := ParseGrid(tt.s); err != nil || got != tt.want {
+			t.Errorf("%q: got %+v, %v, want %+v", tt.s, got, err, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", "16", "1/0", "1/-4", "1/x", "2/16"} {
+		if _, err := ParseGrid(s); !errors.Is(err, ErrInvalidTransform) {
+			t.Errorf("%q: got %v, want ErrInvalidTransform", s, err)
+		}
+	}
+}
+
+func TestGridTick(t *testing.T) {
+	tempoMap := testMidi(t, testTrack(1920)).TempoMap()
+
+	tests := []struct {
+		grid       Grid
+		tick, want float64
+	}{
+		{Grid{Division: 8}, 0, 0},
+		{Grid{Division: 8}, 119, 0},
+		{Grid{Division: 8}, 121, 240},
+		{Grid{Division: 8}, 470, 480},
+		{Grid{Division: 8, Triplet: true}, 170, 160},
+		{Grid{Division: 8, Triplet: true}, 300, 320},
+		// the second line of each pair moves from 240 to 320
+		{Grid{Division: 8, Swing: 1.0 / 3}, 300, 320},
+		{Grid{Division: 8, Swing: 1.0 / 3}, 150, 0},
+		{Grid{Division: 8, Swing: 1.0 / 3}, 170, 320},
+	}
+
+	for _, tt := range tests {
+		if got := tempoMap.GridTick(tt.tick, tt.grid); got != tt.want {
+			t.Errorf("%+v tick %v: got %v, want %v", tt.grid, tt.tick, got, tt.want)
+		}
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   []testEvent
+		strength float64
+		want     []Note
+	}{
+		{
+			name:     "note-offs move with their notes",
+			events:   []testEvent{on(250, 0, 60, 100), off(730, 0, 60), on(1190, 0, 62, 100), off(1300, 0, 62)},
+			strength: 1,
+			want: []Note{
+				{Time: 0.25, Duration: 0.5, Pitch: 60, Velocity: 100},
+				{Time: 1.25, Duration: 110.0 / 960, Pitch: 62, Velocity: 100},
+			},
+		},
+		{
+			name:     "half strength moves half way",
+			events:   []testEvent{on(280, 0, 60, 100), off(760, 0, 60)},
+			strength: 0.5,
+			want:     []Note{{Time: 260.0 / 960, Duration: 0.5, Pitch: 60, Velocity: 100}},
+		},
+		{
+			name:     "a note-off never moves past the next note of the same pitch",
+			events:   []testEvent{on(200, 0, 60, 100), off(460, 0, 60), on(470, 0, 60, 90), off(700, 0, 60)},
+			strength: 1,
+			want: []Note{
+				{Time: 0.25, Duration: 0.25, Pitch: 60, Velocity: 100},
+				{Time: 0.5, Duration: 230.0 / 960, Pitch: 60, Velocity: 90},
+			},
+		},
+		{
+			name:     "a note moved onto its note-off keeps a tick of length",
+			events:   []testEvent{on(100, 0, 60, 100), off(110, 0, 60)},
+			strength: 1,
+			want:     []Note{{Time: 0, Duration: 10.0 / 960, Pitch: 60, Velocity: 100}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMidi(t, testTrack(1920, tt.events...))
+			if err := m.Quantize(Grid{Division: 8}, tt.strength, Selector{}); err != nil {
+				t.Fatal(err)
+			}
+
+			checkTrackTicks(t, m)
+			if got := roundNotes(m.ExtractNotes(Selector{})); !reflect.DeepEqual(got, roundNotes(tt.want)) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantizeMovesProgramChanges(t *testing.T) {
+	m := testMidi(t, testTrack(1920,
+		testEvent{250, gomidi.ProgramChange(0, 5)},
+		on(250, 0, 60, 100),
+		testEvent{260, gomidi.ControlChange(0, 7, 80)},
+		off(730, 0, 60),
+	))
+	if err := m.Quantize(Grid{Division: 8}, 1, Selector{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ticks, messages := trackTicks(m.smf.Tracks[0])
+
+	// the program change goes along with its note, the later volume change stays where it was
+	wantTicks := []int64{240, 240, 260, 720, 1920}
+	if !reflect.DeepEqual(ticks, wantTicks) {
+		t.Fatalf("got ticks %v, want %v", ticks, wantTicks)
+	}
+	if !messages[0].GetProgramChange(nil, nil) {
+		t.Errorf("got %v first, want the program change", messages[0])
+	}
+}
+
+func TestQuantizeInvalid(t *testing.T) {
+	m := testMidi(t, testTrack(1920))
+
+	for _, err := range []error{
+		m.Quantize(Grid{}, 1, Selector{}),
+		m.Quantize(Grid{Division: 8, Swing: 1}, 1, Selector{}),
+		m.Quantize(Grid{Division: 8}, 1.5, Selector{}),
+		m.Humanize(Humanization{TimingSec: -1}, Selector{}),
+	} {
+		if !errors.Is(err, ErrInvalidTransform) {
+			t.Errorf("got %v, want ErrInvalidTransform", err)
+		}
+	}
+}
+
+func TestHumanize(t *testing.T) {
+	events := []testEvent{
+		on(0, 0, 60, 120), off(480, 0, 60),
+		on(480, 0, 62, 5), off(960, 0, 62),
+		on(960, 1, 64, 64), off(1440, 1, 64),
+	}
+	humanization := Humanization{TimingSec: 0.1, Velocity: 20, Seed: 7}
+
+	humanize := func() Midi {
+		m := testMidi(t, testTrack(1920, events...))
+		if err := m.Humanize(humanization, Selector{Channels: []uint8{0}}); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	m := humanize()
+	checkTrackTicks(t, m)
+
+	notes := m.ExtractNotes(Selector{})
+	if len(notes) != 3 {
+		t.Fatalf("got %d notes, want 3", len(notes))
+	}
+
+	for _, note := range notes {
+		if note.Time < 0 {
+			t.Errorf("note %d starts before the file at %v", note.Pitch, note.Time)
+		}
+		// the note-off moves with the note, ticks are rounded on the way
+		if note.Channel == 0 && (note.Duration < 0.5-1.0/960 || note.Duration > 0.5+1.0/960) {
+			t.Errorf("note %d: got a duration of %v, want 0.5", note.Pitch, note.Duration)
+		}
+		if note.Velocity < 1 || note.Velocity > 127 {
+			t.Errorf("note %d: velocity %d", note.Pitch, note.Velocity)
+		}
+	}
+
+	// channel 1 is not selected
+	if last := notes[2]; last.Channel != 1 || last.Time != 1 || last.Velocity != 64 {
+		t.Errorf("got %+v, want the note of channel 1 untouched", last)
+	}
+
+	if !reflect.DeepEqual(humanize().ExtractNotes(Selector{}), notes) {
+		t.Error("the same seed gave a different result")
+	}
+}
@@ -0,0 +1,331 @@
+package midi
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2/gm"
+)
+
+var ErrInvalidSelector = errors.New("invalid selector")
+
+// DrumChannel is the zero based channel General MIDI plays percussion on, channel 10 to musicians
+const DrumChannel = 9
+
+// maxTrackIndex is the last track an SMF header can count, the range a selector expands stays this small
+const maxTrackIndex = 1<<16 - 2
+
+// DrumKeyNames maps the names a selector accepts for drum keys to the General MIDI percussion keys
+var DrumKeyNames = map[string][]uint8{
+	"kick":         {gm.DrumKey_AcousticBassDrum.Key(), gm.DrumKey_BassDrum1.Key()},
+	"snare":        {gm.DrumKey_AcousticSnare.Key(), gm.DrumKey_ElectricSnare.Key()},
+	"sidestick":    {gm.DrumKey_SideStick.Key()},
+	"clap":         {gm.DrumKey_HandClap.Key()},
+	"hihat":        {gm.DrumKey_ClosedHiHat.Key(), gm.DrumKey_PedalHiHat.Key(), gm.DrumKey_OpenHiHat.Key()},
+	"closed-hihat": {gm.DrumKey_ClosedHiHat.Key()},
+	"pedal-hihat":  {gm.DrumKey_PedalHiHat.Key()},
+	"open-hihat":   {gm.DrumKey_OpenHiHat.Key()},
+	"tom": {
+		gm.DrumKey_LowFloorTom.Key(), gm.DrumKey_HighFloorTom.Key(), gm.DrumKey_LowTom.Key(),
+		gm.DrumKey_LowMidTom.Key(), gm.DrumKey_HiMidTom.Key(), gm.DrumKey_HighTom.Key(),
+	},
+	"crash":      {gm.DrumKey_CrashCymbal1.Key(), gm.DrumKey_CrashCymbal2.Key()},
+	"ride":       {gm.DrumKey_RideCymbal1.Key(), gm.DrumKey_RideCymbal2.Key()},
+	"ride-bell":  {gm.DrumKey_RideBell.Key()},
+	"china":      {gm.DrumKey_ChineseCymbal.Key()},
+	"splash":     {gm.DrumKey_SplashCymbal.Key()},
+	"tambourine": {gm.DrumKey_Tambourine.Key()},
+	"cowbell":    {gm.DrumKey_Cowbell.Key()},
+}
+
+// Selector picks tracks and notes, the zero value selects everything. Every field that is set has to match.
+type Selector struct {
+	Tracks      []int    // track indexes, all tracks if empty
+	TrackNames  []string // a track matches if its name contains one of these, ignoring case
+	Channels    []uint8  // MIDI channels 0-15, all channels if empty
+	Programs    []uint8  // GM programs 0-127 of the channel at the start of the note, never drums, all programs if empty
+	Pitches     []uint8  // note numbers 0-127, all pitches if empty
+	MinVelocity uint8
+	DrumKeys    []uint8 // keys on the drum channel, notes on other channels do not match if set
+}
+
+// TrackSelector selects every note of the given tracks, all tracks if none are given
+func TrackSelector(trackIndexes ...int) Selector {
+	return Selector{Tracks: trackIndexes}
+}
+
+// ParseSelector parses a selector written as clauses separated by semicolons, like "name=drums;drum=kick,snare".
+// A clause is a key and comma separated values, numbers can be ranges like 36-48:
+//
+//	track=0,2        track indexes
+//	name=piano       text contained in the track name
+//	channel=10       channels 1-16, as musicians count them
+//	program=1-8,bass GM programs 1-128 or text contained in the GM instrument name
+//	pitch=36-60,72   note numbers 0-127
+//	velocity=64      lowest velocity
+//	drum=kick,38     drum keys by name or note number, see DrumKeyNames
+//
+// An empty string selects everything.
+func ParseSelector(s string) (Selector, error) {
+	var selector Selector
+
+	for _, clause := range strings.Split(s, ";") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(clause, "=")
+		if !ok {
+			return Selector{}, fmt.Errorf("%w: %q is not key=value", ErrInvalidSelector, clause)
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		var err error
+
+		switch key {
+		case "track":
+			err = parseRanges(value, 0, maxTrackIndex, 0, func(n int) { selector.Tracks = append(selector.Tracks, n) })
+		case "name":
+			for _, name := range strings.Split(value, ",") {
+				selector.TrackNames = append(selector.TrackNames, strings.TrimSpace(name))
+			}
+		case "channel":
+			err = parseRanges(value, 1, 16, 1, func(n int) { selector.Channels = append(selector.Channels, uint8(n)) })
+		case "program":
+			err = parsePrograms(value, &selector.Programs)
+		case "pitch":
+			err = parseRanges(value, 0, 127, 0, func(n int) { selector.Pitches = append(selector.Pitches, uint8(n)) })
+		case "velocity":
+			var velocity int
+			velocity, err = strconv.Atoi(value)
+			if err != nil || velocity < 0 || velocity > 127 {
+				err = fmt.Errorf("%w: velocity %q, expected 0-127", ErrInvalidSelector, value)
+			}
+			selector.MinVelocity = uint8(velocity)
+		case "drum":
+			err = parseDrumKeys(value, &selector.DrumKeys)
+		default:
+			err = fmt.Errorf("%w: unknown key %q", ErrInvalidSelector, key)
+		}
+
+		if err != nil {
+			return Selector{}, err
+		}
+	}
+
+	return selector, nil
+}
+
+// parseRanges calls add for every number of a comma separated list of numbers and ranges between lo and hi,
+// offset is subtracted from each of them
+func parseRanges(value string, lo, hi, offset int, add func(int)) error {
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+
+		first, last, isRange := strings.Cut(field, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(first))
+		to := from
+		if err == nil && isRange {
+			to, err = strconv.Atoi(strings.TrimSpace(last))
+		}
+
+		if err != nil || from < lo || to > hi || from > to {
+			return fmt.Errorf("%w: %q, expected numbers or ranges between %d and %d", ErrInvalidSelector, field, lo, hi)
+		}
+
+		for n := from; n <= to; n++ {
+			add(n - offset)
+		}
+	}
+
+	return nil
+}
+
+func parsePrograms(value string, programs *[]uint8) error {
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+
+		if field != "" && (field[0] < '0' || field[0] > '9') {
+			before := len(*programs)
+			for program := range 128 {
+				if strings.Contains(strings.ToLower(gm.Instr(program).String()), strings.ToLower(field)) {
+					*programs = append(*programs, uint8(program))
+				}
+			}
+			if len(*programs) == before {
+				return fmt.Errorf("%w: no GM instrument is named like %q", ErrInvalidSelector, field)
+			}
+			continue
+		}
+
+		err := parseRanges(field, 1, 128, 1, func(n int) { *programs = append(*programs, uint8(n)) })
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseDrumKeys(value string, keys *[]uint8) error {
+	for _, field := range strings.Split(value, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+
+		if named, ok := DrumKeyNames[field]; ok {
+			*keys = append(*keys, named...)
+			continue
+		}
+
+		key, err := strconv.Atoi(field)
+		if err != nil || key < 0 || key > 127 {
+			return fmt.Errorf("%w: unknown drum %q", ErrInvalidSelector, field)
+		}
+		*keys = append(*keys, uint8(key))
+	}
+
+	return nil
+}
+
+// isEmpty reports whether the selector is the zero value, which selects everything
+func (s Selector) isEmpty() bool {
+	return len(s.Tracks) == 0 && len(s.TrackNames) == 0 && !s.hasNoteFilter()
+}
+
+// hasNoteFilter reports whether the selector looks at the notes, not only at the tracks
+func (s Selector) hasNoteFilter() bool {
+	return len(s.Channels) > 0 || len(s.Programs) > 0 || len(s.Pitches) > 0 || s.MinVelocity > 0 || len(s.DrumKeys) > 0
+}
+
+func (s Selector) matchesTrack(trackIndex int, name string) bool {
+	if len(s.Tracks) > 0 && !slices.Contains(s.Tracks, trackIndex) {
+		return false
+	}
+
+	if len(s.TrackNames) == 0 {
+		return true
+	}
+
+	name = strings.ToLower(name)
+	return slices.ContainsFunc(s.TrackNames, func(part string) bool {
+		return strings.Contains(name, strings.ToLower(part))
+	})
+}
+
+func (s Selector) matchesChannel(channel uint8) bool {
+	return len(s.Channels) == 0 || slices.Contains(s.Channels, channel)
+}
+
+func (s Selector) matchesNote(note Note) bool {
+	switch {
+	case !s.matchesChannel(note.Channel):
+		return false
+	case len(s.Programs) > 0 && (note.Channel == DrumChannel || !slices.Contains(s.Programs, note.Program)):
+		return false
+	case len(s.Pitches) > 0 && !slices.Contains(s.Pitches, note.Pitch):
+		return false
+	case note.Velocity < s.MinVelocity:
+		return false
+	case len(s.DrumKeys) > 0 && (note.Channel != DrumChannel || !slices.Contains(s.DrumKeys, note.Pitch)):
+		return false
+	default:
+		return true
+	}
+}
+
+// TrackName returns the text of the first track name meta event of the track, or an empty string
+func (m Midi) TrackName(trackIndex int) string {
+	var name string
+
+	for _, ev := range m.smf.Tracks[trackIndex] {
+		if ev.Message.GetMetaTrackName(&name) {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// SelectTracks returns the indexes of the tracks the selector picks. A selector looking at the notes
+// only picks the tracks that have at least one matching note.
+func (m Midi) SelectTracks(selector Selector) []int {
+	var trackIndexes []int
+
+	for trIdx := range m.smf.Tracks {
+		if selector.matchesTrack(trIdx, m.TrackName(trIdx)) {
+			trackIndexes = append(trackIndexes, trIdx)
+		}
+	}
+
+	if !selector.hasNoteFilter() {
+		return trackIndexes
+	}
+
+	hasNotes := make(map[int]bool)
+	for _, note := range m.ExtractNotes(selector) {
+		hasNotes[note.Track] = true
+	}
+
+	return slices.DeleteFunc(trackIndexes, func(trIdx int) bool {
+		return !hasNotes[trIdx]
+	})
+}
+
+// trackSet returns the tracks the selector picks as a set, for the methods that change whole tracks
+func (m Midi) trackSet(selector Selector) map[int]bool {
+	set := make(map[int]bool)
+	for _, trIdx := range m.SelectTracks(selector) {
+		set[trIdx] = true
+	}
+
+	return set
+}
+
+// programChange is the program of a channel from an absolute tick on
+type programChange struct {
+	tick    int64
+	program uint8
+}
+
+// programChanges returns the program changes of every channel across all tracks sorted by their tick,
+// program changes apply to the channel no matter which track they are in
+func (m Midi) programChanges() map[uint8][]programChange {
+	changes := make(map[uint8][]programChange)
+
+	for _, tr := range m.smf.Tracks {
+		var absTicks int64
+		for _, ev := range tr {
+			absTicks += int64(ev.Delta)
+
+			var channel, program uint8
+			if ev.Message.GetProgramChange(&channel, &program) {
+				changes[channel] = append(changes[channel], programChange{tick: absTicks, program: program})
+			}
+		}
+	}
+
+	for _, channelChanges := range changes {
+		slices.SortStableFunc(channelChanges, func(a, b programChange) int {
+			return cmp.Compare(a.tick, b.tick)
+		})
+	}
+
+	return changes
+}
+
+// programAt returns the program of the last change at or before the tick, 0 without one
+func programAt(changes []programChange, tick int64) uint8 {
+	idx := sort.Search(len(changes), func(i int) bool {
+		return changes[i].tick > tick
+	})
+	if idx == 0 {
+		return 0
+	}
+
+	return changes[idx-1].program
+}
@@ -0,0 +1,103 @@
+package midi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Selector
+	}{
+		{"", Selector{}},
+		{"track=0,2-3", Selector{Tracks: []int{0, 2, 3}}},
+		{"track=65534", Selector{Tracks: []int{65534}}},
+		{"name=Piano, lead", Selector{TrackNames: []string{"Piano", "lead"}}},
+		{"channel=10", Selector{Channels: []uint8{9}}},
+		{"program=1-2,fretless", Selector{Programs: []uint8{0, 1, 35}}},
+		{"pitch=60", Selector{Pitches: []uint8{60}}},
+		{"pitch=0", Selector{Pitches: []uint8{0}}},
+		{"pitch=36,38,42", Selector{Pitches: []uint8{36, 38, 42}}},
+		{"pitch=60-62,72", Selector{Pitches: []uint8{60, 61, 62, 72}}},
+		{"pitch=127", Selector{Pitches: []uint8{127}}},
+		{"velocity=64", Selector{MinVelocity: 64}},
+		{"drum=kick,42", Selector{DrumKeys: []uint8{35, 36, 42}}},
+		{" Channel = 1 ; pitch = 40 ", Selector{Channels: []uint8{0}, Pitches: []uint8{40}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseSelector(tt.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelectorInvalid(t *testing.T) {
+	for _, s := range []string{
+		"pitch=128",
+		"pitch=-1",
+		"pitch=60-200",
+		"pitch=62-60",
+		"pitch=",
+		"pitch=c4",
+		"channel=0",
+		"channel=17",
+		"program=0",
+		"program=kazoo",
+		"velocity=128",
+		"drum=gong",
+		"track",
+		"track=-1",
+		"track=65535",
+		"track=0-2000000000",
+		"color=red",
+	} {
+		t.Run(s, func(t *testing.T) {
+			if _, err := ParseSelector(s); !errors.Is(err, ErrInvalidSelector) {
+				t.Errorf("got %v, want ErrInvalidSelector", err)
+			}
+		})
+	}
+}
+
+func TestSelectorMatchesPitch(t *testing.T) {
+	tests := []struct {
+		s       string
+		pitches []uint8 // the ones that match out of 0, 36, 38, 40, 60 and 127
+	}{
+		{"", []uint8{0, 36, 38, 40, 60, 127}},
+		{"pitch=0", []uint8{0}},
+		{"pitch=36,40", []uint8{36, 40}},
+		{"pitch=37-60", []uint8{38, 40, 60}},
+		{"pitch=127", []uint8{127}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			selector, err := ParseSelector(tt.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []uint8
+			for _, pitch := range []uint8{0, 36, 38, 40, 60, 127} {
+				if selector.matchesNote(Note{Pitch: pitch, Velocity: 100}) {
+					got = append(got, pitch)
+				}
+			}
+
+			if !reflect.DeepEqual(got, tt.pitches) {
+				t.Errorf("got %v, want %v", got, tt.pitches)
+			}
+		})
+	}
+}
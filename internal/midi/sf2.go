@@ -0,0 +1,344 @@
+package midi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrInvalidSoundFont = errors.New("invalid SoundFont")
+
+// SF2 generator operators, only the ones the synthesizer uses
+const (
+	genStartAddrsOffset           = 0
+	genEndAddrsOffset             = 1
+	genStartloopAddrsOffset       = 2
+	genEndloopAddrsOffset         = 3
+	genStartAddrsCoarseOffset     = 4
+	genEndAddrsCoarseOffset       = 12
+	genPan                        = 17
+	genDelayVolEnv                = 33
+	genAttackVolEnv               = 34
+	genHoldVolEnv                 = 35
+	genDecayVolEnv                = 36
+	genSustainVolEnv              = 37
+	genReleaseVolEnv              = 38
+	genInstrument                 = 41
+	genKeyRange                   = 43
+	genVelRange                   = 44
+	genStartloopAddrsCoarseOffset = 45
+	genKeynum                     = 46
+	genVelocity                   = 47
+	genInitialAttenuation         = 48
+	genEndloopAddrsCoarseOffset   = 50
+	genCoarseTune                 = 51
+	genFineTune                   = 52
+	genSampleID                   = 53
+	genSampleModes                = 54
+	genScaleTuning                = 56
+	genExclusiveClass             = 57
+	genOverridingRootKey          = 58
+
+	genCount = 61
+)
+
+// generators that only make sense on an instrument zone, a preset zone can not offset them
+var instrumentOnlyGens = []int{
+	genStartAddrsOffset, genEndAddrsOffset, genStartloopAddrsOffset, genEndloopAddrsOffset,
+	genStartAddrsCoarseOffset, genEndAddrsCoarseOffset, genStartloopAddrsCoarseOffset, genEndloopAddrsCoarseOffset,
+	genKeynum, genVelocity, genSampleModes, genExclusiveClass, genOverridingRootKey,
+}
+
+// sample types of the shdr records, ROM samples can not be played
+const sampleTypeROM = 0x8000
+
+// sfZone is a preset or instrument zone, with the generators it sets
+type sfZone struct {
+	gens [genCount]int16
+	set  [genCount]bool
+
+	keyLo, keyHi uint8
+	velLo, velHi uint8
+
+	// instrument of a preset zone or sample of an instrument zone, -1 for a global zone
+	index int
+}
+
+func (z sfZone) matches(key, velocity uint8) bool {
+	return key >= z.keyLo && key <= z.keyHi && velocity >= z.velLo && velocity <= z.velHi
+}
+
+type sfPreset struct {
+	name    string
+	program uint16
+	bank    uint16
+	global  *sfZone
+	zones   []sfZone
+}
+
+type sfInstrument struct {
+	name   string
+	global *sfZone
+	zones  []sfZone
+}
+
+type sfSample struct {
+	name               string
+	start, end         uint32
+	loopStart, loopEnd uint32
+	sampleRate         uint32
+	originalPitch      uint8
+	pitchCorrection    int8
+	sampleType         uint16
+}
+
+// SoundFont is a parsed SF2 file, only the 16 bit sample data is used
+type SoundFont struct {
+	presets     []sfPreset
+	instruments []sfInstrument
+	samples     []sfSample
+	sampleData  []int16
+}
+
+func LoadSoundFont(path string) (*SoundFont, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sf, err := ParseSoundFont(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return sf, nil
+}
+
+// ParseSoundFont parses the SF2 file in data
+func ParseSoundFont(data []byte) (*SoundFont, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "sfbk" {
+		return nil, fmt.Errorf("%w: not an sfbk RIFF file", ErrInvalidSoundFont)
+	}
+
+	// the size counts the form type, a file cut short is read as far as it goes
+	riffSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	if riffSize < 4 {
+		return nil, fmt.Errorf("%w: RIFF size %d is too small for the form type", ErrInvalidSoundFont, riffSize)
+	}
+
+	chunks, err := riffChunks(data[12:min(len(data), 8+riffSize)])
+	if err != nil {
+		return nil, err
+	}
+
+	sub := make(map[string][]byte)
+	for _, chunk := range chunks {
+		if chunk.id != "LIST" || len(chunk.data) < 4 {
+			continue
+		}
+
+		listChunks, err := riffChunks(chunk.data[4:])
+		if err != nil {
+			return nil, err
+		}
+		for _, listChunk := range listChunks {
+			sub[listChunk.id] = listChunk.data
+		}
+	}
+
+	for _, id := range []string{"smpl", "phdr", "pbag", "pgen", "inst", "ibag", "igen", "shdr"} {
+		if _, ok := sub[id]; !ok {
+			return nil, fmt.Errorf("%w: missing %s chunk", ErrInvalidSoundFont, id)
+		}
+	}
+
+	sf := &SoundFont{
+		sampleData: make([]int16, len(sub["smpl"])/2),
+	}
+	for i := range sf.sampleData {
+		sf.sampleData[i] = int16(binary.LittleEndian.Uint16(sub["smpl"][i*2:]))
+	}
+
+	if err := sf.parseSamples(sub["shdr"]); err != nil {
+		return nil, err
+	}
+
+	instrumentBags, err := parseBags(sub["ibag"], sub["igen"], genSampleID, len(sf.samples))
+	if err != nil {
+		return nil, fmt.Errorf("%w: instrument zones: %w", ErrInvalidSoundFont, err)
+	}
+	presetBags, err := parseBags(sub["pbag"], sub["pgen"], genInstrument, -1)
+	if err != nil {
+		return nil, fmt.Errorf("%w: preset zones: %w", ErrInvalidSoundFont, err)
+	}
+
+	// the last header of both lists is a terminator that only marks the end of the zones
+	inst := sub["inst"]
+	for i := 0; i+1 < len(inst)/22; i++ {
+		record := inst[i*22:]
+		bagStart := int(binary.LittleEndian.Uint16(record[20:]))
+		bagEnd := int(binary.LittleEndian.Uint16(record[22+20:]))
+
+		global, zones, err := splitZones(instrumentBags, bagStart, bagEnd)
+		if err != nil {
+			return nil, fmt.Errorf("%w: instrument %d: %w", ErrInvalidSoundFont, i, err)
+		}
+
+		sf.instruments = append(sf.instruments, sfInstrument{name: sfName(record[:20]), global: global, zones: zones})
+	}
+
+	phdr := sub["phdr"]
+	for i := 0; i+1 < len(phdr)/38; i++ {
+		record := phdr[i*38:]
+		bagStart := int(binary.LittleEndian.Uint16(record[24:]))
+		bagEnd := int(binary.LittleEndian.Uint16(record[38+24:]))
+
+		global, zones, err := splitZones(presetBags, bagStart, bagEnd)
+		if err != nil {
+			return nil, fmt.Errorf("%w: preset %d: %w", ErrInvalidSoundFont, i, err)
+		}
+
+		for _, zone := range zones {
+			if zone.index >= len(sf.instruments) {
+				return nil, fmt.Errorf("%w: preset %d uses missing instrument %d", ErrInvalidSoundFont, i, zone.index)
+			}
+		}
+
+		sf.presets = append(sf.presets, sfPreset{
+			name:    sfName(record[:20]),
+			program: binary.LittleEndian.Uint16(record[20:]),
+			bank:    binary.LittleEndian.Uint16(record[22:]),
+			global:  global,
+			zones:   zones,
+		})
+	}
+
+	return sf, nil
+}
+
+func (sf *SoundFont) parseSamples(shdr []byte) error {
+	for i := 0; i+1 < len(shdr)/46; i++ {
+		record := shdr[i*46:]
+
+		sample := sfSample{
+			name:            sfName(record[:20]),
+			start:           binary.LittleEndian.Uint32(record[20:]),
+			end:             binary.LittleEndian.Uint32(record[24:]),
+			loopStart:       binary.LittleEndian.Uint32(record[28:]),
+			loopEnd:         binary.LittleEndian.Uint32(record[32:]),
+			sampleRate:      binary.LittleEndian.Uint32(record[36:]),
+			originalPitch:   record[40],
+			pitchCorrection: int8(record[41]),
+			sampleType:      binary.LittleEndian.Uint16(record[44:]),
+		}
+
+		if sample.end > uint32(len(sf.sampleData)) || sample.start > sample.end {
+			return fmt.Errorf("%w: sample %q is outside the sample data", ErrInvalidSoundFont, sample.name)
+		}
+		if sample.sampleRate == 0 {
+			return fmt.Errorf("%w: sample %q has no sample rate", ErrInvalidSoundFont, sample.name)
+		}
+
+		sf.samples = append(sf.samples, sample)
+	}
+
+	return nil
+}
+
+// parseBags reads every zone of the bag list, terminalGen is the generator that links the zone to an
+// instrument or sample. Zones linking past maxIndex are an error unless maxIndex is negative.
+func parseBags(bags, gens []byte, terminalGen int, maxIndex int) ([]sfZone, error) {
+	bagCount := len(bags)/4 - 1
+	zones := make([]sfZone, max(bagCount, 0))
+
+	for i := range zones {
+		genStart := int(binary.LittleEndian.Uint16(bags[i*4:]))
+		genEnd := int(binary.LittleEndian.Uint16(bags[(i+1)*4:]))
+		if genStart > genEnd || genEnd*4 > len(gens) {
+			return nil, fmt.Errorf("zone %d has generators outside the list", i)
+		}
+
+		zone := sfZone{keyHi: 127, velHi: 127, index: -1}
+
+		for g := genStart; g < genEnd; g++ {
+			op := int(binary.LittleEndian.Uint16(gens[g*4:]))
+			lo, hi := gens[g*4+2], gens[g*4+3]
+			amount := int16(binary.LittleEndian.Uint16(gens[g*4+2:]))
+
+			switch {
+			case op == genKeyRange:
+				zone.keyLo, zone.keyHi = lo, hi
+			case op == genVelRange:
+				zone.velLo, zone.velHi = lo, hi
+			case op == terminalGen:
+				zone.index = int(uint16(amount))
+				if maxIndex >= 0 && zone.index >= maxIndex {
+					return nil, fmt.Errorf("zone %d uses missing sample %d", i, zone.index)
+				}
+			case op < genCount:
+				zone.gens[op] = amount
+				zone.set[op] = true
+			}
+		}
+
+		zones[i] = zone
+	}
+
+	return zones, nil
+}
+
+// splitZones returns the zones of bags [bagStart, bagEnd), the first one is the global zone if it links nothing.
+// Other zones that link nothing are ignored, as the spec says.
+func splitZones(zones []sfZone, bagStart, bagEnd int) (*sfZone, []sfZone, error) {
+	if bagStart > bagEnd || bagEnd > len(zones) {
+		return nil, nil, fmt.Errorf("zones %d to %d are outside the list", bagStart, bagEnd)
+	}
+
+	var global *sfZone
+	var linked []sfZone
+
+	for i, zone := range zones[bagStart:bagEnd] {
+		if zone.index >= 0 {
+			linked = append(linked, zone)
+		} else if i == 0 {
+			global = &zone
+		}
+	}
+
+	return global, linked, nil
+}
+
+type riffChunk struct {
+	id   string
+	data []byte
+}
+
+func riffChunks(data []byte) ([]riffChunk, error) {
+	var chunks []riffChunk
+
+	for len(data) >= 8 {
+		id := string(data[:4])
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		if size > len(data)-8 {
+			return nil, fmt.Errorf("%w: chunk %q is cut off", ErrInvalidSoundFont, id)
+		}
+
+		chunks = append(chunks, riffChunk{id: id, data: data[8 : 8+size]})
+
+		// chunks are padded to an even size
+		data = data[min(len(data), 8+size+size%2):]
+	}
+
+	return chunks, nil
+}
+
+// sfName decodes a zero terminated fixed size name
+func sfName(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
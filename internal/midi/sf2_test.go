@@ -0,0 +1,175 @@
+package midi
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"ray_midi_sim/internal/audio"
+
+	gomidi "gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+// testdata/tiny.sf2 has two samples at 22050 Hz, a looped 100 frame sine with root key 57 and a 50 frame click.
+// Instrument "lead" has a global zone with a 0.1 second release, the sine below key 64 and the click from 64 up,
+// instrument "kit" has the click on key 36 only. Preset "piano" 0:0 plays lead, "strings" 0:48 plays lead
+// from key 60 up and "drums" 128:0 plays kit.
+func loadTestSoundFont(t *testing.T) *SoundFont {
+	t.Helper()
+
+	sf, err := LoadSoundFont(filepath.Join("testdata", "tiny.sf2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sf
+}
+
+func TestParseSoundFont(t *testing.T) {
+	sf := loadTestSoundFont(t)
+
+	var presets []string
+	for _, preset := range sf.presets {
+		presets = append(presets, preset.name)
+	}
+	if len(presets) != 3 || presets[0] != "piano" || presets[1] != "strings" || presets[2] != "drums" {
+		t.Errorf("presets: got %q", presets)
+	}
+
+	if len(sf.instruments) != 2 {
+		t.Fatalf("got %d instruments, want 2", len(sf.instruments))
+	}
+	lead := sf.instruments[0]
+	if lead.global == nil || !lead.global.set[genReleaseVolEnv] || len(lead.zones) != 2 {
+		t.Errorf("lead: got global %v and %d zones, want a global zone with the release and 2 zones", lead.global, len(lead.zones))
+	}
+
+	sine := sf.samples[0]
+	if sine.name != "sine" || sine.end-sine.start != 100 || sine.sampleRate != 22050 || sine.originalPitch != 57 {
+		t.Errorf("sine: got %+v", sine)
+	}
+}
+
+func TestParseSoundFontInvalid(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":      nil,
+		"not riff":   []byte("RIFX\x04\x00\x00\x00sfbk"),
+		"no chunks":  []byte("RIFF\x04\x00\x00\x00sfbk"),
+		"cut chunk":  []byte("RIFF\x10\x00\x00\x00sfbkLIST\xff\x00\x00\x00"),
+		"wrong type": []byte("RIFF\x04\x00\x00\x00WAVE"),
+		"zero size":  []byte("RIFF\x00\x00\x00\x00sfbk"),
+		"size of 3":  []byte("RIFF\x03\x00\x00\x00sfbkLIST"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseSoundFont(data); !errors.Is(err, ErrInvalidSoundFont) {
+				t.Errorf("got %v, want ErrInvalidSoundFont", err)
+			}
+		})
+	}
+}
+
+func TestFindPreset(t *testing.T) {
+	engine := newSynthEngine(loadTestSoundFont(t), 22050)
+
+	tests := []struct {
+		bank    uint16
+		program uint8
+		want    string // empty if nothing plays
+	}{
+		{0, 0, "piano"},
+		{0, 48, "strings"},
+		{0, 5, ""},
+		{1, 48, "strings"}, // a missing bank falls back to the GM bank
+		{drumBank, 0, "drums"},
+		{drumBank, 25, "drums"}, // a missing drum kit falls back to the standard kit
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if preset := engine.findPreset(tt.bank, tt.program); preset != nil {
+			got = preset.name
+		}
+
+		if got != tt.want {
+			t.Errorf("bank %d program %d: got %q, want %q", tt.bank, tt.program, got, tt.want)
+		}
+	}
+}
+
+func TestNoteOnZones(t *testing.T) {
+	sf := loadTestSoundFont(t)
+	sine, click := sf.samples[0], sf.samples[1]
+
+	tests := []struct {
+		name       string
+		channel    uint8
+		program    uint8
+		key        uint8
+		wantSample *sfSample // nil if the key plays nothing
+	}{
+		{"lower zone", 0, 0, 60, &sine},
+		{"upper zone", 0, 0, 64, &click},
+		{"preset zone range", 0, 48, 59, nil},
+		{"preset and instrument zone", 0, 48, 60, &sine},
+		{"drum key", drumChannel, 0, 36, &click},
+		{"missing drum key", drumChannel, 0, 37, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newSynthEngine(sf, 22050)
+			engine.handle(smf.Message(gomidi.ProgramChange(tt.channel, tt.program)))
+			engine.handle(smf.Message(gomidi.NoteOn(tt.channel, tt.key, 100)))
+
+			if tt.wantSample == nil {
+				if len(engine.voices) != 0 {
+					t.Errorf("got %d voices, want none", len(engine.voices))
+				}
+				return
+			}
+
+			if len(engine.voices) != 1 {
+				t.Fatalf("got %d voices, want 1", len(engine.voices))
+			}
+			if v := engine.voices[0]; v.pos != float64(tt.wantSample.start) || v.end != float64(tt.wantSample.end) {
+				t.Errorf("the voice plays %v to %v, want sample %q", v.pos, v.end, tt.wantSample.name)
+			}
+		})
+	}
+}
+
+func TestSoundFontSynthesize(t *testing.T) {
+	m := testMidi(t, testTrack(960, on(0, 0, 57, 100), off(480, 0, 57)))
+
+	synth := NewSoundFontSynth(loadTestSoundFont(t))
+	synth.SetSampleRate(22050)
+
+	wavPath := filepath.Join(t.TempDir(), "out.wav")
+	if err := synth.Synthesize(context.Background(), m, wavPath); err != nil {
+		t.Fatal(err)
+	}
+
+	pcm, err := audio.ReadWAV(wavPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the note-off at 0.5 s is at frame 11025, the 0.1 s release falls silent after 0.096 s, 2117 frames,
+	// which is rendered in whole blocks of 64 frames
+	if want := 11025 + 34*synthBlockFrames; len(pcm.Samples) != want {
+		t.Errorf("got %d frames, want %d", len(pcm.Samples), want)
+	}
+	if pcm.SampleRate != 22050 {
+		t.Errorf("got a sample rate of %d, want 22050", pcm.SampleRate)
+	}
+
+	peak := 0.0
+	for _, sample := range pcm.Samples[:11025] {
+		peak = max(peak, sample)
+	}
+	if peak < 0.01 {
+		t.Errorf("the held note is silent, peak %v", peak)
+	}
+}
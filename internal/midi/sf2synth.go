@@ -0,0 +1,615 @@
+package midi
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+
+	"ray_midi_sim/internal/audio"
+
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+const (
+	synthBlockFrames = 64   // frames rendered between envelope and pitch updates
+	synthMaxTailSec  = 10.0 // longest time rendered after the last event while notes are still releasing
+	synthMasterGain  = 0.5
+
+	drumChannel = 9
+	drumBank    = 128
+
+	silentCB = 960.0 // attenuation in centibels at which a voice is inaudible
+)
+
+// generator values of a zone that does not set them
+var genDefaults = func() [genCount]int16 {
+	var defaults [genCount]int16
+	for _, op := range []int{genDelayVolEnv, genAttackVolEnv, genHoldVolEnv, genDecayVolEnv, genReleaseVolEnv} {
+		defaults[op] = -12000
+	}
+	defaults[genScaleTuning] = 100
+	defaults[genKeynum] = -1
+	defaults[genVelocity] = -1
+	defaults[genOverridingRootKey] = -1
+	return defaults
+}()
+
+// SoundFontSynth renders MIDI with a SoundFont in pure Go, without any external program.
+// It plays samples with their loops and volume envelopes, filters and modulators are not supported.
+type SoundFontSynth struct {
+	soundFont  *SoundFont
+	sampleRate int
+}
+
+func NewSoundFontSynth(soundFont *SoundFont) *SoundFontSynth {
+	return &SoundFontSynth{
+		soundFont:  soundFont,
+		sampleRate: DefaultSampleRate,
+	}
+}
+
+func (s *SoundFontSynth) SetSampleRate(sampleRate int) {
+	s.sampleRate = sampleRate
+}
+
+// Synthesize renders the MIDI file to a 16 bit stereo WAV file, the file is removed again if rendering fails
+func (s *SoundFontSynth) Synthesize(ctx context.Context, m Midi, wavPath string) (err error) {
+	if s.sampleRate <= 0 {
+		return fmt.Errorf("sample rate has to be positive, got %d", s.sampleRate)
+	}
+
+	file, err := os.Create(wavPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(wavPath)
+		}
+	}()
+
+	w, err := audio.NewWAVWriter(file, s.sampleRate, 2)
+	if err != nil {
+		return err
+	}
+
+	engine := newSynthEngine(s.soundFont, s.sampleRate)
+	var frame int64
+
+	for _, ev := range m.synthEvents(s.sampleRate) {
+		for frame < ev.frame {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			n := int(min(ev.frame-frame, synthBlockFrames))
+			if err := w.Write(engine.render(n)); err != nil {
+				return err
+			}
+			frame += int64(n)
+		}
+
+		engine.handle(ev.message)
+	}
+
+	// let the released notes ring out
+	for tail := 0; len(engine.voices) > 0 && tail < int(synthMaxTailSec*float64(s.sampleRate)); tail += synthBlockFrames {
+		if err := w.Write(engine.render(synthBlockFrames)); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+type synthEvent struct {
+	frame   int64
+	message smf.Message
+}
+
+// synthEvents returns the channel events of all tracks at their output frame, in playing order
+func (m Midi) synthEvents(sampleRate int) []synthEvent {
+	var events []synthEvent
+
+	tempoMap := m.TempoMap()
+
+	for _, tr := range m.smf.Tracks {
+		var absTicks int64
+
+		for _, ev := range tr {
+			absTicks += int64(ev.Delta)
+
+			if ev.Message.IsMeta() || len(ev.Message) == 0 || ev.Message[0] >= 0xF0 {
+				continue
+			}
+
+			events = append(events, synthEvent{
+				frame:   int64(math.Round(tempoMap.TickToSeconds(float64(absTicks)) * float64(sampleRate))),
+				message: ev.Message,
+			})
+		}
+	}
+
+	slices.SortStableFunc(events, func(a, b synthEvent) int {
+		return cmp.Compare(a.frame, b.frame)
+	})
+
+	return events
+}
+
+type synthChannel struct {
+	program    uint8
+	bank       uint16
+	volume     uint8
+	expression uint8
+	pan        uint8
+	sustain    bool
+	pitchBend  float64 // semitones
+}
+
+func defaultSynthChannel() synthChannel {
+	return synthChannel{volume: 100, expression: 127, pan: 64}
+}
+
+func (c synthChannel) gain() float64 {
+	volume := float64(c.volume) / 127
+	expression := float64(c.expression) / 127
+	return volume * volume * expression * expression
+}
+
+type synthEngine struct {
+	soundFont  *SoundFont
+	sampleRate float64
+
+	channels [16]synthChannel
+	voices   []*synthVoice
+
+	mix []float64
+	out []int16
+}
+
+func newSynthEngine(soundFont *SoundFont, sampleRate int) *synthEngine {
+	e := &synthEngine{
+		soundFont:  soundFont,
+		sampleRate: float64(sampleRate),
+		mix:        make([]float64, synthBlockFrames*2),
+		out:        make([]int16, synthBlockFrames*2),
+	}
+
+	for i := range e.channels {
+		e.channels[i] = defaultSynthChannel()
+	}
+	e.channels[drumChannel].bank = drumBank
+
+	return e
+}
+
+func (e *synthEngine) handle(message smf.Message) {
+	var (
+		channel, key, velocity, controller, value uint8
+		relative                                  int16
+	)
+
+	switch {
+	case message.GetNoteStart(&channel, &key, &velocity):
+		e.noteOn(channel, key, velocity)
+
+	case message.GetNoteEnd(&channel, &key):
+		for _, v := range e.voices {
+			if v.channel == channel && v.key == key && !v.released {
+				if e.channels[channel].sustain {
+					v.held = true
+				} else {
+					v.release()
+				}
+			}
+		}
+
+	case message.GetProgramChange(&channel, &value):
+		e.channels[channel].program = value
+
+	case message.GetPitchBend(&channel, &relative, nil):
+		// the default bend range of 2 semitones
+		e.channels[channel].pitchBend = float64(relative) / 8192 * 2
+
+	case message.GetControlChange(&channel, &controller, &value):
+		e.controlChange(channel, controller, value)
+	}
+}
+
+func (e *synthEngine) controlChange(channel, controller, value uint8) {
+	c := &e.channels[channel]
+
+	switch controller {
+	case 0: // bank select, the drum channel always uses the drum bank
+		if channel != drumChannel {
+			c.bank = uint16(value)
+		}
+	case 7:
+		c.volume = value
+	case 10:
+		c.pan = value
+	case 11:
+		c.expression = value
+	case 64:
+		c.sustain = value >= 64
+		if !c.sustain {
+			for _, v := range e.voices {
+				if v.channel == channel && v.held {
+					v.held = false
+					v.release()
+				}
+			}
+		}
+	case 120: // all sound off
+		e.voices = slices.DeleteFunc(e.voices, func(v *synthVoice) bool {
+			return v.channel == channel
+		})
+	case 121: // reset all controllers
+		program, bank := c.program, c.bank
+		*c = defaultSynthChannel()
+		c.program, c.bank = program, bank
+	case 123: // all notes off
+		for _, v := range e.voices {
+			if v.channel == channel {
+				v.release()
+			}
+		}
+	}
+}
+
+// findPreset falls back to the default drum kit or the GM bank, and plays nothing if neither exists
+func (e *synthEngine) findPreset(bank uint16, program uint8) *sfPreset {
+	candidates := [][2]uint16{{bank, uint16(program)}}
+	if bank == drumBank {
+		candidates = append(candidates, [2]uint16{drumBank, 0})
+	} else {
+		candidates = append(candidates, [2]uint16{0, uint16(program)})
+	}
+
+	for _, candidate := range candidates {
+		for i := range e.soundFont.presets {
+			preset := &e.soundFont.presets[i]
+			if preset.bank == candidate[0] && preset.program == candidate[1] {
+				return preset
+			}
+		}
+	}
+
+	return nil
+}
+
+func (e *synthEngine) noteOn(channel, key, velocity uint8) {
+	c := e.channels[channel]
+
+	preset := e.findPreset(c.bank, c.program)
+	if preset == nil {
+		return
+	}
+
+	for _, presetZone := range preset.zones {
+		if !presetZone.matches(key, velocity) {
+			continue
+		}
+
+		instrument := e.soundFont.instruments[presetZone.index]
+		for _, instrumentZone := range instrument.zones {
+			if !instrumentZone.matches(key, velocity) {
+				continue
+			}
+
+			gens := resolveGens(preset.global, &presetZone, instrument.global, &instrumentZone)
+
+			// a new note of an exclusive class cuts off the others, like an open and a closed hi-hat
+			if class := gens[genExclusiveClass]; class != 0 {
+				for _, v := range e.voices {
+					if v.channel == channel && v.exclusiveClass == class {
+						v.env.stage = envDone
+					}
+				}
+			}
+
+			sample := e.soundFont.samples[instrumentZone.index]
+			if sample.sampleType&sampleTypeROM != 0 {
+				continue
+			}
+
+			e.voices = append(e.voices, newSynthVoice(e, channel, key, velocity, sample, gens))
+		}
+	}
+}
+
+// resolveGens combines the zones into the generator values of a voice. Instrument zones set absolute values,
+// a local zone overriding the global one, preset zones add an offset to them.
+func resolveGens(presetGlobal, presetZone, instrumentGlobal, instrumentZone *sfZone) [genCount]int32 {
+	var gens [genCount]int32
+
+	for op := range genCount {
+		value := int32(genDefaults[op])
+		if instrumentGlobal != nil && instrumentGlobal.set[op] {
+			value = int32(instrumentGlobal.gens[op])
+		}
+		if instrumentZone.set[op] {
+			value = int32(instrumentZone.gens[op])
+		}
+
+		if !slices.Contains(instrumentOnlyGens, op) {
+			if presetZone.set[op] {
+				value += int32(presetZone.gens[op])
+			} else if presetGlobal != nil && presetGlobal.set[op] {
+				value += int32(presetGlobal.gens[op])
+			}
+		}
+
+		gens[op] = value
+	}
+
+	return gens
+}
+
+// render mixes the next n frames of all voices into interleaved 16 bit stereo samples
+func (e *synthEngine) render(n int) []int16 {
+	mix := e.mix[:n*2]
+	clear(mix)
+
+	e.voices = slices.DeleteFunc(e.voices, func(v *synthVoice) bool {
+		return !v.render(mix, e.channels[v.channel], e.sampleRate)
+	})
+
+	out := e.out[:n*2]
+	for i, sample := range mix {
+		out[i] = int16(max(-1, min(1, sample*synthMasterGain)) * math.MaxInt16)
+	}
+
+	return out
+}
+
+// envelope stages
+const (
+	envDelay = iota
+	envAttack
+	envHold
+	envDecay
+	envSustain
+	envRelease
+	envDone
+)
+
+// synthEnvelope is the volume envelope of a voice. Attack rises linearly in amplitude, decay and release
+// fall linearly in centibels, taking their time for the full 100 dB like the spec says.
+type synthEnvelope struct {
+	stage    int
+	stageSec float64
+
+	delaySec, attackSec, holdSec, decaySec, releaseSec float64
+	sustainCB                                          float64
+
+	attenuationCB float64
+	amp           float64
+}
+
+// advance moves the envelope by dt seconds and returns the amplitude after it
+func (env *synthEnvelope) advance(dt float64) float64 {
+	for dt > 0 && env.stage != envDone {
+		switch env.stage {
+		case envDelay, envAttack, envHold:
+			duration := []float64{env.delaySec, env.attackSec, env.holdSec}[env.stage]
+
+			step := min(dt, duration-env.stageSec)
+			env.stageSec += step
+			dt -= step
+
+			switch env.stage {
+			case envDelay:
+				env.amp = 0
+			case envAttack:
+				env.amp = env.stageSec / max(env.attackSec, 1e-9)
+			case envHold:
+				env.amp = 1
+			}
+
+			if env.stageSec >= duration {
+				env.stage++
+				env.stageSec = 0
+				env.attenuationCB = 0
+				if env.stage == envDecay {
+					env.amp = 1
+				}
+			}
+
+		case envDecay:
+			env.attenuationCB += dt * 1000 / env.decaySec
+			dt = 0
+			if env.attenuationCB >= env.sustainCB {
+				env.attenuationCB = env.sustainCB
+				env.stage = envSustain
+			}
+			env.amp = centibelsToAmp(env.attenuationCB)
+
+		case envSustain:
+			dt = 0
+			if env.sustainCB >= silentCB {
+				env.stage = envDone
+			}
+
+		case envRelease:
+			env.attenuationCB += dt * 1000 / env.releaseSec
+			dt = 0
+			if env.attenuationCB >= silentCB {
+				env.stage = envDone
+			}
+			env.amp = centibelsToAmp(env.attenuationCB)
+		}
+	}
+
+	if env.stage == envDone {
+		env.amp = 0
+	}
+
+	return env.amp
+}
+
+func (env *synthEnvelope) release() {
+	if env.stage == envDone || env.stage == envRelease {
+		return
+	}
+
+	if env.stage < envDecay {
+		if env.amp <= 0 {
+			env.stage = envDone
+			return
+		}
+		env.attenuationCB = -200 * math.Log10(env.amp)
+	}
+
+	env.stage = envRelease
+}
+
+type synthVoice struct {
+	channel        uint8
+	key            uint8
+	exclusiveClass int32
+
+	data                    []int16
+	pos                     float64
+	end, loopStart, loopEnd float64
+	loopMode                int32 // 1 loops, 3 loops until released, anything else plays once
+	pitchCents              float64
+	rateRatio               float64 // sample rate of the sample over the output rate
+	gainL, gainR            float64
+
+	env      synthEnvelope
+	released bool
+	held     bool // released while the sustain pedal was down
+}
+
+func newSynthVoice(e *synthEngine, channel, key, velocity uint8, sample sfSample, gens [genCount]int32) *synthVoice {
+	poolEnd := float64(len(e.soundFont.sampleData))
+	address := func(base uint32, fine, coarse int) float64 {
+		return max(0, min(poolEnd, float64(int64(base)+int64(gens[fine])+32768*int64(gens[coarse]))))
+	}
+
+	v := &synthVoice{
+		channel:        channel,
+		key:            key,
+		exclusiveClass: gens[genExclusiveClass],
+
+		data:      e.soundFont.sampleData,
+		pos:       address(sample.start, genStartAddrsOffset, genStartAddrsCoarseOffset),
+		end:       address(sample.end, genEndAddrsOffset, genEndAddrsCoarseOffset),
+		loopStart: address(sample.loopStart, genStartloopAddrsOffset, genStartloopAddrsCoarseOffset),
+		loopEnd:   address(sample.loopEnd, genEndloopAddrsOffset, genEndloopAddrsCoarseOffset),
+		loopMode:  gens[genSampleModes] & 3,
+		rateRatio: float64(sample.sampleRate) / e.sampleRate,
+	}
+
+	if v.loopEnd-v.loopStart < 2 || v.loopEnd > v.end {
+		v.loopMode = 0
+	}
+
+	rootKey := float64(sample.originalPitch)
+	if gens[genOverridingRootKey] >= 0 {
+		rootKey = float64(gens[genOverridingRootKey])
+	} else if sample.originalPitch > 127 {
+		rootKey = 60
+	}
+
+	playedKey := float64(key)
+	if gens[genKeynum] >= 0 {
+		playedKey = float64(gens[genKeynum])
+	}
+	if gens[genVelocity] > 0 {
+		velocity = uint8(min(127, gens[genVelocity]))
+	}
+
+	v.pitchCents = (playedKey-rootKey)*float64(gens[genScaleTuning]) +
+		float64(gens[genCoarseTune])*100 + float64(gens[genFineTune]) + float64(sample.pitchCorrection)
+
+	// like most synthesizers only 40% of the attenuation is applied, the value SoundFonts are tuned for.
+	// velocity follows the concave curve of the default modulator, about 40 log10 of the velocity.
+	attenuationCB := float64(gens[genInitialAttenuation])*0.4 + 400*math.Log10(127/float64(max(velocity, 1)))
+	gain := centibelsToAmp(attenuationCB)
+
+	// generator pan is in tenths of a percent, the channel pan moves it further
+	channelPan := (float64(e.channels[channel].pan) - 64) / 64 * 500
+	pan := max(-500, min(500, float64(gens[genPan])+channelPan))
+	angle := (pan + 500) / 1000 * math.Pi / 2
+	v.gainL = gain * math.Cos(angle)
+	v.gainR = gain * math.Sin(angle)
+
+	v.env = synthEnvelope{
+		delaySec:   timecentsToSec(gens[genDelayVolEnv]),
+		attackSec:  timecentsToSec(gens[genAttackVolEnv]),
+		holdSec:    timecentsToSec(gens[genHoldVolEnv]),
+		decaySec:   max(timecentsToSec(gens[genDecayVolEnv]), 1e-3),
+		releaseSec: max(timecentsToSec(gens[genReleaseVolEnv]), 1e-3),
+		sustainCB:  max(0, min(1440, float64(gens[genSustainVolEnv]))),
+	}
+
+	return v
+}
+
+func (v *synthVoice) release() {
+	v.released = true
+	v.env.release()
+}
+
+// render adds the next frames of the voice to mix, it returns false once the voice has finished
+func (v *synthVoice) render(mix []float64, channel synthChannel, sampleRate float64) bool {
+	frames := len(mix) / 2
+
+	startAmp := v.env.amp
+	endAmp := v.env.advance(float64(frames) / sampleRate)
+	if v.env.stage == envDone {
+		return false
+	}
+
+	step := math.Pow(2, (v.pitchCents+channel.pitchBend*100)/1200) * v.rateRatio
+	looping := v.loopMode == 1 || (v.loopMode == 3 && !v.released)
+	gain := channel.gain()
+
+	for i := range frames {
+		if looping {
+			for v.pos >= v.loopEnd {
+				v.pos -= v.loopEnd - v.loopStart
+			}
+		} else if v.pos >= v.end-1 {
+			return false
+		}
+
+		idx := int(v.pos)
+		frac := v.pos - float64(idx)
+
+		next := idx + 1
+		if looping && float64(next) >= v.loopEnd {
+			next = int(v.loopStart)
+		}
+
+		sample := (float64(v.data[idx])*(1-frac) + float64(v.data[next])*frac) / 32768
+
+		amp := (startAmp + (endAmp-startAmp)*float64(i)/float64(frames)) * gain
+		mix[i*2] += sample * amp * v.gainL
+		mix[i*2+1] += sample * amp * v.gainR
+
+		v.pos += step
+	}
+
+	return true
+}
+
+func timecentsToSec(timecents int32) float64 {
+	if timecents <= -32768 {
+		return 0
+	}
+	return math.Pow(2, float64(timecents)/1200)
+}
+
+func centibelsToAmp(centibels float64) float64 {
+	return math.Pow(10, -centibels/200)
+}
@@ -0,0 +1,106 @@
+package midi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const DefaultSampleRate = 44100
+
+var ErrFluidSynthNotFound = errors.New("fluidsynth executable not found")
+
+// Synthesizer renders a MIDI file to a WAV file
+type Synthesizer interface {
+	Synthesize(ctx context.Context, m Midi, wavPath string) error
+}
+
+// ToWav renders the MIDI file to wavPath with the synthesizer
+func (m Midi) ToWav(ctx context.Context, synth Synthesizer, wavPath string) error {
+	return synth.Synthesize(ctx, m, wavPath)
+}
+
+// FluidSynth renders through the fluidsynth command line program
+type FluidSynth struct {
+	executable    string
+	soundFontPath string
+	sampleRate    int
+}
+
+func NewFluidSynth(soundFontPath string) *FluidSynth {
+	return &FluidSynth{
+		executable:    "fluidsynth",
+		soundFontPath: soundFontPath,
+		sampleRate:    DefaultSampleRate,
+	}
+}
+
+// SetExecutable sets the name or path of the fluidsynth program, looked up in PATH if it has no separators
+func (f *FluidSynth) SetExecutable(executable string) {
+	f.executable = executable
+}
+
+func (f *FluidSynth) SetSampleRate(sampleRate int) {
+	f.sampleRate = sampleRate
+}
+
+// Synthesize writes the MIDI file to a temp file and has fluidsynth render it, the temp file is always removed
+// and so is a partially written WAV file if fluidsynth fails
+func (f *FluidSynth) Synthesize(ctx context.Context, m Midi, wavPath string) error {
+	if f.sampleRate <= 0 {
+		return fmt.Errorf("sample rate has to be positive, got %d", f.sampleRate)
+	}
+
+	// fluidsynth only warns about a missing SoundFont and renders silence
+	if _, err := os.Stat(f.soundFontPath); err != nil {
+		return fmt.Errorf("SoundFont: %w", err)
+	}
+
+	executable, err := exec.LookPath(f.executable)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFluidSynthNotFound, err)
+	}
+
+	midFile, err := os.CreateTemp("", "ray_midi_sim-*.mid")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(midFile.Name())
+
+	if _, err := m.smf.WriteTo(midFile); err != nil {
+		midFile.Close()
+		return fmt.Errorf("writing temp MIDI file: %w", err)
+	}
+	if err := midFile.Close(); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, executable,
+		"-n", "-i", // no MIDI input driver, no shell
+		"-q",
+		"-r", strconv.Itoa(f.sampleRate),
+		"-T", "wav",
+		"-F", wavPath,
+		f.soundFontPath,
+		midFile.Name(),
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		os.Remove(wavPath)
+
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("fluidsynth: %w: %s", err, msg)
+		}
+		return fmt.Errorf("fluidsynth: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package midi
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sort"
+
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+const (
+	defaultBPM              = 120.0
+	defaultMeterNumerator   = 4
+	defaultMeterDenominator = 4
+)
+
+// TempoChange sets the tempo from its tick on
+type TempoChange struct {
+	Tick int64
+	Time float64 // seconds
+	BPM  float64 // quarter notes per minute
+}
+
+// TimeSignature sets the meter from its tick on, a time signature always starts a new bar
+type TimeSignature struct {
+	Tick        int64
+	Time        float64 // seconds
+	Bar         int     // index of the bar it starts
+	Beat        float64 // beats before it, counted in the beat units of the earlier signatures
+	Numerator   uint8   // beats per bar
+	Denominator uint8   // note value of a beat, 4 for quarter notes
+}
+
+// Beat is a single beat of the beat grid
+type Beat struct {
+	Time float64 // seconds
+	Bar  int
+	Beat int // index of the beat in its bar, 0 is the downbeat
+}
+
+func (b Beat) IsDownbeat() bool {
+	return b.Beat == 0
+}
+
+// TempoMap converts between ticks, seconds and beats using the tempo changes and time signatures of a file.
+// Both lists always start at tick 0, with 120 BPM and 4/4 if the file does not set them there.
+type TempoMap struct {
+	ticksPerQuarter float64
+
+	tempos         []TempoChange
+	timeSignatures []TimeSignature
+}
+
+// TempoMap collects the tempo changes and time signatures of all tracks, the later one wins if two share a tick
+func (m Midi) TempoMap() TempoMap {
+	ticksPerQuarter := float64(smf.MetricTicks(0).Resolution())
+	if metricTicks, ok := m.smf.TimeFormat.(smf.MetricTicks); ok {
+		ticksPerQuarter = float64(metricTicks.Resolution())
+	}
+
+	tempos := []TempoChange{{BPM: defaultBPM}}
+	timeSignatures := []TimeSignature{{Numerator: defaultMeterNumerator, Denominator: defaultMeterDenominator}}
+
+	for _, tr := range m.smf.Tracks {
+		var absTicks int64
+
+		for _, ev := range tr {
+			absTicks += int64(ev.Delta)
+
+			var (
+				bpm                    float64
+				numerator, denominator uint8
+			)
+
+			switch {
+			case ev.Message.GetMetaTempo(&bpm) && bpm > 0:
+				tempos = append(tempos, TempoChange{Tick: absTicks, BPM: bpm})
+			case ev.Message.GetMetaMeter(&numerator, &denominator) && numerator > 0 && denominator > 0:
+				timeSignatures = append(timeSignatures, TimeSignature{Tick: absTicks, Numerator: numerator, Denominator: denominator})
+			}
+		}
+	}
+
+	t := TempoMap{
+		ticksPerQuarter: ticksPerQuarter,
+		tempos:          lastPerTick(tempos, func(tc TempoChange) int64 { return tc.Tick }),
+		timeSignatures:  lastPerTick(timeSignatures, func(ts TimeSignature) int64 { return ts.Tick }),
+	}
+
+	for i := range t.tempos {
+		if i > 0 {
+			prev := t.tempos[i-1]
+			t.tempos[i].Time = prev.Time + t.quarters(t.tempos[i].Tick-prev.Tick)*60/prev.BPM
+		}
+	}
+
+	for i := range t.timeSignatures {
+		t.timeSignatures[i].Time = t.TickToSeconds(float64(t.timeSignatures[i].Tick))
+
+		if i > 0 {
+			prev := t.timeSignatures[i-1]
+			beats := float64(t.timeSignatures[i].Tick-prev.Tick) / t.ticksPerBeat(prev)
+
+			// a bar cut short by the next time signature still counts as a bar
+			t.timeSignatures[i].Beat = prev.Beat + beats
+			t.timeSignatures[i].Bar = prev.Bar + int(math.Ceil(beats/float64(prev.Numerator)-1e-9))
+		}
+	}
+
+	return t
+}
+
+// lastPerTick sorts the list by tick and keeps only the last entry of each tick
+func lastPerTick[T any](list []T, tick func(T) int64) []T {
+	slices.SortStableFunc(list, func(a, b T) int {
+		return cmp.Compare(tick(a), tick(b))
+	})
+
+	var result []T
+	for i, item := range list {
+		if i+1 < len(list) && tick(list[i+1]) == tick(item) {
+			continue
+		}
+		result = append(result, item)
+	}
+
+	return result
+}
+
+func (t TempoMap) Tempos() []TempoChange {
+	return t.tempos
+}
+
+func (t TempoMap) TimeSignatures() []TimeSignature {
+	return t.timeSignatures
+}
+
+func (t TempoMap) quarters(ticks int64) float64 {
+	return float64(ticks) / t.ticksPerQuarter
+}
+
+func (t TempoMap) ticksPerBeat(ts TimeSignature) float64 {
+	return t.ticksPerQuarter * 4 / float64(ts.Denominator)
+}
+
+// BPMAt returns the tempo at the tick
+func (t TempoMap) BPMAt(tick float64) float64 {
+	return t.tempoAtTick(tick).BPM
+}
+
+func (t TempoMap) tempoAtTick(tick float64) TempoChange {
+	i := sort.Search(len(t.tempos), func(i int) bool { return float64(t.tempos[i].Tick) > tick })
+	return t.tempos[max(i-1, 0)]
+}
+
+func (t TempoMap) timeSignatureAtTick(tick float64) TimeSignature {
+	i := sort.Search(len(t.timeSignatures), func(i int) bool { return float64(t.timeSignatures[i].Tick) > tick })
+	return t.timeSignatures[max(i-1, 0)]
+}
+
+// TickToSeconds converts an absolute tick to seconds, ticks can be fractional
+func (t TempoMap) TickToSeconds(tick float64) float64 {
+	tempo := t.tempoAtTick(tick)
+	return tempo.Time + (tick-float64(tempo.Tick))/t.ticksPerQuarter*60/tempo.BPM
+}
+
+// SecondsToTick converts seconds to a fractional absolute tick
+func (t TempoMap) SecondsToTick(sec float64) float64 {
+	i := sort.Search(len(t.tempos), func(i int) bool { return t.tempos[i].Time > sec })
+	tempo := t.tempos[max(i-1, 0)]
+
+	return float64(tempo.Tick) + (sec-tempo.Time)*tempo.BPM/60*t.ticksPerQuarter
+}
+
+// TickToBeat converts an absolute tick to beats since the start, a beat is the note value of the time signature
+func (t TempoMap) TickToBeat(tick float64) float64 {
+	ts := t.timeSignatureAtTick(tick)
+	return ts.Beat + (tick-float64(ts.Tick))/t.ticksPerBeat(ts)
+}
+
+// BeatToTick converts beats since the start to a fractional absolute tick
+func (t TempoMap) BeatToTick(beat float64) float64 {
+	i := sort.Search(len(t.timeSignatures), func(i int) bool { return t.timeSignatures[i].Beat > beat })
+	ts := t.timeSignatures[max(i-1, 0)]
+
+	return float64(ts.Tick) + (beat-ts.Beat)*t.ticksPerBeat(ts)
+}
+
+func (t TempoMap) SecondsToBeat(sec float64) float64 {
+	return t.TickToBeat(t.SecondsToTick(sec))
+}
+
+func (t TempoMap) BeatToSeconds(beat float64) float64 {
+	return t.TickToSeconds(t.BeatToTick(beat))
+}
+
+// Beats returns every beat from the start up to endSec, the beat grid restarts at each time signature
+func (t TempoMap) Beats(endSec float64) []Beat {
+	var beats []Beat
+
+	for i, ts := range t.timeSignatures {
+		endTick := math.Inf(1)
+		if i+1 < len(t.timeSignatures) {
+			endTick = float64(t.timeSignatures[i+1].Tick)
+		}
+
+		for beatIdx := 0; ; beatIdx++ {
+			tick := float64(ts.Tick) + float64(beatIdx)*t.ticksPerBeat(ts)
+			if tick >= endTick {
+				break
+			}
+
+			sec := t.TickToSeconds(tick)
+			if sec > endSec {
+				return beats
+			}
+
+			beats = append(beats, Beat{
+				Time: sec,
+				Bar:  ts.Bar + beatIdx/int(ts.Numerator),
+				Beat: beatIdx % int(ts.Numerator),
+			})
+		}
+	}
+
+	return beats
+}
+
+// Downbeats returns the start time of every bar up to endSec
+func (t TempoMap) Downbeats(endSec float64) []float64 {
+	var downbeats []float64
+
+	for _, beat := range t.Beats(endSec) {
+		if beat.IsDownbeat() {
+			downbeats = append(downbeats, beat.Time)
+		}
+	}
+
+	return downbeats
+}
@@ -0,0 +1,145 @@
+package midi
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+// testTempoMidi starts at 120 BPM in 4/4, turns to 60 BPM in 3/4 after one bar at 2 seconds
+// and to 240 BPM after another bar at 5 seconds
+func testTempoMidi(t *testing.T) Midi {
+	t.Helper()
+
+	return testMidi(t,
+		testTrack(3360,
+			testEvent{1920, smf.MetaTempo(60)},
+			testEvent{1920, smf.MetaMeter(3, 4)},
+		),
+		// tempo changes count in any track
+		testTrack(4800,
+			testEvent{3360, smf.MetaTempo(100)},
+			testEvent{3360, smf.MetaTempo(240)},
+		),
+	)
+}
+
+func TestTempoMapChanges(t *testing.T) {
+	tempoMap := testTempoMidi(t).TempoMap()
+
+	wantTempos := []TempoChange{
+		{Tick: 0, Time: 0, BPM: 120},
+		{Tick: 1920, Time: 2, BPM: 60},
+		// the later of two changes at the same tick wins
+		{Tick: 3360, Time: 5, BPM: 240},
+	}
+	if got := tempoMap.Tempos(); !reflect.DeepEqual(got, wantTempos) {
+		t.Errorf("tempos: got %+v, want %+v", got, wantTempos)
+	}
+
+	wantTimeSignatures := []TimeSignature{
+		{Tick: 0, Time: 0, Bar: 0, Beat: 0, Numerator: 4, Denominator: 4},
+		{Tick: 1920, Time: 2, Bar: 1, Beat: 4, Numerator: 3, Denominator: 4},
+	}
+	if got := tempoMap.TimeSignatures(); !reflect.DeepEqual(got, wantTimeSignatures) {
+		t.Errorf("time signatures: got %+v, want %+v", got, wantTimeSignatures)
+	}
+
+	for _, tt := range []struct {
+		tick, sec, bpm float64
+	}{
+		{0, 0, 120},
+		{960, 1, 120},
+		{1919, 1919.0 / 960, 120},
+		{1920, 2, 60},
+		{2400, 3, 60},
+		{3360, 5, 240},
+		{3840, 5.25, 240},
+	} {
+		if got := tempoMap.TickToSeconds(tt.tick); math.Abs(got-tt.sec) > 1e-9 {
+			t.Errorf("TickToSeconds(%v): got %v, want %v", tt.tick, got, tt.sec)
+		}
+		if got := tempoMap.BPMAt(tt.tick); got != tt.bpm {
+			t.Errorf("BPMAt(%v): got %v, want %v", tt.tick, got, tt.bpm)
+		}
+	}
+}
+
+func TestTempoMapDefaults(t *testing.T) {
+	tempoMap := testMidi(t, testTrack(1920)).TempoMap()
+
+	if got := tempoMap.Tempos(); !reflect.DeepEqual(got, []TempoChange{{BPM: 120}}) {
+		t.Errorf("tempos: got %+v", got)
+	}
+	if got := tempoMap.TimeSignatures(); !reflect.DeepEqual(got, []TimeSignature{{Numerator: 4, Denominator: 4}}) {
+		t.Errorf("time signatures: got %+v", got)
+	}
+	if got := tempoMap.TickToSeconds(testTicksPerQuarter); got != 0.5 {
+		t.Errorf("a quarter note at 120 BPM: got %v seconds, want 0.5", got)
+	}
+}
+
+func TestTempoMapRoundTrip(t *testing.T) {
+	tempoMap := testTempoMidi(t).TempoMap()
+
+	for _, sec := range []float64{0, 0.3, 1.999, 2, 2.0001, 4.5, 5, 7.123} {
+		tick := tempoMap.SecondsToTick(sec)
+		if got := tempoMap.TickToSeconds(tick); math.Abs(got-sec) > 1e-9 {
+			t.Errorf("%v s -> tick %v -> %v s", sec, tick, got)
+		}
+	}
+
+	for _, tick := range []float64{0, 1, 479.5, 1920, 2000, 3359, 3360, 10000} {
+		sec := tempoMap.TickToSeconds(tick)
+		if got := tempoMap.SecondsToTick(sec); math.Abs(got-tick) > 1e-6 {
+			t.Errorf("tick %v -> %v s -> tick %v", tick, sec, got)
+		}
+
+		beat := tempoMap.TickToBeat(tick)
+		if got := tempoMap.BeatToTick(beat); math.Abs(got-tick) > 1e-6 {
+			t.Errorf("tick %v -> beat %v -> tick %v", tick, beat, got)
+		}
+	}
+}
+
+func TestTempoMapBeats(t *testing.T) {
+	tempoMap := testTempoMidi(t).TempoMap()
+
+	want := []Beat{
+		{Time: 0, Bar: 0, Beat: 0},
+		{Time: 0.5, Bar: 0, Beat: 1},
+		{Time: 1, Bar: 0, Beat: 2},
+		{Time: 1.5, Bar: 0, Beat: 3},
+		{Time: 2, Bar: 1, Beat: 0},
+		{Time: 3, Bar: 1, Beat: 1},
+		{Time: 4, Bar: 1, Beat: 2},
+		{Time: 5, Bar: 2, Beat: 0},
+	}
+	if got := tempoMap.Beats(5); !reflect.DeepEqual(got, want) {
+		t.Errorf("beats: got %+v, want %+v", got, want)
+	}
+
+	if got, want := tempoMap.Downbeats(6), []float64{0, 2, 5, 5.75}; !reflect.DeepEqual(got, want) {
+		t.Errorf("downbeats: got %v, want %v", got, want)
+	}
+
+	if got := tempoMap.SecondsToBeat(3); got != 5 {
+		t.Errorf("SecondsToBeat(3): got %v, want 5", got)
+	}
+}
+
+func TestTempoMapShortBar(t *testing.T) {
+	// the 4/4 bar is cut short after two beats by the 3/4, which still starts a new bar
+	tempoMap := testMidi(t, testTrack(1920, testEvent{960, smf.MetaMeter(3, 4)})).TempoMap()
+
+	want := TimeSignature{Tick: 960, Time: 1, Bar: 1, Beat: 2, Numerator: 3, Denominator: 4}
+	if got := tempoMap.TimeSignatures()[1]; got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got := tempoMap.Downbeats(2); !reflect.DeepEqual(got, []float64{0, 1}) {
+		t.Errorf("downbeats: got %v", got)
+	}
+}
@@ -0,0 +1,218 @@
+package midi
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+var ErrUnknownImportance = errors.New("unknown importance")
+
+// Importance decides which of two onsets too close together Thin keeps
+type Importance int
+
+const (
+	ByVelocity Importance = iota // the onset with the loudest note
+	ByPitch                      // the onset with the highest note, the melody usually is on top
+	ByBeat                       // the onset on the stronger metric position, see TempoMap.MetricLevel
+)
+
+// Importances are the names ParseImportance accepts, in the order of the constants
+var Importances = []string{"velocity", "pitch", "beat"}
+
+func ParseImportance(s string) (Importance, error) {
+	idx := slices.Index(Importances, strings.ToLower(strings.TrimSpace(s)))
+	if idx < 0 {
+		return 0, fmt.Errorf("%w %q, expected one of %s", ErrUnknownImportance, s, strings.Join(Importances, ", "))
+	}
+
+	return Importance(idx), nil
+}
+
+func (i Importance) String() string {
+	if i < 0 || int(i) >= len(Importances) {
+		return fmt.Sprintf("Importance(%d)", int(i))
+	}
+
+	return Importances[i]
+}
+
+// metric levels of MetricLevel, every level halves the note value of the one before
+const (
+	levelDownbeat  = 0
+	maxMetricLevel = 5
+
+	// beats a note can be off a grid line and still count as on it
+	metricTolerance = 1.0 / 32
+)
+
+// MetricLevel returns how strong the metric position at sec is: 0 on a downbeat, 1 on another beat, 2 halfway
+// between two beats, 3 on a quarter of a beat and so on. Positions off that grid get maxMetricLevel.
+func (t TempoMap) MetricLevel(sec float64) int {
+	tick := t.SecondsToTick(sec)
+	ts := t.timeSignatureAtTick(tick)
+	beats := (tick - float64(ts.Tick)) / t.ticksPerBeat(ts)
+
+	bar := beats / float64(ts.Numerator)
+	if math.Abs(bar-math.Round(bar))*float64(ts.Numerator) < metricTolerance {
+		return levelDownbeat
+	}
+
+	for level := 1; level < maxMetricLevel; level++ {
+		scale := math.Exp2(float64(level - 1))
+		if math.Abs(beats*scale-math.Round(beats*scale)) < metricTolerance*scale {
+			return level
+		}
+	}
+
+	return maxMetricLevel
+}
+
+var metricLevelNames = []string{"on a downbeat", "on a beat", "on a half beat", "on a quarter beat", "on an eighth beat", "off the grid"}
+
+// ThinnedOnset is an onset Thin removed, its notes were merged into the onset that was kept instead
+type ThinnedOnset struct {
+	NoteGroup
+	KeptTime float64 // start of the onset it was merged into
+	Reason   string
+}
+
+// onsetRank is what Thin compares onsets by, for the importance it was given
+type onsetRank struct {
+	value       int
+	description string
+}
+
+// Thin removes onsets until every onset starts at least minGapSec after the one before it, groups have to be sorted
+// by their start. Only onsets closer than that to another one are looked at. Of those the most important one is kept
+// first, then the next most important one that is far enough from every kept onset and so on. Ties keep the onset
+// with more notes, then the earlier one. A removed onset is merged into the kept onset closest to it.
+// tempoMap can be nil if the onsets come without a MIDI file, ByBeat then ranks every onset the same.
+func Thin(groups []NoteGroup, minGapSec float64, importance Importance, tempoMap *TempoMap) ([]NoteGroup, []ThinnedOnset) {
+	kept := make([]NoteGroup, len(groups))
+	for i, group := range groups {
+		kept[i] = NoteGroup{Time: group.Time, Notes: slices.Clone(group.Notes)}
+	}
+
+	if minGapSec <= 0 {
+		return kept, nil
+	}
+
+	ranks := make([]onsetRank, len(groups))
+	for i, group := range groups {
+		ranks[i] = rankOnset(group, importance, tempoMap)
+	}
+
+	removedIdxs := make(map[int]int) // index of every removed onset to the index of the onset it was merged into
+	var thinned []ThinnedOnset
+
+	// a cluster is a run of onsets that are each closer than minGapSec to the one before
+	for start := 0; start < len(groups); {
+		end := start + 1
+		for end < len(groups) && groups[end].Time-groups[end-1].Time < minGapSec {
+			end++
+		}
+
+		order := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			order = append(order, i)
+		}
+		slices.SortStableFunc(order, func(a, b int) int {
+			return cmp.Or(
+				-cmp.Compare(ranks[a].value, ranks[b].value),
+				-cmp.Compare(len(groups[a].Notes), len(groups[b].Notes)),
+			)
+		})
+
+		var keptIdxs []int // sorted by time
+		for _, idx := range order {
+			pos, _ := slices.BinarySearch(keptIdxs, idx)
+
+			// the closest kept onset that is too close, on either side
+			conflict := -1
+			for _, neighbour := range keptIdxs[max(0, pos-1):min(len(keptIdxs), pos+1)] {
+				gap := math.Abs(groups[idx].Time - groups[neighbour].Time)
+				if gap < minGapSec && (conflict < 0 || gap < math.Abs(groups[idx].Time-groups[conflict].Time)) {
+					conflict = neighbour
+				}
+			}
+
+			if conflict < 0 {
+				keptIdxs = slices.Insert(keptIdxs, pos, idx)
+				continue
+			}
+
+			removedIdxs[idx] = conflict
+			thinned = append(thinned, ThinnedOnset{
+				NoteGroup: groups[idx],
+				KeptTime:  groups[conflict].Time,
+				Reason:    thinReason(groups[idx], groups[conflict], ranks[idx], ranks[conflict], minGapSec),
+			})
+		}
+
+		start = end
+	}
+
+	for _, idx := range slices.Sorted(maps.Keys(removedIdxs)) {
+		kept[removedIdxs[idx]].Notes = append(kept[removedIdxs[idx]].Notes, groups[idx].Notes...)
+	}
+
+	var result []NoteGroup
+	for i, group := range kept {
+		if _, ok := removedIdxs[i]; !ok {
+			result = append(result, group)
+		}
+	}
+
+	slices.SortStableFunc(thinned, func(a, b ThinnedOnset) int {
+		return cmp.Compare(a.Time, b.Time)
+	})
+
+	return result, thinned
+}
+
+func rankOnset(group NoteGroup, importance Importance, tempoMap *TempoMap) onsetRank {
+	switch importance {
+	case ByVelocity:
+		var velocity uint8
+		for _, note := range group.Notes {
+			velocity = max(velocity, note.Velocity)
+		}
+		return onsetRank{value: int(velocity), description: fmt.Sprintf("velocity %d", velocity)}
+
+	case ByPitch:
+		var pitch uint8
+		for _, note := range group.Notes {
+			pitch = max(pitch, note.Pitch)
+		}
+		return onsetRank{value: int(pitch), description: fmt.Sprintf("pitch %d", pitch)}
+
+	case ByBeat:
+		if tempoMap == nil {
+			return onsetRank{description: "no beat grid"}
+		}
+		level := tempoMap.MetricLevel(group.Time)
+		return onsetRank{value: -level, description: metricLevelNames[level]}
+
+	default:
+		return onsetRank{}
+	}
+}
+
+func thinReason(removed, kept NoteGroup, removedRank, keptRank onsetRank, minGapSec float64) string {
+	gap := math.Abs(removed.Time - kept.Time)
+	reason := fmt.Sprintf("%.0fms from the onset at %.3fs, the square needs %.0fms between bounces", gap*1000, kept.Time, minGapSec*1000)
+
+	switch {
+	case removedRank.value != keptRank.value:
+		return fmt.Sprintf("%s, %s against %s", reason, removedRank.description, keptRank.description)
+	case len(removed.Notes) != len(kept.Notes):
+		return fmt.Sprintf("%s, %d notes against %d", reason, len(removed.Notes), len(kept.Notes))
+	default:
+		return reason + ", the earlier onset is kept"
+	}
+}
@@ -0,0 +1,194 @@
+package midi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// onset returns a group at sec with a note for every pitch and velocity pair
+func onset(sec float64, pitchesAndVelocities ...uint8) NoteGroup {
+	group := NoteGroup{Time: sec}
+	for i := 0; i+1 < len(pitchesAndVelocities); i += 2 {
+		group.Notes = append(group.Notes, Note{Pitch: pitchesAndVelocities[i], Velocity: pitchesAndVelocities[i+1]})
+	}
+
+	return group
+}
+
+func TestParseImportance(t *testing.T) {
+	for i, s := range Importances {
+		if got, err := ParseImportance(s); err != nil || got != Importance(i) || got.String() != s {
+			t.Errorf("%q: got %v, %v", s, got, err)
+		}
+	}
+	if got, err := ParseImportance(" Pitch "); err != nil || got != ByPitch {
+		t.Errorf("got %v, %v, want pitch", got, err)
+	}
+	if _, err := ParseImportance("loudness"); !errors.Is(err, ErrUnknownImportance) {
+		t.Errorf("got %v, want ErrUnknownImportance", err)
+	}
+}
+
+func TestMetricLevel(t *testing.T) {
+	// 4/4 at 120 bpm, a beat every half second
+	tempoMap := testMidi(t, testTrack(1920)).TempoMap()
+
+	tests := []struct {
+		sec  float64
+		want int
+	}{
+		{0, levelDownbeat},
+		{2, levelDownbeat},
+		{0.5, 1},
+		{1.25, 2},
+		{1.125, 3},
+		{1.0625, 4},
+		{0.1, maxMetricLevel},
+	}
+
+	for _, tt := range tests {
+		if got := tempoMap.MetricLevel(tt.sec); got != tt.want {
+			t.Errorf("%vs: got %d, want %d", tt.sec, got, tt.want)
+		}
+	}
+}
+
+func TestThin(t *testing.T) {
+	tempoMap := testMidi(t, testTrack(1920)).TempoMap()
+
+	tests := []struct {
+		name        string
+		groups      []NoteGroup
+		importance  Importance
+		tempoMap    *TempoMap
+		wantKept    []NoteGroup
+		wantThinned []ThinnedOnset
+	}{
+		{
+			name:       "onsets far enough apart stay",
+			groups:     []NoteGroup{onset(0, 60, 100), onset(0.1, 62, 50), onset(0.25, 64, 50)},
+			importance: ByVelocity,
+			wantKept:   []NoteGroup{onset(0, 60, 100), onset(0.1, 62, 50), onset(0.25, 64, 50)},
+		},
+		{
+			name:       "the louder onset is kept",
+			groups:     []NoteGroup{onset(0, 60, 50), onset(0.05, 62, 100)},
+			importance: ByVelocity,
+			wantKept:   []NoteGroup{onset(0.05, 62, 100, 60, 50)},
+			wantThinned: []ThinnedOnset{{
+				NoteGroup: onset(0, 60, 50),
+				KeptTime:  0.05,
+				Reason:    "50ms from the onset at 0.050s, the square needs 100ms between bounces, velocity 50 against velocity 100",
+			}},
+		},
+		{
+			name:       "the higher onset is kept",
+			groups:     []NoteGroup{onset(0, 72, 50), onset(0.05, 60, 100)},
+			importance: ByPitch,
+			wantKept:   []NoteGroup{onset(0, 72, 50, 60, 100)},
+			wantThinned: []ThinnedOnset{{
+				NoteGroup: onset(0.05, 60, 100),
+				KeptTime:  0,
+				Reason:    "50ms from the onset at 0.000s, the square needs 100ms between bounces, pitch 60 against pitch 72",
+			}},
+		},
+		{
+			name:       "the onset on the beat is kept",
+			groups:     []NoteGroup{onset(0.41, 60, 100), onset(0.5, 62, 50)},
+			importance: ByBeat,
+			tempoMap:   &tempoMap,
+			wantKept:   []NoteGroup{onset(0.5, 62, 50, 60, 100)},
+			wantThinned: []ThinnedOnset{{
+				NoteGroup: onset(0.41, 60, 100),
+				KeptTime:  0.5,
+				Reason:    "90ms from the onset at 0.500s, the square needs 100ms between bounces, off the grid against on a beat",
+			}},
+		},
+		{
+			name:       "a tie keeps the onset with more notes",
+			groups:     []NoteGroup{onset(0, 60, 100), onset(0.05, 62, 100, 64, 80)},
+			importance: ByVelocity,
+			wantKept:   []NoteGroup{onset(0.05, 62, 100, 64, 80, 60, 100)},
+			wantThinned: []ThinnedOnset{{
+				NoteGroup: onset(0, 60, 100),
+				KeptTime:  0.05,
+				Reason:    "50ms from the onset at 0.050s, the square needs 100ms between bounces, 1 notes against 2",
+			}},
+		},
+		{
+			name:       "then the earlier one",
+			groups:     []NoteGroup{onset(0.45, 60, 100), onset(0.5, 62, 100)},
+			importance: ByBeat, // without a beat grid every onset ranks the same
+			wantKept:   []NoteGroup{onset(0.45, 60, 100, 62, 100)},
+			wantThinned: []ThinnedOnset{{
+				NoteGroup: onset(0.5, 62, 100),
+				KeptTime:  0.45,
+				Reason:    "50ms from the onset at 0.450s, the square needs 100ms between bounces, the earlier onset is kept",
+			}},
+		},
+		{
+			// each onset is too close to the one before, but the loud ones are far enough from each other,
+			// the one in the middle is as close to both and goes to the earlier one
+			name: "a cluster keeps the loudest onsets that fit",
+			groups: []NoteGroup{
+				onset(0, 60, 50), onset(0.0625, 61, 100), onset(0.125, 62, 50), onset(0.1875, 63, 100),
+			},
+			importance: ByVelocity,
+			wantKept:   []NoteGroup{onset(0.0625, 61, 100, 60, 50, 62, 50), onset(0.1875, 63, 100)},
+			wantThinned: []ThinnedOnset{
+				{NoteGroup: onset(0, 60, 50), KeptTime: 0.0625},
+				{NoteGroup: onset(0.125, 62, 50), KeptTime: 0.0625},
+			},
+		},
+		{
+			// the quiet onset conflicts with both loud ones and is merged into the closer, quieter one of them
+			name:       "a removed onset goes to the closest kept onset",
+			groups:     []NoteGroup{onset(0, 60, 100), onset(0.09375, 61, 50), onset(0.125, 62, 90)},
+			importance: ByVelocity,
+			wantKept:   []NoteGroup{onset(0, 60, 100), onset(0.125, 62, 90, 61, 50)},
+			wantThinned: []ThinnedOnset{
+				{NoteGroup: onset(0.09375, 61, 50), KeptTime: 0.125},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, thinned := Thin(tt.groups, 0.1, tt.importance, tt.tempoMap)
+
+			if !reflect.DeepEqual(kept, tt.wantKept) {
+				t.Errorf("kept:\ngot  %+v\nwant %+v", kept, tt.wantKept)
+			}
+
+			if len(thinned) != len(tt.wantThinned) {
+				t.Fatalf("thinned: got %+v, want %+v", thinned, tt.wantThinned)
+			}
+			for i, want := range tt.wantThinned {
+				got := thinned[i]
+				if want.Reason == "" {
+					// the reasons of the longer cases are left to the cases above
+					got.Reason = ""
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("thinned %d:\ngot  %+v\nwant %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestThinLeavesTheGroupsAlone(t *testing.T) {
+	groups := []NoteGroup{onset(0, 60, 50), onset(0.05, 62, 100)}
+	want := []NoteGroup{onset(0, 60, 50), onset(0.05, 62, 100)}
+
+	Thin(groups, 0.1, ByVelocity, nil)
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("got %+v, want the groups unchanged", groups)
+	}
+
+	kept, thinned := Thin(groups, 0, ByVelocity, nil)
+	if !reflect.DeepEqual(kept, want) || thinned != nil {
+		t.Errorf("without a gap: got %+v and %+v, want every onset kept", kept, thinned)
+	}
+}
@@ -0,0 +1,541 @@
+package midi
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+
+	gomidi "gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+// Pipeline is a chain of transforms applied to a Midi in order, built by chaining its methods:
+//
+//	pipeline := midi.Pipeline{}.RemoveTracks(drums).Transpose(-12, bass).Quantize(grid, 1, midi.Selector{})
+//	err := pipeline.Apply(&m)
+//
+// Every method returns a new pipeline, the zero value changes nothing.
+type Pipeline struct {
+	steps []pipelineStep
+}
+
+type pipelineStep struct {
+	name  string
+	apply func(m *Midi) error
+}
+
+func (p Pipeline) then(name string, apply func(m *Midi) error) Pipeline {
+	return Pipeline{steps: append(slices.Clip(p.steps), pipelineStep{name: name, apply: apply})}
+}
+
+func (p Pipeline) Len() int {
+	return len(p.steps)
+}
+
+// Apply runs the transforms in order and stops at the first one that fails
+func (p Pipeline) Apply(m *Midi) error {
+	for i, step := range p.steps {
+		if err := step.apply(m); err != nil {
+			return fmt.Errorf("transform %d (%s): %w", i+1, step.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (p Pipeline) Transpose(semitones int, selector Selector) Pipeline {
+	return p.then("transpose", func(m *Midi) error {
+		m.Transpose(semitones, selector)
+		return nil
+	})
+}
+
+func (p Pipeline) VelocityScale(factor float64, selector Selector) Pipeline {
+	return p.then("velocity_scale", func(m *Midi) error {
+		return m.VelocityScale(factor, selector)
+	})
+}
+
+func (p Pipeline) MergeTracks(selector Selector) Pipeline {
+	return p.then("merge_tracks", func(m *Midi) error {
+		m.MergeTracks(selector)
+		return nil
+	})
+}
+
+func (p Pipeline) SplitByChannel(selector Selector) Pipeline {
+	return p.then("split_by_channel", func(m *Midi) error {
+		m.SplitByChannel(selector)
+		return nil
+	})
+}
+
+func (p Pipeline) TimeStretch(factor float64) Pipeline {
+	return p.then("time_stretch", func(m *Midi) error {
+		return m.TimeStretch(factor)
+	})
+}
+
+func (p Pipeline) Slice(startSec, endSec float64) Pipeline {
+	return p.then("slice", func(m *Midi) error {
+		return m.Slice(startSec, endSec)
+	})
+}
+
+func (p Pipeline) Quantize(grid Grid, strength float64, selector Selector) Pipeline {
+	return p.then("quantize", func(m *Midi) error {
+		return m.Quantize(grid, strength, selector)
+	})
+}
+
+func (p Pipeline) Humanize(humanization Humanization, selector Selector) Pipeline {
+	return p.then("humanize", func(m *Midi) error {
+		return m.Humanize(humanization, selector)
+	})
+}
+
+func (p Pipeline) RemoveTracks(selector Selector) Pipeline {
+	return p.then("remove_tracks", func(m *Midi) error {
+		m.RemoveTracks(selector)
+		return nil
+	})
+}
+
+// TransformSpec declares a transform in a config file, each type only uses some of the fields:
+//
+//	transpose         select, semitones
+//	velocity_scale    select, factor
+//	merge_tracks      select
+//	split_by_channel  select
+//	time_stretch      factor
+//	slice             start_sec, end_sec (0 for the end of the file)
+//	quantize          select, grid, swing, strength (0 means 1)
+//	humanize          select, timing_ms, velocity, seed
+//	remove_tracks     select
+//
+// select is written like ParseSelector expects it and grid like ParseGrid expects it.
+type TransformSpec struct {
+	Type      string  `json:"type"`
+	Select    string  `json:"select,omitempty"`
+	Semitones int     `json:"semitones,omitempty"`
+	Factor    float64 `json:"factor,omitempty"`
+	StartSec  float64 `json:"start_sec,omitempty"`
+	EndSec    float64 `json:"end_sec,omitempty"`
+	Grid      string  `json:"grid,omitempty"`
+	Swing     float64 `json:"swing,omitempty"`
+	Strength  float64 `json:"strength,omitempty"`
+	TimingMs  float64 `json:"timing_ms,omitempty"`
+	Velocity  int     `json:"velocity,omitempty"`
+	Seed      uint64  `json:"seed,omitempty"`
+}
+
+// NewPipeline builds the pipeline the specs declare, everything that can be checked without a file is checked here
+func NewPipeline(specs []TransformSpec) (Pipeline, error) {
+	var pipeline Pipeline
+
+	for i, spec := range specs {
+		var err error
+		pipeline, err = pipeline.add(spec)
+		if err != nil {
+			return Pipeline{}, fmt.Errorf("transform %d (%s): %w", i+1, spec.Type, err)
+		}
+	}
+
+	return pipeline, nil
+}
+
+func (p Pipeline) add(spec TransformSpec) (Pipeline, error) {
+	selector, err := ParseSelector(spec.Select)
+	if err != nil {
+		return Pipeline{}, err
+	}
+
+	switch spec.Type {
+	case "transpose":
+		return p.Transpose(spec.Semitones, selector), nil
+
+	case "velocity_scale":
+		return p.VelocityScale(spec.Factor, selector), validateFactor(spec.Factor)
+
+	case "merge_tracks":
+		return p.MergeTracks(selector), nil
+
+	case "split_by_channel":
+		return p.SplitByChannel(selector), nil
+
+	case "time_stretch":
+		return p.TimeStretch(spec.Factor), validateFactor(spec.Factor)
+
+	case "slice":
+		endSec := spec.EndSec
+		if endSec == 0 {
+			endSec = math.Inf(1)
+		}
+		return p.Slice(spec.StartSec, endSec), validateSlice(spec.StartSec, endSec)
+
+	case "quantize":
+		grid, err := ParseGrid(spec.Grid)
+		if err != nil {
+			return Pipeline{}, err
+		}
+		grid.Swing = spec.Swing
+
+		strength := spec.Strength
+		if strength == 0 {
+			strength = 1
+		}
+
+		return p.Quantize(grid, strength, selector), cmp.Or(grid.validate(), validateStrength(strength))
+
+	case "humanize":
+		humanization := Humanization{TimingSec: spec.TimingMs / 1000, Velocity: spec.Velocity, Seed: spec.Seed}
+		return p.Humanize(humanization, selector), humanization.validate()
+
+	case "remove_tracks":
+		return p.RemoveTracks(selector), nil
+
+	default:
+		return Pipeline{}, fmt.Errorf("%w: unknown type %q", ErrInvalidTransform, spec.Type)
+	}
+}
+
+func validateFactor(factor float64) error {
+	if factor <= 0 || math.IsInf(factor, 0) || math.IsNaN(factor) {
+		return fmt.Errorf("%w: factor %v, has to be positive", ErrInvalidTransform, factor)
+	}
+
+	return nil
+}
+
+func validateSlice(startSec, endSec float64) error {
+	if startSec < 0 || endSec <= startSec {
+		return fmt.Errorf("%w: slice from %vs to %vs", ErrInvalidTransform, startSec, endSec)
+	}
+
+	return nil
+}
+
+// Transpose moves the notes picked by the selector by semitones, notes moved out of the MIDI range are dropped.
+// Notes on the drum channel stay where they are, their pitch picks the drum.
+func (m *Midi) Transpose(semitones int, selector Selector) {
+	programChanges := m.programChanges()
+
+	for trIdx, tr := range m.smf.Tracks {
+		if !selector.matchesTrack(trIdx, m.TrackName(trIdx)) {
+			continue
+		}
+
+		events := absoluteEvents(tr)
+		dropped := make([]bool, len(events))
+
+		for _, note := range trackNotes(tr, trIdx, programChanges) {
+			if note.Channel == DrumChannel || !selector.matchesNote(note.Note) {
+				continue
+			}
+
+			pitch := int(note.Pitch) + semitones
+			if pitch < 0 || pitch > 127 {
+				dropped[note.on] = true
+				if note.off >= 0 {
+					dropped[note.off] = true
+				}
+				continue
+			}
+
+			events[note.on].message = withData(events[note.on].message, 1, uint8(pitch))
+			if note.off >= 0 {
+				events[note.off].message = withData(events[note.off].message, 1, uint8(pitch))
+			}
+		}
+
+		var kept []absEvent
+		for i, ev := range events {
+			if !dropped[i] {
+				kept = append(kept, ev)
+			}
+		}
+
+		m.smf.Tracks[trIdx] = relativeTrack(kept, trackEndTick(tr))
+	}
+}
+
+// VelocityScale multiplies the velocities of the notes picked by the selector by factor, keeping them between 1 and 127
+func (m *Midi) VelocityScale(factor float64, selector Selector) error {
+	if err := validateFactor(factor); err != nil {
+		return err
+	}
+
+	programChanges := m.programChanges()
+
+	for trIdx, tr := range m.smf.Tracks {
+		if !selector.matchesTrack(trIdx, m.TrackName(trIdx)) {
+			continue
+		}
+
+		tr = slices.Clone(tr)
+		for _, note := range trackNotes(tr, trIdx, programChanges) {
+			if !selector.matchesNote(note.Note) {
+				continue
+			}
+
+			velocity := max(1, min(127, math.Round(float64(note.Velocity)*factor)))
+			tr[note.on].Message = withData(tr[note.on].Message, 2, uint8(velocity))
+		}
+
+		m.smf.Tracks[trIdx] = tr
+	}
+
+	return nil
+}
+
+// MergeTracks merges the tracks picked by the selector into the first of them, every event keeps its time.
+// Events sharing a tick stay in the order of their tracks.
+func (m *Midi) MergeTracks(selector Selector) {
+	trackIndexes := m.SelectTracks(selector)
+	if len(trackIndexes) < 2 {
+		return
+	}
+
+	var (
+		merged  []absEvent
+		endTick int64
+	)
+	for _, trIdx := range trackIndexes {
+		merged = append(merged, absoluteEvents(m.smf.Tracks[trIdx])...)
+		endTick = max(endTick, trackEndTick(m.smf.Tracks[trIdx]))
+	}
+
+	var tracks []smf.Track
+	for trIdx, tr := range m.smf.Tracks {
+		switch {
+		case trIdx == trackIndexes[0]:
+			tracks = append(tracks, relativeTrack(merged, endTick))
+		case !slices.Contains(trackIndexes, trIdx):
+			tracks = append(tracks, tr)
+		}
+	}
+
+	m.smf.Tracks = tracks
+}
+
+// SplitByChannel gives every channel of the tracks picked by the selector a track of its own, right where the track
+// was. Events without a channel, like the track name or tempo changes, stay with the first channel of the track.
+func (m *Midi) SplitByChannel(selector Selector) {
+	selectedTracks := m.trackSet(selector)
+
+	var tracks []smf.Track
+
+	for trIdx, tr := range m.smf.Tracks {
+		if !selectedTracks[trIdx] {
+			tracks = append(tracks, tr)
+			continue
+		}
+
+		var (
+			channels  []uint8
+			byChannel = make(map[uint8][]absEvent)
+			other     []absEvent
+		)
+		for _, ev := range absoluteEvents(tr) {
+			var channel uint8
+			if !ev.message.GetChannel(&channel) {
+				other = append(other, ev)
+				continue
+			}
+
+			if !slices.Contains(channels, channel) {
+				channels = append(channels, channel)
+			}
+			byChannel[channel] = append(byChannel[channel], ev)
+		}
+
+		if len(channels) < 2 {
+			tracks = append(tracks, tr)
+			continue
+		}
+
+		name := m.TrackName(trIdx)
+		for i, channel := range channels {
+			events := byChannel[channel]
+
+			switch {
+			case i == 0:
+				events = slices.Concat(other, events)
+			case name != "":
+				events = slices.Concat([]absEvent{{message: smf.MetaTrackSequenceName(fmt.Sprintf("%s (channel %d)", name, channel+1))}}, events)
+			}
+
+			tracks = append(tracks, relativeTrack(events, trackEndTick(tr)))
+		}
+	}
+
+	m.smf.Tracks = tracks
+}
+
+// TimeStretch makes the file factor times as long by scaling its tempo, the notes keep their place on the beat grid.
+// Audio that goes with the file has to be synthesized again to match.
+func (m *Midi) TimeStretch(factor float64) error {
+	if err := validateFactor(factor); err != nil {
+		return err
+	}
+
+	hasInitialTempo := false
+
+	for trIdx, tr := range m.smf.Tracks {
+		tr = slices.Clone(tr)
+
+		var absTicks int64
+		for i, ev := range tr {
+			absTicks += int64(ev.Delta)
+
+			var bpm float64
+			if ev.Message.GetMetaTempo(&bpm) && bpm > 0 {
+				tr[i].Message = smf.MetaTempo(bpm / factor)
+				hasInitialTempo = hasInitialTempo || absTicks == 0
+			}
+		}
+
+		m.smf.Tracks[trIdx] = tr
+	}
+
+	// the default tempo applies until the first tempo change
+	if !hasInitialTempo && len(m.smf.Tracks) > 0 {
+		m.smf.Tracks[0] = slices.Concat(smf.Track{{Message: smf.MetaTempo(defaultBPM / factor)}}, m.smf.Tracks[0])
+	}
+
+	return nil
+}
+
+// Slice keeps what happens between startSec and endSec and moves it to the start of the file. The tempo, the
+// time signature, the programs and the controllers in effect at startSec are set again at the start. Notes
+// starting before startSec are dropped, notes still sounding at endSec are released there. An endSec past the
+// end of the file slices up to the end.
+func (m *Midi) Slice(startSec, endSec float64) error {
+	if err := validateSlice(startSec, endSec); err != nil {
+		return err
+	}
+
+	tempoMap := m.TempoMap()
+	startTick := int64(math.Round(tempoMap.SecondsToTick(startSec)))
+	endTick := int64(math.Round(tempoMap.SecondsToTick(min(endSec, m.Duration()))))
+	if endTick <= startTick {
+		return fmt.Errorf("%w: slice from %vs starts after the end of the file at %.3fs", ErrInvalidTransform, startSec, m.Duration())
+	}
+
+	for trIdx, tr := range m.smf.Tracks {
+		m.smf.Tracks[trIdx] = sliceTrack(tr, startTick, endTick, false)
+	}
+
+	return nil
+}
+
+// sliceTrack keeps the events of the track from startTick up to endTick, moved back by startTick, with the state
+// at startTick set at the start. The events at endTick are kept too if keepEnd is set. Notes starting before
+// startTick are dropped and notes still sounding at endTick are released there, the end of track is at endTick.
+func sliceTrack(tr smf.Track, startTick, endTick int64, keepEnd bool) smf.Track {
+	events := absoluteEvents(tr)
+	inSlice := func(tick int64) bool {
+		return tick < endTick || keepEnd && tick == endTick
+	}
+
+	// the note-offs to drop, of notes starting before the slice, and the notes to release at its end
+	droppedOffs := make(map[int]bool)
+	var released []absEvent
+
+	for _, note := range trackNotes(tr, 0, nil) {
+		switch {
+		case events[note.on].tick < startTick:
+			droppedOffs[note.off] = true
+		case inSlice(events[note.on].tick) && (note.off < 0 || !inSlice(events[note.off].tick)):
+			released = append(released, absEvent{tick: endTick - startTick, message: smf.Message(gomidi.NoteOff(note.Channel, note.Pitch))})
+		}
+	}
+
+	var sliced []absEvent
+	for i, ev := range events {
+		switch {
+		case ev.tick < startTick:
+			if isState(ev.message) {
+				sliced = append(sliced, absEvent{message: ev.message})
+			}
+		case inSlice(ev.tick) && !droppedOffs[i]:
+			sliced = append(sliced, absEvent{tick: ev.tick - startTick, message: ev.message})
+		}
+	}
+
+	return relativeTrack(slices.Concat(sliced, released), endTick-startTick)
+}
+
+// isState reports whether the message changes how the notes after it sound or are timed
+func isState(msg smf.Message) bool {
+	switch {
+	case msg.GetMetaTempo(nil), msg.GetMetaMeter(nil, nil), msg.Is(smf.MetaKeySigMsg),
+		msg.GetMetaTrackName(nil), msg.GetMetaInstrument(nil):
+		return true
+	case msg.GetProgramChange(nil, nil), msg.GetControlChange(nil, nil, nil), msg.GetPitchBend(nil, nil, nil):
+		return true
+	default:
+		return false
+	}
+}
+
+// absEvent is an event of a track with its absolute tick
+type absEvent struct {
+	tick    int64
+	message smf.Message
+}
+
+func absoluteEvents(tr smf.Track) []absEvent {
+	events := make([]absEvent, len(tr))
+
+	var absTicks int64
+	for i, ev := range tr {
+		absTicks += int64(ev.Delta)
+		events[i] = absEvent{tick: absTicks, message: ev.Message}
+	}
+
+	return events
+}
+
+// relativeTrack turns events with absolute ticks back into a track, events sharing a tick keep their order.
+// The end of track goes after the last event, but not before endTick.
+func relativeTrack(events []absEvent, endTick int64) smf.Track {
+	slices.SortStableFunc(events, func(a, b absEvent) int {
+		return cmp.Compare(a.tick, b.tick)
+	})
+
+	var (
+		tr           smf.Track
+		previousTick int64
+	)
+	for _, ev := range events {
+		if ev.message.Type() == smf.MetaEndOfTrackMsg {
+			continue
+		}
+
+		tr = append(tr, smf.Event{Delta: uint32(ev.tick - previousTick), Message: ev.message})
+		previousTick = ev.tick
+	}
+
+	return append(tr, smf.Event{Delta: uint32(max(0, endTick-previousTick)), Message: smf.EOT})
+}
+
+// trackEndTick returns the absolute tick of the last event of the track
+func trackEndTick(tr smf.Track) int64 {
+	var absTicks int64
+	for _, ev := range tr {
+		absTicks += int64(ev.Delta)
+	}
+
+	return absTicks
+}
+
+// withData returns a copy of the channel message with one of its data bytes replaced, 1 is the pitch of a note
+// message and 2 its velocity
+func withData(msg smf.Message, idx int, value uint8) smf.Message {
+	msg = slices.Clone(msg)
+	msg[idx] = value
+
+	return msg
+}
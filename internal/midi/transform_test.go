@@ -0,0 +1,329 @@
+package midi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	gomidi "gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+// transformTestMidi has a track "keys" playing channels 1 and 2 and a track "drums" on the drum channel
+func transformTestMidi(t *testing.T) Midi {
+	t.Helper()
+
+	return testMidi(t,
+		testTrack(1920,
+			testEvent{0, smf.MetaTrackSequenceName("keys")},
+			on(0, 0, 60, 100),
+			testEvent{480, gomidi.ProgramChange(1, 32)},
+			on(480, 1, 48, 80),
+			off(960, 0, 60),
+			off(960, 1, 48),
+			on(960, 0, 120, 127),
+			off(1440, 0, 120),
+		),
+		testTrack(1920,
+			testEvent{0, smf.MetaTrackSequenceName("drums")},
+			on(0, DrumChannel, 36, 100),
+			off(240, DrumChannel, 36),
+			on(960, DrumChannel, 38, 90),
+			off(1200, DrumChannel, 38),
+		),
+	)
+}
+
+// summarizeNotes writes every note as "track:channel/pitch velocity @start+length", channels counted from 1
+// and times in ticks of testMidi at its default tempo
+func summarizeNotes(m Midi) []string {
+	var summary []string
+	for _, note := range m.ExtractNotes(Selector{}) {
+		summary = append(summary, fmt.Sprintf("%d:%d/%d v%d @%v+%v",
+			note.Track, note.Channel+1, note.Pitch, note.Velocity, math.Round(note.Time*960), math.Round(note.Duration*960)))
+	}
+
+	return summary
+}
+
+func trackNames(m Midi) []string {
+	var names []string
+	for trIdx := range m.TrackCount() {
+		names = append(names, m.TrackName(trIdx))
+	}
+
+	return names
+}
+
+func mustParseSelector(t *testing.T, s string) Selector {
+	t.Helper()
+
+	selector, err := ParseSelector(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return selector
+}
+
+// transformTest applies a transform to transformTestMidi and checks the notes and track names after it
+type transformTest struct {
+	name       string
+	apply      func(m *Midi) error
+	wantNotes  []string
+	wantTracks []string // the track names, unchanged if nil
+}
+
+func runTransformTests(t *testing.T, tests []transformTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := transformTestMidi(t)
+			if err := tt.apply(&m); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := summarizeNotes(m); !reflect.DeepEqual(got, tt.wantNotes) {
+				t.Errorf("notes:\ngot  %q\nwant %q", got, tt.wantNotes)
+			}
+
+			wantTracks := tt.wantTracks
+			if wantTracks == nil {
+				wantTracks = []string{"keys", "drums"}
+			}
+			if got := trackNames(m); !reflect.DeepEqual(got, wantTracks) {
+				t.Errorf("tracks: got %q, want %q", got, wantTracks)
+			}
+		})
+	}
+}
+
+func TestTransformTestMidi(t *testing.T) {
+	want := []string{"0:1/60 v100 @0+960", "1:10/36 v100 @0+240", "0:2/48 v80 @480+480", "0:1/120 v127 @960+480", "1:10/38 v90 @960+240"}
+	if got := summarizeNotes(transformTestMidi(t)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	runTransformTests(t, []transformTest{
+		{
+			name:  "up an octave, drums stay and notes out of range are dropped",
+			apply: func(m *Midi) error { m.Transpose(12, Selector{}); return nil },
+			wantNotes: []string{
+				"0:1/72 v100 @0+960", "1:10/36 v100 @0+240", "0:2/60 v80 @480+480", "1:10/38 v90 @960+240",
+			},
+		},
+		{
+			name:  "down on one channel",
+			apply: func(m *Midi) error { m.Transpose(-12, mustParseSelector(t, "channel=2")); return nil },
+			wantNotes: []string{
+				"0:1/60 v100 @0+960", "1:10/36 v100 @0+240", "0:2/36 v80 @480+480", "0:1/120 v127 @960+480", "1:10/38 v90 @960+240",
+			},
+		},
+	})
+}
+
+func TestVelocityScale(t *testing.T) {
+	runTransformTests(t, []transformTest{
+		{
+			name:  "louder, up to 127",
+			apply: func(m *Midi) error { return m.VelocityScale(1.2, Selector{}) },
+			wantNotes: []string{
+				"0:1/60 v120 @0+960", "1:10/36 v120 @0+240", "0:2/48 v96 @480+480", "0:1/120 v127 @960+480", "1:10/38 v108 @960+240",
+			},
+		},
+		{
+			name:  "quieter, down to 1",
+			apply: func(m *Midi) error { return m.VelocityScale(0.001, mustParseSelector(t, "track=1")) },
+			wantNotes: []string{
+				"0:1/60 v100 @0+960", "1:10/36 v1 @0+240", "0:2/48 v80 @480+480", "0:1/120 v127 @960+480", "1:10/38 v1 @960+240",
+			},
+		},
+	})
+
+	m := transformTestMidi(t)
+	if err := m.VelocityScale(0, Selector{}); !errors.Is(err, ErrInvalidTransform) {
+		t.Errorf("got %v, want ErrInvalidTransform", err)
+	}
+}
+
+func TestMergeTracks(t *testing.T) {
+	runTransformTests(t, []transformTest{
+		{
+			name:  "into the first track",
+			apply: func(m *Midi) error { m.MergeTracks(Selector{}); return nil },
+			wantNotes: []string{
+				"0:1/60 v100 @0+960", "0:10/36 v100 @0+240", "0:2/48 v80 @480+480", "0:1/120 v127 @960+480", "0:10/38 v90 @960+240",
+			},
+			wantTracks: []string{"keys"},
+		},
+		{
+			name:  "a single track stays",
+			apply: func(m *Midi) error { m.MergeTracks(TrackSelector(1)); return nil },
+			wantNotes: []string{
+				"0:1/60 v100 @0+960", "1:10/36 v100 @0+240", "0:2/48 v80 @480+480", "0:1/120 v127 @960+480", "1:10/38 v90 @960+240",
+			},
+		},
+	})
+}
+
+func TestSplitByChannel(t *testing.T) {
+	runTransformTests(t, []transformTest{
+		{
+			name:  "one track per channel",
+			apply: func(m *Midi) error { m.SplitByChannel(Selector{}); return nil },
+			wantNotes: []string{
+				"0:1/60 v100 @0+960", "2:10/36 v100 @0+240", "1:2/48 v80 @480+480", "0:1/120 v127 @960+480", "2:10/38 v90 @960+240",
+			},
+			wantTracks: []string{"keys", "keys (channel 2)", "drums"},
+		},
+	})
+
+	// the program change of channel 2 goes along with it
+	m := transformTestMidi(t)
+	m.SplitByChannel(Selector{})
+	if notes := m.ExtractNotes(TrackSelector(1)); len(notes) != 1 || notes[0].Program != 32 {
+		t.Errorf("got %+v, want the note of channel 2 with program 32", notes)
+	}
+}
+
+func TestTimeStretch(t *testing.T) {
+	runTransformTests(t, []transformTest{
+		{
+			name:  "twice as long",
+			apply: func(m *Midi) error { return m.TimeStretch(2) },
+			wantNotes: []string{
+				"0:1/60 v100 @0+1920", "1:10/36 v100 @0+480", "0:2/48 v80 @960+960", "0:1/120 v127 @1920+960", "1:10/38 v90 @1920+480",
+			},
+		},
+		{
+			name: "a tempo change of the file is scaled too",
+			apply: func(m *Midi) error {
+				m.smf.Tracks[0] = append(smf.Track{{Message: smf.MetaTempo(60)}}, m.smf.Tracks[0]...)
+				return m.TimeStretch(0.5)
+			},
+			wantNotes: []string{
+				"0:1/60 v100 @0+960", "1:10/36 v100 @0+240", "0:2/48 v80 @480+480", "0:1/120 v127 @960+480", "1:10/38 v90 @960+240",
+			},
+		},
+	})
+}
+
+func TestSlice(t *testing.T) {
+	runTransformTests(t, []transformTest{
+		{
+			// notes starting before the slice are dropped, the ones sounding at its end are released there
+			name:      "middle",
+			apply:     func(m *Midi) error { return m.Slice(0.25, 1.25) },
+			wantNotes: []string{"0:2/48 v80 @240+480", "0:1/120 v127 @720+240", "1:10/38 v90 @720+240"},
+		},
+		{
+			name:      "up to the end of the file",
+			apply:     func(m *Midi) error { return m.Slice(1, math.Inf(1)) },
+			wantNotes: []string{"0:1/120 v127 @0+480", "1:10/38 v90 @0+240"},
+		},
+	})
+
+	// the program of channel 2 set before the slice is set again at its start
+	m := transformTestMidi(t)
+	if err := m.Slice(0.25, 1.25); err != nil {
+		t.Fatal(err)
+	}
+	if notes := m.ExtractNotes(mustParseSelector(t, "channel=2")); len(notes) != 1 || notes[0].Program != 32 {
+		t.Errorf("got %+v, want the note of channel 2 with program 32", notes)
+	}
+
+	for _, bounds := range [][2]float64{{1, 1}, {-1, 1}, {3, 4}} {
+		m := transformTestMidi(t)
+		if err := m.Slice(bounds[0], bounds[1]); !errors.Is(err, ErrInvalidTransform) {
+			t.Errorf("slice %v: got %v, want ErrInvalidTransform", bounds, err)
+		}
+	}
+}
+
+func TestQuantizeTransform(t *testing.T) {
+	// quarters swung by a third put the second line of each pair at tick 640, note-offs move along with their notes
+	swing := Grid{Division: 4, Swing: 1.0 / 3}
+
+	runTransformTests(t, []transformTest{
+		{
+			name:  "onto the grid",
+			apply: func(m *Midi) error { return Pipeline{}.Quantize(swing, 1, Selector{}).Apply(m) },
+			wantNotes: []string{
+				"0:1/60 v100 @0+960", "1:10/36 v100 @0+240", "0:2/48 v80 @640+480", "0:1/120 v127 @960+480", "1:10/38 v90 @960+240",
+			},
+		},
+		{
+			name: "half way on one channel",
+			apply: func(m *Midi) error {
+				return Pipeline{}.Quantize(swing, 0.5, mustParseSelector(t, "channel=2")).Apply(m)
+			},
+			wantNotes: []string{
+				"0:1/60 v100 @0+960", "1:10/36 v100 @0+240", "0:2/48 v80 @560+480", "0:1/120 v127 @960+480", "1:10/38 v90 @960+240",
+			},
+		},
+	})
+}
+
+func TestRemoveTracks(t *testing.T) {
+	allNotes := []string{"0:1/60 v100 @0+960", "1:10/36 v100 @0+240", "0:2/48 v80 @480+480", "0:1/120 v127 @960+480", "1:10/38 v90 @960+240"}
+
+	runTransformTests(t, []transformTest{
+		{
+			name:       "by name",
+			apply:      func(m *Midi) error { m.RemoveTracks(mustParseSelector(t, "name=drum")); return nil },
+			wantNotes:  []string{"0:1/60 v100 @0+960", "0:2/48 v80 @480+480", "0:1/120 v127 @960+480"},
+			wantTracks: []string{"keys"},
+		},
+		{
+			name:      "an empty selector removes nothing",
+			apply:     func(m *Midi) error { m.RemoveTracks(Selector{}); return nil },
+			wantNotes: allNotes,
+		},
+		{
+			name:      "a selector matching no track removes nothing",
+			apply:     func(m *Midi) error { m.RemoveTracks(mustParseSelector(t, "name=strings")); return nil },
+			wantNotes: allNotes,
+		},
+	})
+}
+
+func TestNewPipeline(t *testing.T) {
+	pipeline, err := NewPipeline([]TransformSpec{
+		{Type: "remove_tracks", Select: "name=drums"},
+		{Type: "transpose", Semitones: -12, Select: "channel=1"},
+		{Type: "velocity_scale", Factor: 0.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pipeline.Len() != 3 {
+		t.Errorf("got %d steps, want 3", pipeline.Len())
+	}
+
+	m := transformTestMidi(t)
+	if err := pipeline.Apply(&m); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0:1/48 v50 @0+960", "0:2/48 v40 @480+480", "0:1/108 v64 @960+480"}
+	if got := summarizeNotes(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, spec := range []TransformSpec{
+		{Type: "nope"},
+		{Type: "time_stretch"},
+		{Type: "slice", StartSec: 5, EndSec: 2},
+		{Type: "quantize", Grid: "1/0"},
+		{Type: "humanize", TimingMs: -1},
+		{Type: "transpose", Select: "pitch=200"},
+	} {
+		if _, err := NewPipeline([]TransformSpec{spec}); err == nil {
+			t.Errorf("%+v: expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package sim
+
+import (
+	"sort"
+)
+
+// length of the camera pulse on a downbeat
+const beatPulseDurationSec = 0.25
+
+// beatPulse returns how much the camera is zoomed in at timeSec by the latest downbeat, it fades out quadratically.
+// It only depends on the time so it stays in sync with seeking and rendering.
+func (s *Simulation) beatPulse(timeSec float64) float32 {
+	downbeatIdx := sort.Search(len(s.downbeats), func(i int) bool {
+		return s.downbeats[i] > timeSec
+	}) - 1
+	if downbeatIdx < 0 {
+		return 0
+	}
+
+	sinceDownbeatSec := timeSec - s.downbeats[downbeatIdx]
+	if sinceDownbeatSec >= beatPulseDurationSec {
+		return 0
+	}
+
+	fade := float32(1 - sinceDownbeatSec/beatPulseDurationSec)
+	return s.cfg.BeatPulse * fade * fade
+}
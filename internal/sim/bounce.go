@@ -1,6 +1,8 @@
 package sim
 
 import (
+	"ray_midi_sim/internal/canvas"
+
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
@@ -13,6 +15,7 @@ const (
 
 type Bounce struct {
 	id              int
+	square          int // index of the square that bounces
 	timeSec         float64
 	position        rl.Vector2
 	nextDirection   rl.Vector2
@@ -23,18 +26,22 @@ type Bounce struct {
 	isFloating     bool
 }
 
+func (b Bounce) Square() int {
+	return b.square
+}
+
 func (b Bounce) IsFloating() bool {
 	return b.isFloating
 }
 
-func (b *Bounce) Draw() {
-	rect := b.ToRect()
-	rl.DrawRectangleRec(rect, rl.Blue)
-	rl.DrawRectangleLinesEx(rect, 1, rl.Black)
+func (b *Bounce) Draw(c canvas.Canvas, cfg Config) {
+	rect := canvas.Rect(b.ToRect(cfg))
+	c.DrawRectangle(rect, rl.Blue)
+	c.DrawRectangleLines(rect, 1, rl.Black)
 }
 
-func (b Bounce) ToCollisionRect() rl.Rectangle {
-	bounceRect := b.ToRect()
+func (b Bounce) ToCollisionRect(cfg Config) rl.Rectangle {
+	bounceRect := b.ToRect(cfg)
 
 	const OFFSET float32 = 1
 
@@ -60,44 +67,51 @@ func (b Bounce) ToCollisionRect() rl.Rectangle {
 	return bounceRect
 }
 
-func (b Bounce) ToRect() rl.Rectangle {
+func (b Bounce) ToRect(cfg Config) rl.Rectangle {
+	squareSize := float32(cfg.SquareSize)
+	halfSquareSize := float32(cfg.SquareSize / 2)
+
+	rectWidth := float32(cfg.BounceRectWidth)
+	rectHeight := float32(cfg.BounceRectHeight)
+	halfRectHeight := float32(cfg.BounceRectHeight / 2)
+
 	switch b.bounceDirection {
 	case HorizontalBounce:
 		if b.nextDirection.X == 1 {
 			// left wall
 			return rl.NewRectangle(
-				b.position.X-BOUNCE_RECT_WIDTH,
-				b.position.Y+SQUARE_SIZE/2-BOUNCE_RECT_HEIGHT/2,
-				BOUNCE_RECT_WIDTH,
-				BOUNCE_RECT_HEIGHT,
+				b.position.X-rectWidth,
+				b.position.Y+halfSquareSize-halfRectHeight,
+				rectWidth,
+				rectHeight,
 			)
 
 		} else if b.nextDirection.X == -1 {
 			// right wall
 			return rl.NewRectangle(
-				b.position.X+SQUARE_SIZE,
-				b.position.Y+SQUARE_SIZE/2-BOUNCE_RECT_HEIGHT/2,
-				BOUNCE_RECT_WIDTH,
-				BOUNCE_RECT_HEIGHT,
+				b.position.X+squareSize,
+				b.position.Y+halfSquareSize-halfRectHeight,
+				rectWidth,
+				rectHeight,
 			)
 		}
 	case VerticalBounce:
 		if b.nextDirection.Y == 1 {
 			// top wall
 			return rl.NewRectangle(
-				b.position.X+SQUARE_SIZE/2-BOUNCE_RECT_HEIGHT/2,
-				b.position.Y-BOUNCE_RECT_WIDTH,
-				BOUNCE_RECT_HEIGHT,
-				BOUNCE_RECT_WIDTH,
+				b.position.X+halfSquareSize-halfRectHeight,
+				b.position.Y-rectWidth,
+				rectHeight,
+				rectWidth,
 			)
 
 		} else if b.nextDirection.Y == -1 {
 			// bottom wall
 			return rl.NewRectangle(
-				b.position.X+SQUARE_SIZE/2-BOUNCE_RECT_HEIGHT/2,
-				b.position.Y+SQUARE_SIZE,
-				BOUNCE_RECT_HEIGHT,
-				BOUNCE_RECT_WIDTH,
+				b.position.X+halfSquareSize-halfRectHeight,
+				b.position.Y+squareSize,
+				rectHeight,
+				rectWidth,
 			)
 		}
 	}
@@ -0,0 +1,94 @@
+package sim
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// MapCache stores generated maps on disk in the binary map format, keyed by what the map was generated from
+type MapCache struct {
+	dir string
+}
+
+func NewMapCache(dir string) MapCache {
+	return MapCache{dir: dir}
+}
+
+// DefaultMapCacheDir returns the cache directory inside the user cache directory of the OS
+func DefaultMapCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cacheDir, "ray_midi_sim", "maps"), nil
+}
+
+// MapCacheKey hashes the note timestamps of every square together with every map param. Only maps with a fixed seed
+// are worth caching, a random seed (0) asks for a new map every time.
+func MapCacheKey(squareTimestamps [][]float64, params MapParams) string {
+	hash := sha256.New()
+
+	// maps saved in an older format are never looked up again
+	binary.Write(hash, binary.LittleEndian, uint32(mapFileVersion))
+
+	paramsJSON, _ := json.Marshal(params)
+	binary.Write(hash, binary.LittleEndian, uint32(len(paramsJSON)))
+	hash.Write(paramsJSON)
+
+	binary.Write(hash, binary.LittleEndian, uint32(len(squareTimestamps)))
+	for _, timestamps := range squareTimestamps {
+		binary.Write(hash, binary.LittleEndian, uint32(len(timestamps)))
+		for _, timestamp := range timestamps {
+			binary.Write(hash, binary.LittleEndian, math.Float64bits(timestamp))
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (c MapCache) path(key string) string {
+	return filepath.Join(c.dir, key+".bin")
+}
+
+// Load returns the cached map for key and false on a miss.
+// Unreadable entries, for example from an older version, count as a miss so they get generated and stored again.
+func (c MapCache) Load(key string) (Map, bool) {
+	m, err := LoadMap(c.path(key))
+	if err != nil {
+		return Map{}, false
+	}
+
+	return m, true
+}
+
+// Store saves the map under key, the file is renamed into place so a concurrent Load never sees half a map
+func (c MapCache) Store(key string, m Map) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+
+	if err := SaveMap(m, tempPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := os.Rename(tempPath, c.path(key)); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package sim
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"ray_midi_sim/internal/source"
+)
+
+func TestMapCacheRoundTrip(t *testing.T) {
+	cache := NewMapCache(filepath.Join(t.TempDir(), "maps"))
+	m := testMap(t)
+
+	if _, ok := cache.Load("abc"); ok {
+		t.Fatal("hit in an empty cache")
+	}
+
+	if err := cache.Store("abc", m); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := cache.Load("abc")
+	if !ok {
+		t.Fatal("miss after storing the map")
+	}
+	checkSameMap(t, got, m)
+
+	if _, ok := cache.Load("def"); ok {
+		t.Error("hit for another key")
+	}
+}
+
+func TestMapCacheCorruptEntry(t *testing.T) {
+	cache := NewMapCache(t.TempDir())
+	if err := os.WriteFile(cache.path("abc"), []byte("not a map"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cache.Load("abc"); ok {
+		t.Fatal("hit for a corrupt entry")
+	}
+
+	// storing again replaces it
+	if err := cache.Store("abc", testMap(t)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Load("abc"); !ok {
+		t.Error("miss after storing over the corrupt entry")
+	}
+}
+
+func TestMapCacheKey(t *testing.T) {
+	timestamps := [][]float64{{1, 2}, {3}}
+	params := testConfig(42).MapParams
+	key := MapCacheKey(timestamps, params)
+
+	if again := MapCacheKey([][]float64{{1, 2}, {3}}, params); again != key {
+		t.Errorf("the same input gave another key")
+	}
+
+	// every param is part of the key
+	v := reflect.ValueOf(&params).Elem()
+	for i := range v.NumField() {
+		changed := params
+		field := reflect.ValueOf(&changed).Elem().Field(i)
+		switch field.Kind() {
+		case reflect.Int, reflect.Int64:
+			field.SetInt(field.Int() + 1)
+		case reflect.Float32:
+			field.SetFloat(field.Float() + 0.125)
+		default:
+			t.Fatalf("no change for %s of kind %s", v.Type().Field(i).Name, field.Kind())
+		}
+
+		if MapCacheKey(timestamps, changed) == key {
+			t.Errorf("changing %s keeps the key", v.Type().Field(i).Name)
+		}
+	}
+
+	for name, changed := range map[string][][]float64{
+		"a moved timestamp":                 {{1, 2.001}, {3}},
+		"another timestamp":                 {{1, 2}, {3, 4}},
+		"a timestamp of another square":     {{1}, {2, 3}},
+		"the timestamps of a single square": {{1, 2, 3}},
+		"the squares swapped":               {{3}, {1, 2}},
+	} {
+		if MapCacheKey(changed, params) == key {
+			t.Errorf("%s keeps the key", name)
+		}
+	}
+}
+
+// maps of a random seed are never cached, each run generates a new one
+func TestGenerateMapUsesCacheForFixedSeeds(t *testing.T) {
+	timestampsPath := writeTempFile(t, "onsets.txt", "0.5 1 1.25 1.5 2 2.5 2.75 3")
+
+	generate := func(cache *MapCache, seed int64) Map {
+		t.Helper()
+
+		cfg := testConfig(seed)
+		s := New(cfg, "", "song.wav")
+		s.SetTimestampSources(source.NewText(timestampsPath))
+		s.SetMapCache(cache)
+
+		if err := s.generateMap(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return s.generatedMap
+	}
+
+	entries := func(cache MapCache) int {
+		t.Helper()
+
+		files, err := os.ReadDir(cache.dir)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return len(files)
+	}
+
+	t.Run("random seed", func(t *testing.T) {
+		cache := NewMapCache(filepath.Join(t.TempDir(), "maps"))
+
+		generate(&cache, 0)
+		if n := entries(cache); n != 0 {
+			t.Errorf("got %d cache entries, want none", n)
+		}
+	})
+
+	t.Run("fixed seed", func(t *testing.T) {
+		cache := NewMapCache(filepath.Join(t.TempDir(), "maps"))
+
+		first := generate(&cache, 42)
+		if n := entries(cache); n != 1 {
+			t.Fatalf("got %d cache entries, want 1", n)
+		}
+
+		// a map in the cache is taken from there, even a changed one
+		key := MapCacheKey([][]float64{{0.5, 1, 1.25, 1.5, 2, 2.5, 2.75, 3}}, testConfig(42).MapParams)
+		cached, ok := cache.Load(key)
+		if !ok {
+			t.Fatal("the map is not stored under the key of its notes and params")
+		}
+		cached.bounces = cached.bounces[:1]
+		if err := cache.Store(key, cached); err != nil {
+			t.Fatal(err)
+		}
+		if second := generate(&cache, 42); len(second.bounces) != 1 {
+			t.Errorf("got %d bounces, want the 1 of the cached map instead of the %d generated", len(second.bounces), len(first.bounces))
+		}
+	})
+}
@@ -3,18 +3,20 @@ package sim
 import (
 	"math"
 
+	"ray_midi_sim/internal/canvas"
+
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
 // TODO make camera a struct
 
-func followCameraSmooth(camera *rl.Camera2D, target rl.Vector2, dt float32) {
+func followCameraSmooth(camera *rl.Camera2D, target, offset rl.Vector2, dt float32) {
 	// TODO make these constants
 	minSpeed := 30        // minimum speed of the camera
 	minEffectLength := 10 // minimum distance to start the effect
 	fractionSpeed := 2.5  // speed of the camera effect
 
-	camera.Offset = WINDOW_CENTER_VECTOR
+	camera.Offset = offset
 	diff := rl.Vector2Subtract(target, camera.Target)
 	length := rl.Vector2Length(diff)
 
@@ -24,6 +26,16 @@ func followCameraSmooth(camera *rl.Camera2D, target rl.Vector2, dt float32) {
 	}
 }
 
+// toCanvasCamera converts the camera for the canvas, the two have the same fields
+func toCanvasCamera(camera rl.Camera2D) canvas.Camera {
+	return canvas.Camera{
+		Offset:   canvas.Vec2(camera.Offset),
+		Target:   canvas.Vec2(camera.Target),
+		Rotation: camera.Rotation,
+		Zoom:     camera.Zoom,
+	}
+}
+
 func GetCameraRect(camera rl.Camera2D, screenWidth, screenHeight int32) rl.Rectangle {
 	halfW := float32(screenWidth) * 0.5 / camera.Zoom
 	halfH := float32(screenHeight) * 0.5 / camera.Zoom
@@ -20,12 +20,12 @@ func (c Cell) ToRect() rl.Rectangle {
 	return rl.NewRectangle(c.pos.X, c.pos.Y, float32(c.size), float32(c.size))
 }
 
-func cellToPixelRect(cx, cy, w, h int) rl.Rectangle {
+func cellToPixelRect(cx, cy, w, h, cellSize int) rl.Rectangle {
 	return rl.Rectangle{
-		X:      float32(cx * CELL_SIZE),
-		Y:      float32(cy * CELL_SIZE),
-		Width:  float32(w * CELL_SIZE),
-		Height: float32(h * CELL_SIZE),
+		X:      float32(cx * cellSize),
+		Y:      float32(cy * cellSize),
+		Width:  float32(w * cellSize),
+		Height: float32(h * cellSize),
 	}
 }
 
@@ -33,16 +33,16 @@ func cellToPixelRect(cx, cy, w, h int) rl.Rectangle {
 // without overlapping safeAreas and within maxCellDistance of the start.
 //
 // rect is the *starting rectangle* in PIXEL space (for example, 3x2 cells at some position).
-// safeAreas are also in PIXEL space (e.g., walls).
+// safeAreas are also in PIXEL space (e.g., walls), safeAreaIndex indexes them by their slice index.
 // maxCellDistance is in *cells*. (If it’s in pixels, you’d handle it differently.)
 //
 // This function returns a slice of rl.Vector2, where each Vector2 is the top‐left corner
 // of a valid rectangle position *in pixel coordinates*.
-func findReachableCells(rect rl.Rectangle, safeAreas []rl.Rectangle, maxCellDistance int) []Cell {
+func findReachableCells(rect rl.Rectangle, safeAreas []rl.Rectangle, safeAreaIndex *spatialIndex, maxCellDistance, cellSize int) []Cell {
 	// 1) (Optional) Build a "max expansion" rectangle in pixel coordinates
 	//    so we can skip checking collisions against walls that are obviously out of range.
-	//    If maxCellDistance is in *cells*, multiply by CELL_SIZE:
-	maxDistancePx := float32(maxCellDistance * CELL_SIZE)
+	//    If maxCellDistance is in *cells*, multiply by cellSize:
+	maxDistancePx := float32(maxCellDistance * cellSize)
 	maxExpansionRect := rl.NewRectangle(
 		rect.X-maxDistancePx,
 		rect.Y-maxDistancePx,
@@ -51,33 +51,42 @@ func findReachableCells(rect rl.Rectangle, safeAreas []rl.Rectangle, maxCellDist
 	)
 
 	// Collect only relevant safeAreas (within the bounding box).
-	relevantSafeAreas := make([]rl.Rectangle, 0, len(safeAreas))
-	for _, sa := range safeAreas {
-		if rl.CheckCollisionRecs(maxExpansionRect, sa) {
-			relevantSafeAreas = append(relevantSafeAreas, sa)
+	var relevantSafeAreas []rl.Rectangle
+	safeAreaIndex.Query(maxExpansionRect, func(id int) bool {
+		if rl.CheckCollisionRecs(maxExpansionRect, safeAreas[id]) {
+			relevantSafeAreas = append(relevantSafeAreas, safeAreas[id])
 		}
-	}
+		return true
+	})
 
 	// 2) Convert the input "start rect" to *cell* coordinates.
 	//    The BFS will treat (startCx, startCy) as the top-left cell of the rectangle.
-	startCx := int(rect.X) / CELL_SIZE
-	startCy := int(rect.Y) / CELL_SIZE
+	startCx := int(rect.X) / cellSize
+	startCy := int(rect.Y) / cellSize
 
 	// Also figure out how many cells wide/tall this rect is.
-	widthInCells := int(rect.Width) / CELL_SIZE
-	heightInCells := int(rect.Height) / CELL_SIZE
+	widthInCells := int(rect.Width) / cellSize
+	heightInCells := int(rect.Height) / cellSize
 
 	// 3) BFS data structures
 	type queueEntry struct {
 		cx, cy int // which cell we occupy (top-left corner of the rectangle in cell coords)
 		dist   int // distance in "cells" from the start
 	}
-	visited := make(map[[2]int]bool)
+
+	// No cell can be further than maxCellDistance away on either axis,
+	// so visited is a dense grid centered on the start cell.
+	side := 2*maxCellDistance + 1
+	visited := make([]bool, side*side)
+	visitedIdx := func(cx, cy int) int {
+		return (cy-startCy+maxCellDistance)*side + (cx - startCx + maxCellDistance)
+	}
+
 	var result []Cell
 
 	// Begin BFS from the start cell
 	queue := []queueEntry{{cx: startCx, cy: startCy, dist: 0}}
-	visited[[2]int{startCx, startCy}] = true
+	visited[visitedIdx(startCx, startCy)] = true
 
 	// 4) BFS neighbor enqueuing
 	tryEnqueue := func(cx, cy, dist int) {
@@ -85,10 +94,10 @@ func findReachableCells(rect rl.Rectangle, safeAreas []rl.Rectangle, maxCellDist
 		if dist > maxCellDistance {
 			return
 		}
-		key := [2]int{cx, cy}
+		key := visitedIdx(cx, cy)
 		if !visited[key] {
 			// Convert this cell position to a rectangle in pixel space
-			checkRect := cellToPixelRect(cx, cy, widthInCells, heightInCells)
+			checkRect := cellToPixelRect(cx, cy, widthInCells, heightInCells, cellSize)
 			// If it doesn't collide with any relevant walls, add to queue
 			if !collidesWithAny(checkRect, relevantSafeAreas) {
 				visited[key] = true
@@ -105,9 +114,9 @@ func findReachableCells(rect rl.Rectangle, safeAreas []rl.Rectangle, maxCellDist
 		cx, cy, dist := current.cx, current.cy, current.dist
 
 		// **Here** we store the top‐left corner in *pixel* coordinates.
-		px := float32(cx * CELL_SIZE)
-		py := float32(cy * CELL_SIZE)
-		result = append(result, NewCell(px, py, CELL_SIZE))
+		px := float32(cx * cellSize)
+		py := float32(cy * cellSize)
+		result = append(result, NewCell(px, py, cellSize))
 
 		// Enqueue 4 neighbors: up, down, left, right (1 cell away)
 		tryEnqueue(cx, cy-1, dist+1)
@@ -0,0 +1,75 @@
+package sim
+
+const (
+	// fraction of the drift between the clock and the audio that is corrected whenever the stream steps
+	clockCorrection = 0.25
+
+	// drift above which the clock stops smoothing, after a stall or a frame hitch.
+	// GetMusicTimePlayed moves in steps of about a tenth of a second so it has to be larger than that.
+	clockResyncSec = 0.25
+)
+
+// Clock is the master time of the simulation. While the music plays it follows the played time of the stream,
+// which only moves in steps of the audio buffer size. It advances with the frame time and is pulled towards
+// the audio whenever the stream steps. The clock never goes backwards so bounces that were already applied stay valid.
+type Clock struct {
+	// estimated position of the audio, negative before the music starts
+	audioSec float64
+
+	// the visuals are delayed by this much, to make up for the latency of the audio output
+	offsetSec float64
+
+	// last played time of the stream, it is only exact at the moment it changes
+	playedSec float64
+}
+
+func NewClock(startSec float64, audioOffsetMs int) Clock {
+	return Clock{
+		audioSec:  startSec,
+		offsetSec: float64(audioOffsetMs) / 1000,
+	}
+}
+
+// AudioSec returns the estimated position of the audio
+func (c Clock) AudioSec() float64 {
+	return c.audioSec
+}
+
+// TimeSec returns the time the visuals show, the audio position minus the offset
+func (c Clock) TimeSec() float64 {
+	return c.audioSec - c.offsetSec
+}
+
+// Seek puts the clock at timeSec of the visuals, the only way to move it backwards
+func (c *Clock) Seek(timeSec float64) {
+	c.audioSec = timeSec + c.offsetSec
+	c.playedSec = c.audioSec
+}
+
+// Advance moves the clock by dt, used while no music is playing
+func (c *Clock) Advance(dt float64) {
+	c.audioSec += dt
+}
+
+// Sync moves the clock by dt and corrects it towards playedSec, the time the music stream has played
+func (c *Clock) Sync(dt, playedSec float64) {
+	predictedSec := c.audioSec + dt
+
+	if playedSec != c.playedSec {
+		c.playedSec = playedSec
+
+		drift := playedSec - predictedSec
+		switch {
+		case drift > clockResyncSec:
+			// the audio is ahead after a frame hitch, jump to it
+			predictedSec = playedSec
+		case drift > -clockResyncSec:
+			predictedSec += drift * clockCorrection
+		}
+	}
+
+	// if the stream does not step for a while it stalled, wait for it instead of running ahead
+	predictedSec = min(predictedSec, c.playedSec+clockResyncSec)
+
+	c.audioSec = max(c.audioSec, predictedSec)
+}
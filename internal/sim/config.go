@@ -0,0 +1,361 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ray_midi_sim/internal/audio"
+	"ray_midi_sim/internal/midi"
+	"ray_midi_sim/internal/source"
+
+	"github.com/BurntSushi/toml"
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"gopkg.in/yaml.v3"
+)
+
+// thinByNone turns off thinning the onsets
+const thinByNone = "none"
+
+// Config holds every tunable parameter of the simulation and the map generator
+type Config struct {
+	// general
+	WindowWidth  int `json:"window_width"`
+	WindowHeight int `json:"window_height"`
+	FPS          int `json:"fps"`
+
+	// simulation related
+	StartDelaySec float64 `json:"start_delay_sec"`
+	AudioOffsetMs int     `json:"audio_offset_ms"` // delays the visuals to make up for the audio output latency
+	BeatPulse     float32 `json:"beat_pulse"`      // how much the camera zooms in on every downbeat, 0 turns it off
+
+	// map related
+	MapParams
+
+	CellWaveRange int `json:"cell_wave_range"`
+
+	// onsets closer together than the square can bounce are merged, the importance of the notes decides which
+	// onset is kept, one of velocity, pitch or beat, or none to keep them all
+	ThinBy string `json:"thin_by"`
+
+	// midi related
+	OnsetToleranceMs int                  `json:"onset_tolerance_ms"` // notes starting within this of each other make a single bounce
+	Transforms       []midi.TransformSpec `json:"transforms"`         // applied in order to the MIDI file before the onsets are taken from it
+
+	// audio related, for maps generated from a WAV file alone
+	OnsetSensitivity float64 `json:"onset_sensitivity"` // between 0 and 1, higher detects quieter onsets
+}
+
+// MapParams are the parameters that change the generated map, they are stored along with a saved map
+type MapParams struct {
+	Seed int64 `json:"seed"` // 0 picks a random seed, the seed used is recorded in the generated map
+
+	SquareSize  int `json:"square_size"`
+	SquareSpeed int `json:"square_speed"`
+
+	BounceRectHeight int `json:"bounce_rect_height"`
+	BounceRectWidth  int `json:"bounce_rect_width"`
+
+	CellSize int `json:"cell_size"` // has to be a factor of SquareSize
+
+	ChangeDirChance float32 `json:"change_dir_chance"`
+
+	BacktrackChance   float32 `json:"backtrack_chance"`
+	BacktrackAmount   int     `json:"backtrack_amount"`
+	MaxRecursionDepth int     `json:"max_recursion_depth"`
+
+	MaxSquareDistance int `json:"max_square_distance"` // furthest the centers of two squares can be apart at a bounce, in maps with several squares
+}
+
+func DefaultConfig() Config {
+	return Config{
+		WindowWidth:  720,
+		WindowHeight: 1280,
+		FPS:          165,
+
+		StartDelaySec: 3.0,
+		BeatPulse:     0.03,
+
+		MapParams: MapParams{
+			SquareSize:  50,
+			SquareSpeed: 400,
+
+			BounceRectHeight: 30,
+			BounceRectWidth:  10,
+
+			CellSize: 10,
+
+			ChangeDirChance: 0.5,
+
+			BacktrackChance:   0.2,
+			BacktrackAmount:   40,
+			MaxRecursionDepth: 10_000_000,
+
+			MaxSquareDistance: 1000,
+		},
+
+		CellWaveRange: 300,
+
+		ThinBy: thinByNone,
+
+		OnsetToleranceMs: 1,
+
+		OnsetSensitivity: audio.DefaultOnsetParams().Sensitivity,
+	}
+}
+
+// config returns the default config with the map params replaced, used where only the map geometry matters
+func (p MapParams) config() Config {
+	cfg := DefaultConfig()
+	cfg.MapParams = p
+	return cfg
+}
+
+func (c Config) FrameIncrement() float64 {
+	return 1.0 / float64(c.FPS)
+}
+
+func (c Config) OnsetTolerance() float64 {
+	return float64(c.OnsetToleranceMs) / 1000
+}
+
+// Pipeline is the chain of transforms the MIDI file goes through before it is used
+func (c Config) Pipeline() (midi.Pipeline, error) {
+	return midi.NewPipeline(c.Transforms)
+}
+
+// MinBounceGapSec returns the shortest time between two bounces the map generator can fit. Between two bounces the
+// square has to move a quarter of its size and the length of a bounce rect together, rounded up to whole cells, on
+// both axes. Otherwise there is no way on from the second bounce that does not run into the bounce rect of the first
+// one, the thickness of the bounce rects does not matter as it lies beside the path.
+func (c Config) MinBounceGapSec() float64 {
+	cellSize := float64(c.CellSize)
+	cells := math.Ceil(float64(c.SquareSize+c.BounceRectHeight) / 4 / cellSize)
+
+	// the position snaps to the nearest cell, so moving past the half cell before the last one is enough,
+	// a pixel more keeps rounding errors from snapping it down
+	minTravel := (cells-0.5)*cellSize + 1
+
+	return minTravel / float64(c.SquareSpeed)
+}
+
+// ThinSource drops the onsets of src that are too close together for the square, see MinBounceGapSec.
+// With ThinBy set to none every onset is kept.
+func (c Config) ThinSource(src source.TimestampSource) (*source.Thinned, error) {
+	if c.ThinBy == thinByNone {
+		return source.Thin(src, 0, midi.ByVelocity), nil
+	}
+
+	importance, err := midi.ParseImportance(c.ThinBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return source.Thin(src, c.MinBounceGapSec(), importance), nil
+}
+
+// OnsetParams are the parameters of the onset detection in a WAV file
+func (c Config) OnsetParams() audio.OnsetParams {
+	params := audio.DefaultOnsetParams()
+	params.Sensitivity = c.OnsetSensitivity
+	return params
+}
+
+func (c Config) WindowCenter() rl.Vector2 {
+	return rl.NewVector2(float32(c.WindowWidth)/2, float32(c.WindowHeight)/2)
+}
+
+// LoadFile overrides the fields present in the config file at path, fields missing from the file are left untouched.
+// The extension picks the format: .toml for TOML, .yaml or .yml for YAML and JSON otherwise. Every format uses the
+// keys of the JSON format.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		data, err = tomlToJSON(data)
+	case ".yaml", ".yml":
+		data, err = yamlToJSON(data)
+	}
+	if err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// tomlToJSON converts a TOML document to JSON, so it is decoded with the JSON keys and checks of the config
+func tomlToJSON(data []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := toml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc)
+}
+
+// yamlToJSON converts a YAML document to JSON, see tomlToJSON
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc)
+}
+
+// RegisterFlags binds a flag to every field of the config, using the current values as defaults
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.WindowWidth, "window-width", c.WindowWidth, "window width in pixels")
+	fs.IntVar(&c.WindowHeight, "window-height", c.WindowHeight, "window height in pixels")
+	fs.IntVar(&c.FPS, "fps", c.FPS, "target frames per second")
+
+	fs.Float64Var(&c.StartDelaySec, "start-delay", c.StartDelaySec, "seconds before the music and the square start")
+	fs.IntVar(&c.AudioOffsetMs, "audio-offset", c.AudioOffsetMs, "milliseconds the visuals are delayed against the audio, negative if the audio is early")
+	float32Var(fs, &c.BeatPulse, "beat-pulse", "how much the camera zooms in on every downbeat, 0 turns it off")
+
+	fs.IntVar(&c.SquareSize, "square-size", c.SquareSize, "square size in pixels")
+	fs.IntVar(&c.SquareSpeed, "square-speed", c.SquareSpeed, "square speed in pixels per second")
+
+	fs.IntVar(&c.BounceRectHeight, "bounce-rect-height", c.BounceRectHeight, "length of a bounce rect in pixels")
+	fs.IntVar(&c.BounceRectWidth, "bounce-rect-width", c.BounceRectWidth, "thickness of a bounce rect in pixels")
+
+	fs.Int64Var(&c.Seed, "seed", c.Seed, "seed for the map generation (default random)")
+
+	fs.IntVar(&c.CellSize, "cell-size", c.CellSize, "grid cell size in pixels, has to be a factor of the square size")
+	fs.IntVar(&c.CellWaveRange, "cell-wave-range", c.CellWaveRange, "range of the cell color waves in pixels")
+
+	float32Var(fs, &c.ChangeDirChance, "change-dir-chance", "chance of trying the other bounce direction first")
+
+	float32Var(fs, &c.BacktrackChance, "backtrack-chance", "chance of backtracking multiple notes after a collision")
+	fs.IntVar(&c.BacktrackAmount, "backtrack-amount", c.BacktrackAmount, "number of notes to backtrack")
+	fs.IntVar(&c.MaxRecursionDepth, "max-recursion-depth", c.MaxRecursionDepth, "note depth after which backtracking multiple notes is allowed")
+	fs.IntVar(&c.MaxSquareDistance, "max-square-distance", c.MaxSquareDistance, "furthest two squares can be apart in pixels, in maps with several squares")
+
+	fs.StringVar(&c.ThinBy, "thin-by", c.ThinBy, "what decides which onsets too close for the square are merged: "+strings.Join(midi.Importances, ", ")+", or "+thinByNone+" to keep them all")
+
+	fs.IntVar(&c.OnsetToleranceMs, "onset-tolerance", c.OnsetToleranceMs, "milliseconds within which notes starting together are grouped into a single bounce")
+
+	fs.Float64Var(&c.OnsetSensitivity, "onset-sensitivity", c.OnsetSensitivity, "between 0 and 1, how quiet the onsets detected in a WAV file without MIDI can be")
+}
+
+// Validate returns all problems with the config joined into a single error
+func (c Config) Validate() error {
+	var errs []error
+
+	positive := map[string]int{
+		"window_width":        c.WindowWidth,
+		"window_height":       c.WindowHeight,
+		"fps":                 c.FPS,
+		"square_size":         c.SquareSize,
+		"square_speed":        c.SquareSpeed,
+		"bounce_rect_height":  c.BounceRectHeight,
+		"bounce_rect_width":   c.BounceRectWidth,
+		"cell_size":           c.CellSize,
+		"max_square_distance": c.MaxSquareDistance,
+	}
+	for _, name := range slices.Sorted(maps.Keys(positive)) {
+		if positive[name] <= 0 {
+			errs = append(errs, fmt.Errorf("%s has to be positive, got %d", name, positive[name]))
+		}
+	}
+
+	nonNegative := map[string]int{
+		"cell_wave_range":     c.CellWaveRange,
+		"backtrack_amount":    c.BacktrackAmount,
+		"max_recursion_depth": c.MaxRecursionDepth,
+		"onset_tolerance_ms":  c.OnsetToleranceMs,
+	}
+	for _, name := range slices.Sorted(maps.Keys(nonNegative)) {
+		if nonNegative[name] < 0 {
+			errs = append(errs, fmt.Errorf("%s can not be negative, got %d", name, nonNegative[name]))
+		}
+	}
+
+	if c.StartDelaySec < 0 {
+		errs = append(errs, fmt.Errorf("start_delay_sec can not be negative, got %v", c.StartDelaySec))
+	}
+	if c.OnsetSensitivity < 0 || c.OnsetSensitivity > 1 {
+		errs = append(errs, fmt.Errorf("onset_sensitivity has to be between 0 and 1, got %v", c.OnsetSensitivity))
+	}
+	if c.BeatPulse < 0 {
+		errs = append(errs, fmt.Errorf("beat_pulse can not be negative, got %v", c.BeatPulse))
+	}
+
+	if c.ThinBy != thinByNone {
+		if _, err := midi.ParseImportance(c.ThinBy); err != nil {
+			errs = append(errs, fmt.Errorf("thin_by: %w", err))
+		}
+	}
+
+	if _, err := c.Pipeline(); err != nil {
+		errs = append(errs, fmt.Errorf("transforms: %w", err))
+	}
+
+	chances := map[string]float32{
+		"change_dir_chance": c.ChangeDirChance,
+		"backtrack_chance":  c.BacktrackChance,
+	}
+	for _, name := range slices.Sorted(maps.Keys(chances)) {
+		if chances[name] < 0 || chances[name] > 1 {
+			errs = append(errs, fmt.Errorf("%s has to be between 0 and 1, got %v", name, chances[name]))
+		}
+	}
+
+	// the grid, the snapping and the reachable cells all assume everything lines up with the cells
+	if c.CellSize > 0 {
+		if c.SquareSize%c.CellSize != 0 {
+			errs = append(errs, fmt.Errorf("cell_size (%d) has to be a factor of square_size (%d)", c.CellSize, c.SquareSize))
+		}
+		if c.BounceRectWidth%c.CellSize != 0 || c.BounceRectHeight%c.CellSize != 0 {
+			errs = append(errs, fmt.Errorf("bounce rect size (%dx%d) has to be a multiple of cell_size (%d)", c.BounceRectWidth, c.BounceRectHeight, c.CellSize))
+		}
+		if (c.SquareSize-c.BounceRectHeight)%(2*c.CellSize) != 0 {
+			errs = append(errs, fmt.Errorf("bounce_rect_height (%d) centered on square_size (%d) does not line up with cell_size (%d)", c.BounceRectHeight, c.SquareSize, c.CellSize))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+type float32Value float32
+
+func (f *float32Value) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return err
+	}
+	*f = float32Value(v)
+	return nil
+}
+
+func (f *float32Value) String() string {
+	return strconv.FormatFloat(float64(*f), 'g', -1, 32)
+}
+
+func float32Var(fs *flag.FlagSet, p *float32, name, usage string) {
+	fs.Var((*float32Value)(p), name, usage)
+}
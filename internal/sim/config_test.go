@@ -0,0 +1,206 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ray_midi_sim/internal/midi"
+)
+
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{
+	"fps": 30,
+	"square_speed": 500,
+	"change_dir_chance": 0.25,
+	"transforms": [{"type": "transpose", "select": "channel=1", "semitones": -12}]
+}`,
+		"config.toml": `
+fps = 30
+square_speed = 500
+change_dir_chance = 0.25
+
+[[transforms]]
+type = "transpose"
+select = "channel=1"
+semitones = -12
+`,
+		"config.yaml": `
+fps: 30
+square_speed: 500
+change_dir_chance: 0.25
+transforms:
+  - type: transpose
+    select: channel=1
+    semitones: -12
+`,
+	}
+
+	want := DefaultConfig()
+	want.FPS = 30
+	want.SquareSpeed = 500
+	want.ChangeDirChance = 0.25
+	want.Transforms = []midi.TransformSpec{{Type: "transpose", Select: "channel=1", Semitones: -12}}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			if err := cfg.LoadFile(writeTempFile(t, name, content)); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("got %+v, want %+v", cfg, want)
+			}
+		})
+	}
+}
+
+func TestLoadFileUnknownKey(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"square_sped": 500}`,
+		"config.toml": `square_sped = 500`,
+		"config.yml":  `square_sped: 500`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			if err := cfg.LoadFile(writeTempFile(t, name, content)); err == nil {
+				t.Error("expected an error for the unknown key")
+			}
+		})
+	}
+}
+
+func TestLoadFileSyntaxError(t *testing.T) {
+	for _, name := range []string{"config.json", "config.toml", "config.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			if err := cfg.LoadFile(writeTempFile(t, name, "fps = = [")); err == nil {
+				t.Error("expected a syntax error")
+			}
+		})
+	}
+}
+
+// solveEvenGaps solves a dozen notes the gap apart for every seed, it returns the first error
+func solveEvenGaps(cfg Config, gapSec float64) error {
+	timestamps := make([]float64, 12)
+	for i := range timestamps {
+		timestamps[i] = 1 + float64(i)*gapSec
+	}
+
+	for _, seed := range []int64{1, 2, 3} {
+		sv := newSolver([][]float64{timestamps}, cfg, rand.New(rand.NewSource(seed)))
+		if _, err := sv.solve(context.Background(), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestMinBounceGapSec(t *testing.T) {
+	tests := []struct {
+		name                                   string
+		squareSize, bounceRectHeight, cellSize int
+		squareSpeed                            int
+		want                                   float64
+	}{
+		{"default", 50, 30, 10, 400, 16.0 / 400},
+		{"smaller square", 40, 20, 10, 300, 16.0 / 300},
+		{"finer cells", 60, 30, 5, 500, 23.5 / 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.SquareSize = tt.squareSize
+			cfg.BounceRectHeight = tt.bounceRectHeight
+			cfg.CellSize = tt.cellSize
+			cfg.SquareSpeed = tt.squareSpeed
+
+			minGapSec := cfg.MinBounceGapSec()
+			if math.Abs(minGapSec-tt.want) > 1e-12 {
+				t.Fatalf("got %v, want %v", minGapSec, tt.want)
+			}
+
+			if err := solveEvenGaps(cfg, minGapSec); err != nil {
+				t.Errorf("notes %v apart: %v", minGapSec, err)
+			}
+			if err := solveEvenGaps(cfg, minGapSec*1.01); err != nil {
+				t.Errorf("notes just above %v apart: %v", minGapSec, err)
+			}
+
+			// the bound has a pixel to spare, half a pixel short of the half cell the notes no longer fit
+			below := minGapSec - 1.5/float64(tt.squareSpeed)
+			if err := solveEvenGaps(cfg, below); !errors.Is(err, ErrNoPathFound) {
+				t.Errorf("notes %v apart: got %v, want ErrNoPathFound", below, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("the default config: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string // part of the error
+	}{
+		{"zero fps", func(c *Config) { c.FPS = 0 }, "fps has to be positive"},
+		{"negative window width", func(c *Config) { c.WindowWidth = -720 }, "window_width has to be positive"},
+		{"zero square size", func(c *Config) { c.SquareSize = 0 }, "square_size has to be positive"},
+		{"zero cell size", func(c *Config) { c.CellSize = 0 }, "cell_size has to be positive"},
+		{"negative max square distance", func(c *Config) { c.MaxSquareDistance = -1 }, "max_square_distance has to be positive"},
+		{"negative start delay", func(c *Config) { c.StartDelaySec = -1 }, "start_delay_sec can not be negative"},
+		{"negative onset tolerance", func(c *Config) { c.OnsetToleranceMs = -1 }, "onset_tolerance_ms can not be negative"},
+		{"negative backtrack amount", func(c *Config) { c.BacktrackAmount = -1 }, "backtrack_amount can not be negative"},
+		{"negative beat pulse", func(c *Config) { c.BeatPulse = -0.1 }, "beat_pulse can not be negative"},
+		{"change dir chance above 1", func(c *Config) { c.ChangeDirChance = 1.5 }, "change_dir_chance has to be between 0 and 1"},
+		{"negative backtrack chance", func(c *Config) { c.BacktrackChance = -0.1 }, "backtrack_chance has to be between 0 and 1"},
+		{"onset sensitivity above 1", func(c *Config) { c.OnsetSensitivity = 2 }, "onset_sensitivity has to be between 0 and 1"},
+		{"square size off the cells", func(c *Config) { c.SquareSize = 55 }, "has to be a factor of square_size"},
+		{"bounce rect off the cells", func(c *Config) { c.BounceRectWidth = 15 }, "has to be a multiple of cell_size"},
+		{"bounce rect not centered on the cells", func(c *Config) { c.BounceRectHeight = 20 }, "does not line up with cell_size"},
+		{"unknown thin_by", func(c *Config) { c.ThinBy = "loudness" }, "thin_by"},
+		{"bad transform", func(c *Config) { c.Transforms = []midi.TransformSpec{{Type: "transpose", Select: "pitch=200"}} }, "transforms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %q, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package sim
+
+import (
+	"ray_midi_sim/internal/canvas"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// controls of the live player:
+//   space          pause and resume
+//   left, right    seek 5 seconds, 1 second while holding shift
+//   up, down       jump to the next or previous bounce
+//   comma, period  step one frame back or forward
+//   home           back to the start
+//   the timeline at the bottom of the window can be clicked and dragged to scrub
+
+const (
+	seekStepSec     = 5.0
+	fineSeekStepSec = 1.0
+
+	timelineHeight      = 6
+	timelineHoverHeight = 24 // height of the area at the bottom that grabs the mouse for scrubbing
+)
+
+// Seek jumps to timeSec, negative times are inside the start delay. The bounce counters, the squares,
+// the camera and the music all end up where they would be had the simulation played up to there.
+func (s *Simulation) Seek(timeSec float64) {
+	s.seek(timeSec)
+	s.syncMusic()
+}
+
+// SeekBounce jumps to the moment of the bounce, so it has just been applied
+func (s *Simulation) SeekBounce(bounceIdx int) {
+	if len(s.generatedMap.bounces) == 0 {
+		return
+	}
+
+	bounceIdx = max(0, min(bounceIdx, len(s.generatedMap.bounces)-1))
+	s.Seek(s.generatedMap.bounces[bounceIdx].timeSec)
+}
+
+func (s *Simulation) SetPaused(paused bool) {
+	if paused == s.paused {
+		return
+	}
+	s.paused = paused
+
+	if paused {
+		rl.PauseMusicStream(s.music)
+	} else {
+		s.syncMusic()
+	}
+}
+
+// seek moves everything but the music to timeSec
+func (s *Simulation) seek(timeSec float64) {
+	timeSec = max(-s.cfg.StartDelaySec, min(timeSec, s.durationSec()))
+
+	s.clock.Seek(timeSec)
+
+	// the waves of skipped or undone bounces would be out of place
+	colorWaves = nil
+
+	// skipped bounces should not trigger their effects
+	s.bounceIdx = s.generatedMap.StateAt(timeSec).BounceIdx
+	s.step(timeSec, 0)
+
+	s.camera.Target = s.squaresCenter()
+}
+
+// syncMusic puts the music stream at the position of the clock
+func (s *Simulation) syncMusic() {
+	audioSec := s.clock.AudioSec()
+
+	if audioSec < 0 || audioSec >= float64(rl.GetMusicTimeLength(s.music)) {
+		rl.StopMusicStream(s.music)
+
+		// inside the start delay the music starts again once the clock reaches 0
+		s.musicStarted = audioSec >= 0
+		return
+	}
+
+	// a stream that stopped at its end has to be played again before it can seek
+	rl.PlayMusicStream(s.music)
+	rl.SeekMusicStream(s.music, float32(audioSec))
+	s.musicStarted = true
+
+	if s.paused {
+		rl.PauseMusicStream(s.music)
+	}
+}
+
+// durationSec is the length of the music or the time of the last bounce, whichever is later
+func (s *Simulation) durationSec() float64 {
+	durationSec := float64(rl.GetMusicTimeLength(s.music))
+
+	if len(s.generatedMap.bounces) > 0 {
+		durationSec = max(durationSec, s.generatedMap.bounces[len(s.generatedMap.bounces)-1].timeSec)
+	}
+
+	return durationSec
+}
+
+func (s *Simulation) handleInput() {
+	if rl.IsKeyPressed(rl.KeySpace) {
+		s.SetPaused(!s.paused)
+	}
+
+	seekStep := seekStepSec
+	if rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift) {
+		seekStep = fineSeekStepSec
+	}
+
+	timeSec := s.clock.TimeSec()
+
+	switch {
+	case rl.IsKeyPressed(rl.KeyLeft) || rl.IsKeyPressedRepeat(rl.KeyLeft):
+		s.Seek(timeSec - seekStep)
+	case rl.IsKeyPressed(rl.KeyRight) || rl.IsKeyPressedRepeat(rl.KeyRight):
+		s.Seek(timeSec + seekStep)
+	case rl.IsKeyPressed(rl.KeyUp) || rl.IsKeyPressedRepeat(rl.KeyUp):
+		s.SeekBounce(s.bounceIdx)
+	case rl.IsKeyPressed(rl.KeyDown) || rl.IsKeyPressedRepeat(rl.KeyDown):
+		// bounceIdx bounces were applied, the latest one is bounceIdx-1
+		s.SeekBounce(s.bounceIdx - 2)
+	case rl.IsKeyPressed(rl.KeyComma) || rl.IsKeyPressedRepeat(rl.KeyComma):
+		s.Seek(timeSec - s.cfg.FrameIncrement())
+	case rl.IsKeyPressed(rl.KeyPeriod) || rl.IsKeyPressedRepeat(rl.KeyPeriod):
+		s.Seek(timeSec + s.cfg.FrameIncrement())
+	case rl.IsKeyPressed(rl.KeyHome):
+		s.Seek(-s.cfg.StartDelaySec)
+	}
+
+	s.handleScrubbing()
+}
+
+// handleScrubbing seeks to the mouse while the timeline is dragged, the music only follows once it is let go
+func (s *Simulation) handleScrubbing() {
+	mouse := rl.GetMousePosition()
+
+	if rl.IsMouseButtonPressed(rl.MouseButtonLeft) && mouse.Y >= float32(s.cfg.WindowHeight-timelineHoverHeight) {
+		s.scrubbing = true
+		rl.PauseMusicStream(s.music)
+	}
+
+	if !s.scrubbing {
+		return
+	}
+
+	progress := rl.Clamp(mouse.X/float32(s.cfg.WindowWidth), 0, 1)
+	s.seek(float64(progress) * s.durationSec())
+
+	if !rl.IsMouseButtonDown(rl.MouseButtonLeft) {
+		s.scrubbing = false
+		s.syncMusic()
+	}
+}
+
+// drawTimeline draws the progress through the song at the bottom of the window, and a pause sign while paused
+func (s *Simulation) drawTimeline(c canvas.Canvas) {
+	width := float32(s.cfg.WindowWidth)
+	y := float32(s.cfg.WindowHeight - timelineHeight)
+
+	progress := float32(0)
+	if durationSec := s.durationSec(); durationSec > 0 {
+		progress = rl.Clamp(float32(s.currentTimeSec/durationSec), 0, 1)
+	}
+
+	c.DrawRectangle(canvas.Rect{Y: y, Width: width, Height: timelineHeight}, rl.Fade(rl.Black, 0.6))
+	c.DrawRectangle(canvas.Rect{Y: y, Width: width * progress, Height: timelineHeight}, rl.White)
+
+	if s.paused {
+		c.DrawRectangle(canvas.Rect{X: 20, Y: 20, Width: 8, Height: 28}, rl.White)
+		c.DrawRectangle(canvas.Rect{X: 36, Y: 20, Width: 8, Height: 28}, rl.White)
+	}
+}
@@ -0,0 +1,153 @@
+package sim
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ray_midi_sim/internal/canvas"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+// checkGolden compares img with testdata/name, go test -run TestDraw -update writes the current images instead
+func checkGolden(t *testing.T, name string, img *image.RGBA) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+
+	if *updateGolden {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := image.NewRGBA(decoded.Bounds())
+	for y := decoded.Bounds().Min.Y; y < decoded.Bounds().Max.Y; y++ {
+		for x := decoded.Bounds().Min.X; x < decoded.Bounds().Max.X; x++ {
+			want.Set(x, y, decoded.At(x, y))
+		}
+	}
+
+	if want.Rect != img.Rect {
+		t.Fatalf("%s: got size %v, want %v", name, img.Rect.Size(), want.Rect.Size())
+	}
+
+	diff := 0
+	for i := 0; i < len(img.Pix); i += 4 {
+		if !bytes.Equal(img.Pix[i:i+4], want.Pix[i:i+4]) {
+			diff++
+		}
+	}
+	if diff > 0 {
+		t.Errorf("%s: %d pixels differ, run go test -run TestDraw -update if the change is intended", name, diff)
+	}
+}
+
+func drawTestConfig() Config {
+	cfg := DefaultConfig()
+	cfg.WindowWidth = 160
+	cfg.WindowHeight = 120
+	return cfg
+}
+
+func drawTestCamera(cfg Config, target rl.Vector2) canvas.Camera {
+	return canvas.Camera{
+		Offset: canvas.Vec2{X: float32(cfg.WindowWidth) / 2, Y: float32(cfg.WindowHeight) / 2},
+		Target: canvas.Vec2(target),
+		Zoom:   1,
+	}
+}
+
+func TestDrawGrid(t *testing.T) {
+	cfg := drawTestConfig()
+	c := canvas.NewSoftware(cfg.WindowWidth, cfg.WindowHeight)
+	c.Clear(rl.White)
+
+	safeAreas := []rl.Rectangle{rl.NewRectangle(-40, -30, 60, 40)}
+	bounceRects := []rl.Rectangle{rl.NewRectangle(30, 10, 10, 30), rl.NewRectangle(-60, 20, 30, 10)}
+
+	camera := drawTestCamera(cfg, rl.NewVector2(0, 0))
+	cameraRect := GetCameraRect(rl.Camera2D{Target: rl.Vector2(camera.Target), Zoom: camera.Zoom}, int32(cfg.WindowWidth), int32(cfg.WindowHeight))
+	startX, endX, startY, endY := GetCameraBoundaries(cameraRect, int32(cfg.CellSize))
+
+	c.BeginCamera(camera)
+	drawGridOutsideRects(c, startX, endX, startY, endY, cfg.CellSize, rl.Black, safeAreas)
+	drawGridInsideRects(c, startX, endX, startY, endY, cfg.CellSize, rl.Red, bounceRects)
+	c.EndCamera()
+
+	checkGolden(t, "grid.png", c.Image())
+}
+
+func TestDrawSquare(t *testing.T) {
+	cfg := drawTestConfig()
+
+	tests := []struct {
+		name  string
+		state SquareState
+	}{
+		{"square_rest.png", SquareState{Position: rl.NewVector2(-25, -25), BounceAnimSec: bounceAnimDurationSec}},
+		{"square_squash.png", SquareState{Position: rl.NewVector2(-25, -25), BounceDirection: VerticalBounce, BounceAnimSec: bounceAnimDurationSec / 8}},
+		{"square_stretch.png", SquareState{Position: rl.NewVector2(-25, -25), BounceDirection: HorizontalBounce, BounceAnimSec: bounceAnimDurationSec / 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := canvas.NewSoftware(cfg.WindowWidth, cfg.WindowHeight)
+			c.Clear(rl.Black)
+
+			square := NewSquare(cfg, rl.Vector2{}, rl.Vector2{}, 0)
+			square.SetState(tt.state)
+
+			c.BeginCamera(drawTestCamera(cfg, rl.NewVector2(0, 0)))
+			square.Draw(c)
+			c.EndCamera()
+
+			checkGolden(t, tt.name, c.Image())
+		})
+	}
+}
+
+func TestDrawBounce(t *testing.T) {
+	cfg := drawTestConfig()
+	c := canvas.NewSoftware(cfg.WindowWidth, cfg.WindowHeight)
+	c.Clear(rl.White)
+
+	// a square at the origin bouncing off each of the four walls around it
+	bounces := []*Bounce{
+		NewBounce(0, 0, rl.NewVector2(-25, -25), rl.NewVector2(1, 1), HorizontalBounce, 0),
+		NewBounce(1, 0, rl.NewVector2(-25, -25), rl.NewVector2(-1, 1), HorizontalBounce, 0),
+		NewBounce(2, 0, rl.NewVector2(-25, -25), rl.NewVector2(1, 1), VerticalBounce, 0),
+		NewBounce(3, 0, rl.NewVector2(-25, -25), rl.NewVector2(1, -1), VerticalBounce, 0),
+	}
+
+	c.BeginCamera(drawTestCamera(cfg, rl.NewVector2(0, 0)))
+	for _, b := range bounces {
+		b.Draw(c, cfg)
+	}
+	c.EndCamera()
+
+	checkGolden(t, "bounce.png", c.Image())
+}
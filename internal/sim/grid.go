@@ -2,9 +2,10 @@ package sim
 
 import (
 	"math"
-
 	"slices"
 
+	"ray_midi_sim/internal/canvas"
+
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
@@ -70,7 +71,7 @@ func getVerticalSpansInsidePolygon(x, minY, maxY float32, polygon Polygon) []Int
 	return inside
 }
 
-func drawVerticalLineOutsidePolygons(x, startY, endY float32, polygons []Polygon, color rl.Color) {
+func drawVerticalLineOutsidePolygons(c canvas.Canvas, x, startY, endY float32, polygons []Polygon, color rl.Color) {
 	segments := []Interval{
 		{start: startY, end: endY},
 	}
@@ -85,13 +86,7 @@ func drawVerticalLineOutsidePolygons(x, startY, endY float32, polygons []Polygon
 	// Draw remaining segments
 	for _, seg := range segments {
 		if seg.end > seg.start {
-			rl.DrawLine(
-				int32(x),
-				int32(seg.start),
-				int32(x),
-				int32(seg.end),
-				color,
-			)
+			c.DrawLine(canvas.Vec2{X: x, Y: seg.start}, canvas.Vec2{X: x, Y: seg.end}, color)
 		}
 	}
 }
@@ -153,7 +148,7 @@ func getHorizontalSpansInsidePolygon(y, minX, maxX float32, polygon Polygon) []I
 	return inside
 }
 
-func drawHorizontalLineOutsidePolygons(y, startX, endX float32, polygons []Polygon, color rl.Color) {
+func drawHorizontalLineOutsidePolygons(c canvas.Canvas, y, startX, endX float32, polygons []Polygon, color rl.Color) {
 	segments := []Interval{
 		{start: startX, end: endX},
 	}
@@ -166,18 +161,13 @@ func drawHorizontalLineOutsidePolygons(y, startX, endX float32, polygons []Polyg
 
 	for _, seg := range segments {
 		if seg.end > seg.start {
-			rl.DrawLine(
-				int32(seg.start),
-				int32(y),
-				int32(seg.end),
-				int32(y),
-				color,
-			)
+			c.DrawLine(canvas.Vec2{X: seg.start, Y: y}, canvas.Vec2{X: seg.end, Y: y}, color)
 		}
 	}
 }
 
 func drawGridOutsidePolygons(
+	c canvas.Canvas,
 	startX, endX, startY, endY float32,
 	cellSize int32,
 	color rl.Color,
@@ -185,11 +175,11 @@ func drawGridOutsidePolygons(
 ) {
 	// Draw vertical lines
 	for x := startX; x <= endX; x += float32(cellSize) {
-		drawVerticalLineOutsidePolygons(x, startY, endY, polygons, color)
+		drawVerticalLineOutsidePolygons(c, x, startY, endY, polygons, color)
 	}
 	// Draw horizontal lines
 	for y := startY; y <= endY; y += float32(cellSize) {
-		drawHorizontalLineOutsidePolygons(y, startX, endX, polygons, color)
+		drawHorizontalLineOutsidePolygons(c, y, startX, endX, polygons, color)
 	}
 }
 
@@ -318,7 +308,7 @@ func almostEqual(a, b rl.Vector2) bool {
 	return (rl.Vector2Distance(a, b) < eps)
 }
 
-func drawVerticalLineOutsideRects(x, startY, endY float32, rects []rl.Rectangle, color rl.Color) {
+func drawVerticalLineOutsideRects(c canvas.Canvas, x, startY, endY float32, rects []rl.Rectangle, color rl.Color) {
 	segments := []Interval{
 		{start: startY, end: endY},
 	}
@@ -334,12 +324,12 @@ func drawVerticalLineOutsideRects(x, startY, endY float32, rects []rl.Rectangle,
 
 	for _, seg := range segments {
 		if seg.end > seg.start {
-			rl.DrawLine(int32(x), int32(seg.start), int32(x), int32(seg.end), color)
+			c.DrawLine(canvas.Vec2{X: x, Y: seg.start}, canvas.Vec2{X: x, Y: seg.end}, color)
 		}
 	}
 }
 
-func drawHorizontalLineOutsideRects(y, startX, endX float32, rects []rl.Rectangle, color rl.Color) {
+func drawHorizontalLineOutsideRects(c canvas.Canvas, y, startX, endX float32, rects []rl.Rectangle, color rl.Color) {
 	segments := []Interval{
 		{start: startX, end: endX},
 	}
@@ -355,24 +345,24 @@ func drawHorizontalLineOutsideRects(y, startX, endX float32, rects []rl.Rectangl
 
 	for _, seg := range segments {
 		if seg.end > seg.start {
-			rl.DrawLine(int32(seg.start), int32(y), int32(seg.end), int32(y), color)
+			c.DrawLine(canvas.Vec2{X: seg.start, Y: y}, canvas.Vec2{X: seg.end, Y: y}, color)
 		}
 	}
 }
 
-func drawGridOutsideRects(startX, endX, startY, endY float32, cellSize int, color rl.Color, rects []rl.Rectangle) {
+func drawGridOutsideRects(c canvas.Canvas, startX, endX, startY, endY float32, cellSize int, color rl.Color, rects []rl.Rectangle) {
 	// draw vertical lines skipping rects
 	for x := startX; x <= endX; x += float32(cellSize) {
-		drawVerticalLineOutsideRects(x, startY, endY, rects, color)
+		drawVerticalLineOutsideRects(c, x, startY, endY, rects, color)
 	}
 
 	// draw horizontal lines skipping rects
 	for y := startY; y <= endY; y += float32(cellSize) {
-		drawHorizontalLineOutsideRects(y, startX, endX, rects, color)
+		drawHorizontalLineOutsideRects(c, y, startX, endX, rects, color)
 	}
 }
 
-func drawVerticalLineInsideRects(x, startY, endY float32, rects []rl.Rectangle, color rl.Color) {
+func drawVerticalLineInsideRects(c canvas.Canvas, x, startY, endY float32, rects []rl.Rectangle, color rl.Color) {
 	// We'll collect Intervals that lie within any rect.
 	var segments []Interval
 
@@ -403,12 +393,12 @@ func drawVerticalLineInsideRects(x, startY, endY float32, rects []rl.Rectangle,
 	// Draw each final merged segment
 	for _, seg := range segments {
 		if seg.end > seg.start {
-			rl.DrawLine(int32(x), int32(seg.start), int32(x), int32(seg.end), color)
+			c.DrawLine(canvas.Vec2{X: x, Y: seg.start}, canvas.Vec2{X: x, Y: seg.end}, color)
 		}
 	}
 }
 
-func drawHorizontalLineInsideRects(y, startX, endX float32, rects []rl.Rectangle, color rl.Color) {
+func drawHorizontalLineInsideRects(c canvas.Canvas, y, startX, endX float32, rects []rl.Rectangle, color rl.Color) {
 	var segments []Interval
 
 	// For each bounce rect, if y is inside [rect.Y, rect.Y+rect.Height],
@@ -435,20 +425,20 @@ func drawHorizontalLineInsideRects(y, startX, endX float32, rects []rl.Rectangle
 
 	for _, seg := range segments {
 		if seg.end > seg.start {
-			rl.DrawLine(int32(seg.start), int32(y), int32(seg.end), int32(y), color)
+			c.DrawLine(canvas.Vec2{X: seg.start, Y: y}, canvas.Vec2{X: seg.end, Y: y}, color)
 		}
 	}
 }
 
-func drawGridInsideRects(startX, endX, startY, endY float32, cellSize int, color rl.Color, rects []rl.Rectangle) {
+func drawGridInsideRects(c canvas.Canvas, startX, endX, startY, endY float32, cellSize int, color rl.Color, rects []rl.Rectangle) {
 	// Draw vertical sub‐grid lines only inside bounce rects
 	for x := startX; x <= endX; x += float32(cellSize) {
-		drawVerticalLineInsideRects(x, startY, endY, rects, color)
+		drawVerticalLineInsideRects(c, x, startY, endY, rects, color)
 	}
 
 	// Draw horizontal sub‐grid lines only inside bounce rects
 	for y := startY; y <= endY; y += float32(cellSize) {
-		drawHorizontalLineInsideRects(y, startX, endX, rects, color)
+		drawHorizontalLineInsideRects(c, y, startX, endX, rects, color)
 	}
 }
 
@@ -459,6 +449,7 @@ func drawGridInsideRects(startX, endX, startY, endY float32, cellSize int, color
 // drawVerticalLineIncludeExclude draws a vertical line (at x) for intervals that lie
 // in the union of includeRects MINUS the union of excludeRects, clipped to [startY, endY].
 func drawVerticalLineIncludeExclude(
+	c canvas.Canvas,
 	x, startY, endY float32,
 	includeRects, excludeRects []rl.Rectangle,
 	color rl.Color,
@@ -478,7 +469,7 @@ func drawVerticalLineIncludeExclude(
 	// 4. Draw final segments
 	for _, seg := range finalSegments {
 		if seg.end > seg.start {
-			rl.DrawLine(int32(x), int32(seg.start), int32(x), int32(seg.end), color)
+			c.DrawLine(canvas.Vec2{X: x, Y: seg.start}, canvas.Vec2{X: x, Y: seg.end}, color)
 		}
 	}
 }
@@ -486,6 +477,7 @@ func drawVerticalLineIncludeExclude(
 // drawHorizontalLineIncludeExclude draws a horizontal line (at y) for intervals that lie
 // in the union of includeRects MINUS the union of excludeRects, clipped to [startX, endX].
 func drawHorizontalLineIncludeExclude(
+	c canvas.Canvas,
 	y, startX, endX float32,
 	includeRects, excludeRects []rl.Rectangle,
 	color rl.Color,
@@ -505,7 +497,7 @@ func drawHorizontalLineIncludeExclude(
 	// 4. Draw final segments
 	for _, seg := range finalSegments {
 		if seg.end > seg.start {
-			rl.DrawLine(int32(seg.start), int32(y), int32(seg.end), int32(y), color)
+			c.DrawLine(canvas.Vec2{X: seg.start, Y: y}, canvas.Vec2{X: seg.end, Y: y}, color)
 		}
 	}
 }
@@ -516,14 +508,14 @@ func drawHorizontalLineIncludeExclude(
 
 // drawGridIncludeExcludeRects draws a grid (vertical/horizontal lines at `cellSize` spacing)
 // only in areas that are inside the union of includeRects BUT outside any excludeRect.
-func drawGridIncludeExcludeRects(startX, endX, startY, endY float32, cellSize int, color rl.Color, includeRects, excludeRects []rl.Rectangle) {
+func drawGridIncludeExcludeRects(c canvas.Canvas, startX, endX, startY, endY float32, cellSize int, color rl.Color, includeRects, excludeRects []rl.Rectangle) {
 	// Draw vertical grid lines
 	for x := startX; x <= endX; x += float32(cellSize) {
-		drawVerticalLineIncludeExclude(x, startY, endY, includeRects, excludeRects, color)
+		drawVerticalLineIncludeExclude(c, x, startY, endY, includeRects, excludeRects, color)
 	}
 
 	// Draw horizontal grid lines
 	for y := startY; y <= endY; y += float32(cellSize) {
-		drawHorizontalLineIncludeExclude(y, startX, endX, includeRects, excludeRects, color)
+		drawHorizontalLineIncludeExclude(c, y, startX, endX, includeRects, excludeRects, color)
 	}
 }
@@ -1,26 +1,66 @@
 package sim
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math"
 	"math/rand"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
+var (
+	ErrNoPathFound    = errors.New("no path found")
+	ErrInvalidSquares = errors.New("invalid squares")
+)
+
 type Map struct {
+	// parameters the map was generated with, including the seed that was used
+	params MapParams
+
+	// hash of the source the note timestamps came from, if known
+	sourceHash string
+
+	// bounces of every square in time order, squareBounceIdxs[i] are the indexes of the bounces of square i
 	bounces              []Bounce
+	squareBounceIdxs     [][]int
 	floatingBounceRects  []rl.Rectangle
 	connectedBounceRects []rl.Rectangle
 	safeAreas            []rl.Rectangle
 
+	// floatingBounceCounts[i] is the number of floating bounces among the first i bounces
+	floatingBounceCounts []int
+
 	polygonPaths []Polygon
 }
 
+// Seed returns the seed the map was generated with, generating again with the same seed gives the same map
+func (m Map) Seed() int64 {
+	return m.params.Seed
+}
+
+func (m Map) Params() MapParams {
+	return m.params
+}
+
+func (m Map) SourceHash() string {
+	return m.sourceHash
+}
+
+func (m *Map) SetSourceHash(sourceHash string) {
+	m.sourceHash = sourceHash
+}
+
 func (m Map) Bounces() []Bounce {
 	return m.bounces
 }
 
+// SquareCount returns the number of squares, each bounces on the notes of its own timestamps
+func (m Map) SquareCount() int {
+	return len(m.squareBounceIdxs)
+}
+
 func (m *Map) PopBounce() Bounce {
 	b := m.bounces[0]
 	m.bounces = m.bounces[1:]
@@ -144,217 +184,145 @@ func rectCornersCollideWithPolygon(polygon []rl.Vector2, rect rl.Rectangle) bool
 	return false
 }
 
-func GenerateMap(noteOnTimestamps []float64, squareSpeed int) (Map, error) {
-	var recursiveGenerate func(square Square, noteOnTimestamps []float64, depth int, bounces []Bounce, prevTime float64, prevBounceDirPriority [2]BounceDirection) []Bounce
-
-	m := Map{}
-
-	var safeAreas []rl.Rectangle
-	var polygonPaths []Polygon
-
-	backtrackSteps := 0
-
-	recursiveGenerate = func(square Square, noteOnTimestamps []float64, depth int, bounces []Bounce, prevTimeSec float64, prevBounceDirPriority [2]BounceDirection) []Bounce {
-		if len(noteOnTimestamps) < 1 {
+// squareStart returns where a square starts. The squares start side by side on a diagonal and move down right,
+// so they move in parallel until their first bounce. The first square starts at the origin.
+func squareStart(params MapParams, squareIdx int) rl.Vector2 {
+	offset := 2 * params.SquareSize * squareIdx
+	return rl.NewVector2(float32(offset), float32(-offset))
+}
 
-			return bounces
+// GenerateMap places a bounce at every note timestamp, squareTimestamps holds the timestamps of every square. The
+// paths and bounce rects of all squares avoid each other, and the squares stay within the max square distance.
+// It stops early with the context error when ctx is done, onProgress (if not nil) is called periodically while the
+// solver runs.
+func GenerateMap(ctx context.Context, squareTimestamps [][]float64, cfg Config, onProgress ProgressFunc) (Map, error) {
+	if len(squareTimestamps) > 1 {
+		for i, timestamps := range squareTimestamps {
+			if len(timestamps) == 0 {
+				return Map{}, fmt.Errorf("%w: square %d has no notes", ErrInvalidSquares, i+1)
+			}
 		}
 
-		noteTimeSec := noteOnTimestamps[0]
-		dt := noteTimeSec - prevTimeSec
+		last := squareStart(cfg.MapParams, len(squareTimestamps)-1)
+		if distance := rl.Vector2Length(last); distance > float32(cfg.MaxSquareDistance) {
+			return Map{}, fmt.Errorf("%w: %d squares start %.0f pixels apart, more than the max square distance of %d",
+				ErrInvalidSquares, len(squareTimestamps), distance, cfg.MaxSquareDistance)
+		}
+	}
 
-		polygonPathsStartIndex := len(polygonPaths)
+	seed := cfg.Seed
+	for seed == 0 {
+		seed = rand.Int63()
+	}
 
-		prevSquareRect := square.ToRectangle()
-		prevPos := square.position
+	// every random decision is taken from this generator so the same seed gives the same map
+	rng := rand.New(rand.NewSource(seed))
 
-		square.Update(float32(dt))
+	m := Map{params: cfg.MapParams}
+	m.params.Seed = seed
 
-		// snap position
-		snappedPos := snapPosition(square.position, float32(CELL_SIZE), float32(CELL_SIZE))
-		square.position = snappedPos
+	sv := newSolver(squareTimestamps, cfg, rng)
 
-		polygonPath := createPathPolygon(square.direction, prevPos, snappedPos, SQUARE_SIZE)
-		polygonPaths = append(polygonPaths, polygonPath)
+	bounces, err := sv.solve(ctx, onProgress)
+	if err != nil {
+		return Map{}, err
+	}
+	m.bounces = bounces
+	m.indexSquares()
 
-		// check if any bounces exist, if so, check for collisions
-		if len(bounces) > 0 {
-			collisionBounceRects := make([]rl.Rectangle, 0, len(bounces))
-			for _, bounce := range bounces {
-				collisionBounceRects = append(collisionBounceRects, bounce.ToCollisionRect())
-			}
+	m.polygonPaths = sv.polygonPaths
+	m.safeAreas = mergeOverlappingRects(sv.safeAreas, spatialBucketSize(cfg))
 
-			// path collision check
-			pathCollision := false
-			for _, pp := range polygonPaths {
-				if rectCornersCollideWithPolygon(pp, collisionBounceRects[len(collisionBounceRects)-1]) {
-					pathCollision = true
-					break
-				}
-			}
+	safeAreaIndex := newSafeAreaIndex(m.safeAreas, cfg)
 
-			// bounce rect collision check
-			bounceRectCollision := false
-			for _, bounceRect := range collisionBounceRects {
-				if rectCornersCollideWithPolygon(polygonPath, bounceRect) {
-					bounceRectCollision = true
-				}
-			}
-
-			// check for collisions
-			if pathCollision || bounceRectCollision {
-				if depth > MAX_RECURSION_DEPTH && rand.Float32() < BACKTRACK_CHANCE {
-					backtrackSteps = BACKTRACK_AMOUNT
-				}
-				// remove polygon path
-				polygonPaths = polygonPaths[:polygonPathsStartIndex]
+	for i := range m.bounces {
+		b := &m.bounces[i]
+		b.isFloating = rectIsFloating(b.ToRect(cfg), m.safeAreas, safeAreaIndex)
+	}
 
-				// return empty bounces
-				return []Bounce{}
-			}
-		}
+	m.collectBounceRects(cfg, safeAreaIndex)
 
-		// NO COLLISIONS FOUND
+	// Post-process to adjust each bounce's speed based on the position and time of the next bounce of its square
+	for _, bounceIdxs := range m.squareBounceIdxs {
+		for i := range len(bounceIdxs) - 1 {
+			current := &m.bounces[bounceIdxs[i]]
+			next := m.bounces[bounceIdxs[i+1]]
+			deltaTime := next.timeSec - current.timeSec
 
-		bounceDirPriority := prevBounceDirPriority
+			var distance float32
 
-		if rand.Float32() < CHANGE_DIR_CHANCE {
-			bounceDirPriority[0], bounceDirPriority[1] = bounceDirPriority[1], bounceDirPriority[0]
-		}
-
-		// randomly choose whether it is a "horizontal" or "vertical" bounce
-		for _, dir := range bounceDirPriority {
-			// make square bounce in the direction
-			square.InvertDirection(dir)
-			square.position = snappedPos
-
-			// create bounce
-			bounce := NewBounce(
-				len(bounces),
-				noteTimeSec,
-				snappedPos,
-				square.direction,
-				dir,
-				square.speed,
-			)
-
-			// check collision with final bounce rect
-			if len(noteOnTimestamps) == 1 {
-				collisionBounceRect := bounce.ToCollisionRect()
-
-				for _, pp := range polygonPaths {
-					if rectCornersCollideWithPolygon(pp, collisionBounceRect) {
-						// remove polygon path
-						polygonPaths = polygonPaths[:polygonPathsStartIndex]
-
-						// return empty bounces
-						return []Bounce{}
-					}
-				}
+			if current.bounceDirection == VerticalBounce {
+				distance = float32(math.Abs(float64(next.position.X - current.position.X)))
+			} else {
+				distance = float32(math.Abs(float64(next.position.Y - current.position.Y)))
 			}
 
-			// save the bounce + safe area
-			safeAreas = append(safeAreas, mergeRect(prevSquareRect, square.ToRectangle()))
-			bounces = append(bounces, *bounce)
-
-			// make a copy of bounces
-			bouncesCopy := make([]Bounce, len(bounces))
-			copy(bouncesCopy, bounces)
-
-			// recursive call
-			extendedBounces := recursiveGenerate(square, noteOnTimestamps[1:], depth+1, bouncesCopy, noteTimeSec, bounceDirPriority)
-
-			if len(extendedBounces) > 0 {
-				return extendedBounces
+			if deltaTime > 0 {
+				current.nextSpeed = distance / float32(deltaTime)
+			} else {
+				current.nextSpeed = float32(cfg.SquareSpeed)
 			}
+		}
+	}
 
-			// NO PATH FOUND
-
-			// invert direction
-			square.InvertDirection(dir)
-
-			// remove the bounce + safe area
-			safeAreas = safeAreas[:len(safeAreas)-1]
-			bounces = bounces[:len(bounces)-1]
-
-			// remove the path
-			if backtrackSteps > 0 {
-				backtrackSteps--
+	return m, nil
+}
 
-				// remove polygon path
-				polygonPaths = polygonPaths[:polygonPathsStartIndex]
+// indexSquares lists the bounces of every square
+func (m *Map) indexSquares() {
+	m.squareBounceIdxs = nil
 
-				// return empty bounces
-				return []Bounce{}
-			}
+	for i, b := range m.bounces {
+		for len(m.squareBounceIdxs) <= b.square {
+			m.squareBounceIdxs = append(m.squareBounceIdxs, nil)
 		}
-
-		// remove polygon path
-		polygonPaths = polygonPaths[:polygonPathsStartIndex]
-
-		// return empty bounces
-		return []Bounce{}
+		m.squareBounceIdxs[b.square] = append(m.squareBounceIdxs[b.square], i)
 	}
+}
 
-	square := NewSquare(rl.NewVector2(0, 0), rl.NewVector2(1, 1), float32(squareSpeed))
-
-	bouncesTemp := recursiveGenerate(square, noteOnTimestamps, 0, []Bounce{}, 0.0, [2]BounceDirection{VerticalBounce, HorizontalBounce})
-	if len(bouncesTemp) < 1 {
-		return Map{}, errors.New("no path found")
+func newSafeAreaIndex(safeAreas []rl.Rectangle, cfg Config) *spatialIndex {
+	safeAreaIndex := newSpatialIndex(spatialBucketSize(cfg))
+	for id, safeArea := range safeAreas {
+		safeAreaIndex.Insert(id, safeArea)
 	}
-	m.bounces = bouncesTemp
 
-	m.polygonPaths = polygonPaths
-	m.safeAreas = mergeOverlappingRects(safeAreas)
+	return safeAreaIndex
+}
+
+// collectBounceRects splits the bounce rects by their floating classification
+// and finds the reachable cells of the connected bounces
+func (m *Map) collectBounceRects(cfg Config, safeAreaIndex *spatialIndex) {
+	m.floatingBounceRects = nil
+	m.connectedBounceRects = nil
+	m.floatingBounceCounts = make([]int, 1, len(m.bounces)+1)
 
 	for i := range m.bounces {
 		b := &m.bounces[i]
 
-		bounceRect := b.ToRect()
+		bounceRect := b.ToRect(cfg)
 
-		if rectIsFloating(bounceRect, m.safeAreas) {
+		if b.isFloating {
 			m.floatingBounceRects = append(m.floatingBounceRects, bounceRect)
-			b.isFloating = true
+			m.floatingBounceCounts = append(m.floatingBounceCounts, m.floatingBounceCounts[i]+1)
 		} else {
+			m.floatingBounceCounts = append(m.floatingBounceCounts, m.floatingBounceCounts[i])
 			m.connectedBounceRects = append(m.connectedBounceRects, bounceRect)
 
-			reachableCells := findReachableCells(bounceRect, m.safeAreas, 75)
+			reachableCells := findReachableCells(bounceRect, m.safeAreas, safeAreaIndex, 75, cfg.CellSize)
 			b.reachableCells = reachableCells
 		}
 	}
-
-	// Post-process to adjust each bounce's speed based on next bounce's position and time
-	for i := range len(m.bounces) - 1 {
-		current := &m.bounces[i]
-		next := m.bounces[i+1]
-		deltaTime := next.timeSec - current.timeSec
-
-		var distance float32
-
-		if current.bounceDirection == VerticalBounce {
-			distance = float32(math.Abs(float64(next.position.X - current.position.X)))
-		} else {
-			distance = float32(math.Abs(float64(next.position.Y - current.position.Y)))
-		}
-
-		if deltaTime > 0 {
-			current.nextSpeed = distance / float32(deltaTime)
-		} else {
-			current.nextSpeed = float32(squareSpeed)
-		}
-	}
-
-	return m, nil
 }
 
-func rectIsFloating(rect rl.Rectangle, safeAreas []rl.Rectangle) bool {
-	for _, r := range safeAreas {
-		if rl.CheckCollisionRecs(rect, r) {
-			return true
-		}
-	}
+func rectIsFloating(rect rl.Rectangle, safeAreas []rl.Rectangle, safeAreaIndex *spatialIndex) bool {
+	floating := false
 
-	return false
+	safeAreaIndex.Query(rect, func(id int) bool {
+		floating = rl.CheckCollisionRecs(rect, safeAreas[id])
+		return !floating
+	})
+
+	return floating
 }
 
 func snapCoordinate(coord float32, cellSize, subCellSize float32) float32 {
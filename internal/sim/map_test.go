@@ -0,0 +1,105 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// testTimestamps returns count onsets a few eighths of a second apart, like a busy song at 120 bpm
+func testTimestamps(count int, seed int64) []float64 {
+	rng := rand.New(rand.NewSource(seed))
+	gaps := []float64{0.125, 0.25, 0.25, 0.375, 0.5}
+
+	timestamps := make([]float64, count)
+	timeSec := 0.0
+	for i := range timestamps {
+		timestamps[i] = timeSec
+		timeSec += gaps[rng.Intn(len(gaps))]
+	}
+
+	return timestamps
+}
+
+func testConfig(seed int64) Config {
+	cfg := DefaultConfig()
+	cfg.Seed = seed
+	return cfg
+}
+
+func TestGenerateMapDeterministic(t *testing.T) {
+	timestamps := [][]float64{testTimestamps(300, 1)}
+
+	first, err := GenerateMap(context.Background(), timestamps, testConfig(42), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateMap(context.Background(), timestamps, testConfig(42), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first.bounces) != 300 {
+		t.Fatalf("%d bounces for 300 notes", len(first.bounces))
+	}
+	for i := range first.bounces {
+		a, b := first.bounces[i], second.bounces[i]
+		if a.timeSec != b.timeSec || a.position != b.position || a.nextDirection != b.nextDirection || a.nextSpeed != b.nextSpeed {
+			t.Fatalf("bounce %d differs: %+v and %+v", i, a, b)
+		}
+	}
+}
+
+func TestGenerateMapCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the context is checked every progressInterval steps, a long song is still being solved by then
+	_, err := GenerateMap(ctx, [][]float64{testTimestamps(20_000, 1)}, testConfig(42), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestSquareStart(t *testing.T) {
+	params := DefaultConfig().MapParams
+
+	tests := []struct {
+		squareIdx int
+		want      rl.Vector2
+	}{
+		{0, rl.NewVector2(0, 0)},
+		{1, rl.NewVector2(100, -100)},
+		{2, rl.NewVector2(200, -200)},
+	}
+
+	for _, tt := range tests {
+		if got := squareStart(params, tt.squareIdx); got != tt.want {
+			t.Errorf("square %d: got %v, want %v", tt.squareIdx, got, tt.want)
+		}
+	}
+
+	// moving down right side by side, neighbouring squares never touch before their first bounce
+	velocity := rl.NewVector2(float32(params.SquareSpeed), float32(params.SquareSpeed))
+	for squareIdx := range 2 {
+		a := squareMotion{position: squareStart(params, squareIdx), velocity: velocity}
+		b := squareMotion{position: squareStart(params, squareIdx+1), velocity: velocity}
+		if squaresOverlap(a, b, 0, 60, float64(params.SquareSize)) {
+			t.Errorf("squares %d and %d overlap on their way from the start", squareIdx, squareIdx+1)
+		}
+	}
+}
+
+func BenchmarkGenerateMap(b *testing.B) {
+	timestamps := [][]float64{testTimestamps(2000, 1)}
+	cfg := testConfig(42)
+
+	for range b.N {
+		if _, err := GenerateMap(context.Background(), timestamps, cfg, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package sim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// version of the saved map formats, bump it whenever the layout of either format changes
+const mapFileVersion = 2
+
+// magic bytes at the start of a binary map file
+var mapFileMagic = [4]byte{'R', 'M', 'S', 'M'}
+
+var ErrUnsupportedMapFile = errors.New("unsupported map file")
+
+// mapFile is the JSON layout of a saved map
+type mapFile struct {
+	Version    int       `json:"version"`
+	SourceHash string    `json:"source_hash"`
+	Params     MapParams `json:"params"`
+
+	Bounces      []bounceRecord `json:"bounces"`
+	SafeAreas    []rectRecord   `json:"safe_areas"`
+	PolygonPaths [][][2]float32 `json:"polygon_paths"`
+}
+
+type bounceRecord struct {
+	Square          int             `json:"square"`
+	TimeSec         float64         `json:"time_sec"`
+	Position        [2]float32      `json:"position"`
+	NextDirection   [2]float32      `json:"next_direction"`
+	BounceDirection BounceDirection `json:"bounce_direction"`
+	NextSpeed       float32         `json:"next_speed"`
+	Floating        bool            `json:"floating"`
+}
+
+type rectRecord [4]float32
+
+// binaryBounce is the fixed size layout of a bounce in a binary map file
+type binaryBounce struct {
+	Square          uint16
+	TimeSec         float64
+	X, Y            float32
+	DirX, DirY      int8
+	BounceDirection uint8
+	NextSpeed       float32
+	Floating        bool
+}
+
+// SaveMap writes the map to path, as JSON if the extension is .json and in the binary format otherwise
+func SaveMap(m Map, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = m.WriteJSON(w)
+	} else {
+		err = m.WriteBinary(w)
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// LoadMap reads a map saved in either format, the format is detected from the content
+func LoadMap(path string) (Map, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Map{}, err
+	}
+	defer file.Close()
+
+	m, err := ReadMap(bufio.NewReader(file))
+	if err != nil {
+		return Map{}, fmt.Errorf("map %s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+func ReadMap(r *bufio.Reader) (Map, error) {
+	head, err := r.Peek(len(mapFileMagic))
+	if err != nil {
+		return Map{}, err
+	}
+
+	if bytes.Equal(head, mapFileMagic[:]) {
+		return readBinaryMap(r)
+	}
+
+	return readJSONMap(r)
+}
+
+func (m Map) toFile() mapFile {
+	f := mapFile{
+		Version:    mapFileVersion,
+		SourceHash: m.sourceHash,
+		Params:     m.params,
+	}
+
+	for _, b := range m.bounces {
+		f.Bounces = append(f.Bounces, bounceRecord{
+			Square:          b.square,
+			TimeSec:         b.timeSec,
+			Position:        [2]float32{b.position.X, b.position.Y},
+			NextDirection:   [2]float32{b.nextDirection.X, b.nextDirection.Y},
+			BounceDirection: b.bounceDirection,
+			NextSpeed:       b.nextSpeed,
+			Floating:        b.isFloating,
+		})
+	}
+
+	for _, r := range m.safeAreas {
+		f.SafeAreas = append(f.SafeAreas, rectRecord{r.X, r.Y, r.Width, r.Height})
+	}
+
+	for _, pp := range m.polygonPaths {
+		points := make([][2]float32, 0, len(pp))
+		for _, p := range pp {
+			points = append(points, [2]float32{p.X, p.Y})
+		}
+		f.PolygonPaths = append(f.PolygonPaths, points)
+	}
+
+	return f
+}
+
+// toMap rebuilds the map, only the reachable cells are recomputed, the map is not generated again
+func (f mapFile) toMap() (Map, error) {
+	if f.Version != mapFileVersion {
+		return Map{}, fmt.Errorf("%w: version %d, expected %d", ErrUnsupportedMapFile, f.Version, mapFileVersion)
+	}
+
+	cfg := f.Params.config()
+	if err := cfg.Validate(); err != nil {
+		return Map{}, err
+	}
+
+	m := Map{
+		params:     f.Params,
+		sourceHash: f.SourceHash,
+	}
+
+	for i, b := range f.Bounces {
+		// every square has a bounce, so there are no more squares than bounces
+		if b.Square < 0 || b.Square >= len(f.Bounces) {
+			return Map{}, fmt.Errorf("%w: bounce %d of square %d, the map has %d bounces", ErrUnsupportedMapFile, i, b.Square, len(f.Bounces))
+		}
+		if i > 0 && b.TimeSec < f.Bounces[i-1].TimeSec {
+			return Map{}, fmt.Errorf("%w: bounce %d is before the bounce ahead of it", ErrUnsupportedMapFile, i)
+		}
+
+		bounce := NewBounce(
+			i,
+			b.TimeSec,
+			rl.NewVector2(b.Position[0], b.Position[1]),
+			rl.NewVector2(b.NextDirection[0], b.NextDirection[1]),
+			b.BounceDirection,
+			b.NextSpeed,
+		)
+		bounce.square = b.Square
+		bounce.isFloating = b.Floating
+
+		m.bounces = append(m.bounces, *bounce)
+	}
+
+	m.indexSquares()
+	for squareIdx, bounceIdxs := range m.squareBounceIdxs {
+		if len(bounceIdxs) == 0 {
+			return Map{}, fmt.Errorf("%w: square %d has no bounces", ErrUnsupportedMapFile, squareIdx)
+		}
+	}
+
+	for _, r := range f.SafeAreas {
+		m.safeAreas = append(m.safeAreas, rl.NewRectangle(r[0], r[1], r[2], r[3]))
+	}
+
+	for _, points := range f.PolygonPaths {
+		pp := make(Polygon, 0, len(points))
+		for _, p := range points {
+			pp = append(pp, rl.NewVector2(p[0], p[1]))
+		}
+		m.polygonPaths = append(m.polygonPaths, pp)
+	}
+
+	m.collectBounceRects(cfg, newSafeAreaIndex(m.safeAreas, cfg))
+
+	return m, nil
+}
+
+func (m Map) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+
+	return encoder.Encode(m.toFile())
+}
+
+func readJSONMap(r io.Reader) (Map, error) {
+	var f mapFile
+
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return Map{}, err
+	}
+
+	return f.toMap()
+}
+
+// WriteBinary writes the map as little endian binary:
+// magic, version, source hash and JSON encoded params followed by the bounces, safe areas and path polygons
+func (m Map) WriteBinary(w io.Writer) error {
+	f := m.toFile()
+
+	params, err := json.Marshal(f.Params)
+	if err != nil {
+		return err
+	}
+
+	bw := binaryWriter{w: w}
+
+	bw.write(mapFileMagic)
+	bw.write(uint32(f.Version))
+	bw.writeBytes([]byte(f.SourceHash))
+	bw.writeBytes(params)
+
+	bw.write(uint32(len(f.Bounces)))
+	for _, b := range f.Bounces {
+		bw.write(binaryBounce{
+			Square:          uint16(b.Square),
+			TimeSec:         b.TimeSec,
+			X:               b.Position[0],
+			Y:               b.Position[1],
+			DirX:            int8(b.NextDirection[0]),
+			DirY:            int8(b.NextDirection[1]),
+			BounceDirection: uint8(b.BounceDirection),
+			NextSpeed:       b.NextSpeed,
+			Floating:        b.Floating,
+		})
+	}
+
+	bw.write(uint32(len(f.SafeAreas)))
+	for _, r := range f.SafeAreas {
+		bw.write(r)
+	}
+
+	bw.write(uint32(len(f.PolygonPaths)))
+	for _, points := range f.PolygonPaths {
+		bw.write(uint32(len(points)))
+		bw.write(points)
+	}
+
+	return bw.err
+}
+
+func readBinaryMap(r io.Reader) (Map, error) {
+	// read up front, the counts in the file are checked against the bytes left before anything is allocated
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Map{}, err
+	}
+	br := binaryReader{r: bytes.NewReader(data)}
+
+	var magic [4]byte
+	var version uint32
+
+	br.read(&magic)
+	br.read(&version)
+	if br.err != nil {
+		return Map{}, br.err
+	}
+	if version != mapFileVersion {
+		return Map{}, fmt.Errorf("%w: version %d, expected %d", ErrUnsupportedMapFile, version, mapFileVersion)
+	}
+
+	f := mapFile{Version: int(version)}
+	f.SourceHash = string(br.readBytes())
+
+	params := br.readBytes()
+	if br.err != nil {
+		return Map{}, br.err
+	}
+	if err := json.Unmarshal(params, &f.Params); err != nil {
+		return Map{}, err
+	}
+
+	bounceCount := br.readCount(binary.Size(binaryBounce{}))
+	for range bounceCount {
+		var b binaryBounce
+		br.read(&b)
+
+		f.Bounces = append(f.Bounces, bounceRecord{
+			Square:          int(b.Square),
+			TimeSec:         b.TimeSec,
+			Position:        [2]float32{b.X, b.Y},
+			NextDirection:   [2]float32{float32(b.DirX), float32(b.DirY)},
+			BounceDirection: BounceDirection(b.BounceDirection),
+			NextSpeed:       b.NextSpeed,
+			Floating:        b.Floating,
+		})
+	}
+
+	safeAreaCount := br.readCount(binary.Size(rectRecord{}))
+	for range safeAreaCount {
+		var r rectRecord
+		br.read(&r)
+		f.SafeAreas = append(f.SafeAreas, r)
+	}
+
+	polygonPathCount := br.readCount(binary.Size(uint32(0)))
+	for range polygonPathCount {
+		points := make([][2]float32, br.readCount(binary.Size([2]float32{})))
+		br.read(points)
+		f.PolygonPaths = append(f.PolygonPaths, points)
+	}
+
+	if br.err != nil {
+		return Map{}, br.err
+	}
+
+	return f.toMap()
+}
+
+// binaryWriter keeps the first error so a sequence of writes only has to be checked once
+type binaryWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (bw *binaryWriter) write(data any) {
+	if bw.err == nil {
+		bw.err = binary.Write(bw.w, binary.LittleEndian, data)
+	}
+}
+
+func (bw *binaryWriter) writeBytes(data []byte) {
+	bw.write(uint32(len(data)))
+	bw.write(data)
+}
+
+type binaryReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (br *binaryReader) read(data any) {
+	if br.err == nil {
+		br.err = binary.Read(br.r, binary.LittleEndian, data)
+	}
+}
+
+// readCount reads the length of a section of entries of entrySize bytes each. A section longer than the rest of the
+// file is an error, so a corrupt count never allocates more than the file holds.
+func (br *binaryReader) readCount(entrySize int) int {
+	var count uint32
+	br.read(&count)
+
+	if br.err == nil && uint64(count)*uint64(entrySize) > uint64(br.r.Len()) {
+		br.err = fmt.Errorf("%w: section of %d entries, only %d bytes left", ErrUnsupportedMapFile, count, br.r.Len())
+	}
+	if br.err != nil {
+		return 0
+	}
+
+	return int(count)
+}
+
+func (br *binaryReader) readBytes() []byte {
+	data := make([]byte, br.readCount(1))
+	br.read(data)
+
+	return data
+}
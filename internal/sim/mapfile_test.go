@@ -0,0 +1,178 @@
+package sim
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testMap(t *testing.T) Map {
+	t.Helper()
+
+	squareTimestamps := [][]float64{testTimestamps(60, 1), testTimestamps(40, 2)}
+	m, err := GenerateMap(context.Background(), squareTimestamps, testConfig(3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetSourceHash("abc")
+
+	return m
+}
+
+// checkSameMap compares everything a saved map stores and what is rebuilt from it on loading
+func checkSameMap(t *testing.T, got, want Map) {
+	t.Helper()
+
+	if got.params != want.params || got.sourceHash != want.sourceHash {
+		t.Errorf("params %+v and hash %q, want %+v and %q", got.params, got.sourceHash, want.params, want.sourceHash)
+	}
+	if len(got.bounces) != len(want.bounces) {
+		t.Fatalf("%d bounces, want %d", len(got.bounces), len(want.bounces))
+	}
+	for i := range got.bounces {
+		a, b := got.bounces[i], want.bounces[i]
+		if a.square != b.square || a.timeSec != b.timeSec || a.position != b.position || a.nextDirection != b.nextDirection ||
+			a.bounceDirection != b.bounceDirection || a.nextSpeed != b.nextSpeed || a.isFloating != b.isFloating ||
+			len(a.reachableCells) != len(b.reachableCells) {
+			t.Fatalf("bounce %d is %+v, want %+v", i, a, b)
+		}
+	}
+
+	for name, pair := range map[string][2]any{
+		"square bounces":         {got.squareBounceIdxs, want.squareBounceIdxs},
+		"safe areas":             {got.safeAreas, want.safeAreas},
+		"polygon paths":          {got.polygonPaths, want.polygonPaths},
+		"floating bounce counts": {got.floatingBounceCounts, want.floatingBounceCounts},
+		"floating bounce rects":  {got.floatingBounceRects, want.floatingBounceRects},
+	} {
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			t.Errorf("%s differ", name)
+		}
+	}
+}
+
+func TestMapFileRoundTrip(t *testing.T) {
+	m := testMap(t)
+
+	for _, format := range []struct {
+		name  string
+		write func(Map, *bytes.Buffer) error
+	}{
+		{"json", func(m Map, buf *bytes.Buffer) error { return m.WriteJSON(buf) }},
+		{"binary", func(m Map, buf *bytes.Buffer) error { return m.WriteBinary(buf) }},
+	} {
+		t.Run(format.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := format.write(m, &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := ReadMap(bufio.NewReader(&buf))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkSameMap(t, loaded, m)
+		})
+	}
+}
+
+// corruptJSON writes the map as JSON and lets edit change the decoded file before it is rebuilt
+func corruptJSON(t *testing.T, m Map, edit func(f *mapFile)) error {
+	t.Helper()
+
+	f := m.toFile()
+	edit(&f)
+
+	_, err := f.toMap()
+	return err
+}
+
+func TestMapFileInvalidSquares(t *testing.T) {
+	m := testMap(t)
+
+	tests := []struct {
+		name string
+		edit func(f *mapFile)
+	}{
+		{"negative square", func(f *mapFile) { f.Bounces[5].Square = -1 }},
+		{"square past the bounce count", func(f *mapFile) { f.Bounces[5].Square = len(f.Bounces) }},
+		{"huge square", func(f *mapFile) { f.Bounces[5].Square = 1 << 40 }},
+		{"square without bounces", func(f *mapFile) { f.Bounces[5].Square = 3 }},
+		{"bounces out of order", func(f *mapFile) { f.Bounces[5].TimeSec = f.Bounces[6].TimeSec + 1 }},
+		{"old version", func(f *mapFile) { f.Version = 1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := corruptJSON(t, m, tt.edit)
+			if !errors.Is(err, ErrUnsupportedMapFile) {
+				t.Errorf("got %v, want %v", err, ErrUnsupportedMapFile)
+			}
+		})
+	}
+
+	// the same through the JSON decoder
+	var buf bytes.Buffer
+	if err := m.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := strings.Replace(buf.String(), `"square": 0`, `"square": -1`, 1)
+	if _, err := ReadMap(bufio.NewReader(strings.NewReader(corrupt))); !errors.Is(err, ErrUnsupportedMapFile) {
+		t.Errorf("negative square in JSON: got %v", err)
+	}
+}
+
+func TestMapFileCorruptBinary(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testMap(t).WriteBinary(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	read := func(data []byte) error {
+		_, err := ReadMap(bufio.NewReader(bytes.NewReader(data)))
+		return err
+	}
+
+	// every truncation is an error, none of them panics
+	for length := len(mapFileMagic); length < len(data); length += 7 {
+		if err := read(data[:length]); err == nil {
+			t.Fatalf("no error for the file cut to %d of %d bytes", length, len(data))
+		}
+	}
+
+	// offset of the bounce count: magic, version, hash and params
+	hashLen := int(binary.LittleEndian.Uint32(data[8:]))
+	paramsOffset := 12 + hashLen
+	bounceCountOffset := paramsOffset + 4 + int(binary.LittleEndian.Uint32(data[paramsOffset:]))
+
+	tests := []struct {
+		name string
+		edit func(data []byte)
+	}{
+		{"version", func(data []byte) { binary.LittleEndian.PutUint32(data[4:], mapFileVersion+1) }},
+		{"huge hash length", func(data []byte) { binary.LittleEndian.PutUint32(data[8:], 1<<31) }},
+		{"huge bounce count", func(data []byte) { binary.LittleEndian.PutUint32(data[bounceCountOffset:], 1<<26) }},
+		{"square past the bounce count", func(data []byte) {
+			// Square is the first field of the first bounce
+			binary.LittleEndian.PutUint16(data[bounceCountOffset+4:], 500)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			corrupt := bytes.Clone(data)
+			tt.edit(corrupt)
+
+			if err := read(corrupt); !errors.Is(err, ErrUnsupportedMapFile) {
+				t.Errorf("got %v, want %v", err, ErrUnsupportedMapFile)
+			}
+		})
+	}
+}
@@ -125,7 +125,8 @@ func isNeighboring(a, b rl.Rectangle, offset float32) bool {
 
 // MergeOverlappingRects takes a list of rectangles and merges any that overlap
 // or share an edge. It returns a new slice of merged rectangles.
-func mergeOverlappingRects(rects []rl.Rectangle) []rl.Rectangle {
+// Merge candidates are looked up in a spatial index with buckets of bucketSize.
+func mergeOverlappingRects(rects []rl.Rectangle, bucketSize float32) []rl.Rectangle {
 	// First, filter out any rectangles that have zero or negative width/height.
 	var filtered []rl.Rectangle
 	for _, r := range rects {
@@ -135,42 +136,65 @@ func mergeOverlappingRects(rects []rl.Rectangle) []rl.Rectangle {
 		filtered = append(filtered, r)
 	}
 
-	// We'll iteratively merge rectangles until no more merges can be done.
+	// Every rectangle gets an id, merged rectangles are appended with a new id
 	mergedRects := slices.Clone(filtered)
+	alive := make([]bool, len(mergedRects))
+	index := newSpatialIndex(bucketSize)
+
+	queue := make([]int, 0, len(mergedRects))
+	for id, r := range mergedRects {
+		alive[id] = true
+		index.Insert(id, r)
+		queue = append(queue, id)
+	}
 
-	for {
-		mergedAnything := false
-
-		// Attempt to merge pairs of rectangles
-	outer:
-		for i := range mergedRects {
-			for j := i + 1; j < len(mergedRects); j++ {
-				if canMerge(mergedRects[i], mergedRects[j]) {
-					// Merge them into bounding rect
-					newRect := mergeRect(mergedRects[i], mergedRects[j])
-
-					// Remove the two old ones from the slice
-					mergedRects = slices.Delete(mergedRects, i, i+1)
-					// After removal at i, j shifts left by 1
-					j--
-					mergedRects = slices.Delete(mergedRects, j, j+1)
+	// Each rectangle is checked once against the rectangles touching it, a merged rectangle
+	// goes back in the queue, so once the queue is empty no more merges can be done.
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
 
-					// Add the merged rectangle
-					mergedRects = append(mergedRects, newRect)
+		if !alive[id] {
+			continue
+		}
 
-					mergedAnything = true
-					// Break out so we start from scratch again
-					break outer
-				}
+		// disjoint rectangles can never merge, so only the touching ones are candidates
+		partner := -1
+		index.Query(mergedRects[id], func(otherId int) bool {
+			if otherId != id && (partner == -1 || otherId < partner) && canMerge(mergedRects[id], mergedRects[otherId]) {
+				partner = otherId
 			}
+			return true
+		})
+
+		if partner == -1 {
+			continue
 		}
 
-		if !mergedAnything {
-			break
+		// Merge them into bounding rect
+		newRect := mergeRect(mergedRects[id], mergedRects[partner])
+
+		// Remove the two old ones
+		alive[id], alive[partner] = false, false
+		index.Remove(id)
+		index.Remove(partner)
+
+		// Add the merged rectangle
+		newId := len(mergedRects)
+		mergedRects = append(mergedRects, newRect)
+		alive = append(alive, true)
+		index.Insert(newId, newRect)
+		queue = append(queue, newId)
+	}
+
+	result := make([]rl.Rectangle, 0, len(mergedRects))
+	for id, r := range mergedRects {
+		if alive[id] {
+			result = append(result, r)
 		}
 	}
 
-	return mergedRects
+	return result
 }
 
 // canMerge returns true if two rectangles overlap or share an edge (meaning
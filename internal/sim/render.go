@@ -0,0 +1,139 @@
+package sim
+
+import (
+	"context"
+	"image"
+	"math"
+
+	"ray_midi_sim/internal/canvas"
+	"ray_midi_sim/internal/canvas/rlcanvas"
+	"ray_midi_sim/internal/video"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// seconds rendered after the last bounce so the final bounce animation plays out
+const renderTailSec = 2.0
+
+type RenderBackend int
+
+const (
+	RaylibBackend   RenderBackend = iota // draws on the GPU through a hidden raylib window
+	SoftwareBackend                      // draws in pure Go, needs neither a GPU nor a window
+)
+
+type RenderProgress struct {
+	Frame      int // number of frames written so far
+	FrameCount int
+}
+
+type RenderProgressFunc func(RenderProgress)
+
+// Render is used instead of Init and Run. It steps the simulation at the config FPS and hands every frame to w.
+// Frame n shows the time n/FPS of the audio, so the video lines up with the WAV without any start delay.
+// No audio device is opened, the raylib backend opens a hidden window since raylib needs it for the GL context.
+func (s *Simulation) Render(ctx context.Context, backend RenderBackend, w video.FrameWriter, onProgress RenderProgressFunc) error {
+	if err := s.cfg.Validate(); err != nil {
+		return err
+	}
+	if err := s.validateExcerpt(); err != nil {
+		return err
+	}
+
+	if err := s.initMap(ctx); err != nil {
+		return err
+	}
+
+	// drawFrame draws the current state and returns the frame, the frame is reused for the next one
+	var drawFrame func() *image.RGBA
+
+	switch backend {
+	case SoftwareBackend:
+		c := canvas.NewSoftware(s.cfg.WindowWidth, s.cfg.WindowHeight)
+
+		drawFrame = func() *image.RGBA {
+			s.drawFrame(c)
+			return c.Image()
+		}
+	default:
+		rl.SetConfigFlags(rl.FlagWindowHidden)
+		rl.InitWindow(int32(s.cfg.WindowWidth), int32(s.cfg.WindowHeight), "RAY MIDI SIM")
+		defer rl.CloseWindow()
+
+		target := rl.LoadRenderTexture(int32(s.cfg.WindowWidth), int32(s.cfg.WindowHeight))
+		defer rl.UnloadRenderTexture(target)
+
+		frame := image.NewRGBA(image.Rect(0, 0, s.cfg.WindowWidth, s.cfg.WindowHeight))
+
+		drawFrame = func() *image.RGBA {
+			rl.BeginTextureMode(target)
+			s.drawFrame(rlcanvas.New())
+			rl.EndTextureMode()
+
+			readFrame(target, frame)
+			return frame
+		}
+	}
+
+	progress := RenderProgress{FrameCount: int(math.Ceil(s.renderEndSec()*float64(s.cfg.FPS))) + 1}
+	frameIncrement := s.cfg.FrameIncrement()
+
+	for frameIdx := range progress.FrameCount {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// the time is computed from the frame index, adding up increments would drift over a long song
+		s.step(float64(frameIdx)*frameIncrement, float32(frameIncrement))
+
+		if err := w.WriteFrame(drawFrame()); err != nil {
+			return err
+		}
+
+		progress.Frame = frameIdx + 1
+		if onProgress != nil {
+			onProgress(progress)
+		}
+	}
+
+	return nil
+}
+
+// renderEndSec returns how long the video is, the final bounce animation plays out after the last bounce.
+// An excerpt with an end is exactly as long as the audio sliced the same way.
+func (s *Simulation) renderEndSec() float64 {
+	endTimeSec := renderTailSec
+	if len(s.generatedMap.bounces) > 0 {
+		endTimeSec += s.generatedMap.bounces[len(s.generatedMap.bounces)-1].timeSec
+	}
+
+	if s.hasExcerpt() && !math.IsInf(s.excerptEndSec, 1) {
+		endTimeSec = s.excerptEndSec - s.excerptStartSec
+
+		// the excerpt can reach past the end of the song
+		if s.midi.TrackCount() > 0 {
+			endTimeSec = min(endTimeSec, s.midi.Duration())
+		}
+	}
+
+	return endTimeSec
+}
+
+// readFrame copies the render texture into frame
+func readFrame(target rl.RenderTexture2D, frame *image.RGBA) {
+	img := rl.LoadImageFromTexture(target.Texture)
+	defer rl.UnloadImage(img)
+
+	// render textures are stored bottom up
+	rl.ImageFlipVertical(img)
+
+	colors := rl.LoadImageColors(img)
+	defer rl.UnloadImageColors(colors)
+
+	for i, c := range colors {
+		frame.Pix[i*4+0] = c.R
+		frame.Pix[i*4+1] = c.G
+		frame.Pix[i*4+2] = c.B
+		frame.Pix[i*4+3] = c.A
+	}
+}
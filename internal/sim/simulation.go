@@ -1,72 +1,409 @@
 package sim
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+
+	"ray_midi_sim/internal/audio"
+	"ray_midi_sim/internal/canvas"
+	"ray_midi_sim/internal/canvas/rlcanvas"
 	"ray_midi_sim/internal/midi"
+	"ray_midi_sim/internal/source"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
+var (
+	ErrMapSourceMismatch = errors.New("map was not generated from this MIDI file")
+	ErrNoAudio           = errors.New("no WAV file given and no MIDI file and synthesizer to create one")
+	ErrInvalidExcerpt    = errors.New("invalid excerpt")
+)
+
 type Simulation struct {
+	cfg Config
+
 	// paths
 	midPath string
-	wavPath string
+	wavPath string // synthesized from the MIDI file if empty
+	mapPath string // saved map to play instead of generating one, optional
+
+	// creates the WAV file when none is given, can be nil
+	synth midi.Synthesizer
+
+	// onsets the map is generated from, one source per square, the MIDI file or the WAV file if empty
+	sources []source.TimestampSource
+
+	// generated maps are looked up here first and stored after generating, can be nil
+	mapCache *MapCache
+
+	// midi tracks used for the map, all tracks if empty
+	trackIndexes []int
+
+	// part of the song that is played, the whole song if excerptEndSec is 0
+	excerptStartSec float64
+	excerptEndSec   float64
+
+	// called while the map is being generated, can be nil
+	onProgress ProgressFunc
 
 	// requires initialisation
 	generatedMap     Map
 	midi             midi.Midi
 	music            rl.Music
-	noteOnTimestamps []float64
-	square           Square
+	tempWavPath      string                // synthesized WAV file, removed once the simulation ends
+	noteOnTimestamps [][]float64           // of every square
+	thinnedOnsets    [][]midi.ThinnedOnset // of every square, onsets dropped as too close together for the square
+	downbeats        []float64             // start of every bar in seconds, empty without a MIDI file
+	squares          []Square
 	camera           rl.Camera2D
+	rng              *rand.Rand
+	clock            Clock
 
 	// simulation state
+	paused             bool
+	scrubbing          bool // the timeline is being dragged
+	musicStarted       bool
 	squareMoving       bool
-	startTimeSec       float64
 	currentTimeSec     float64
 	bounceIdx          int
 	floatingBounceIdx  int
 	connectedBounceIdx int
 }
 
-func New(midPath, wavPath string) Simulation {
+func New(cfg Config, midPath, wavPath string, trackIndexes ...int) Simulation {
 	return Simulation{
-		midPath: midPath,
-		wavPath: wavPath,
+		cfg:          cfg,
+		midPath:      midPath,
+		wavPath:      wavPath,
+		trackIndexes: trackIndexes,
+	}
+}
+
+func (s *Simulation) SetProgressFunc(onProgress ProgressFunc) {
+	s.onProgress = onProgress
+}
+
+// SetMapPath makes Init load the saved map at mapPath instead of generating a new one
+func (s *Simulation) SetMapPath(mapPath string) {
+	s.mapPath = mapPath
+}
+
+// SetMapCache makes Init reuse a cached map generated from the same notes and map params. Maps with a random seed (0)
+// are neither looked up nor stored.
+func (s *Simulation) SetMapCache(mapCache *MapCache) {
+	s.mapCache = mapCache
+}
+
+// SetTimestampSources makes Init generate the map from the onsets of srcs instead of the MIDI or WAV file,
+// with a square for every source that bounces on its onsets
+func (s *Simulation) SetTimestampSources(srcs ...source.TimestampSource) {
+	s.sources = srcs
+}
+
+// SetExcerpt plays only the part of the song from startSec up to endSec, which can be +Inf for the rest of the song.
+// The MIDI file, the onsets and the audio are all sliced, so the map starts at the start of the excerpt.
+func (s *Simulation) SetExcerpt(startSec, endSec float64) {
+	s.excerptStartSec = startSec
+	s.excerptEndSec = endSec
+}
+
+func (s *Simulation) hasExcerpt() bool {
+	return s.excerptEndSec != 0
+}
+
+func (s *Simulation) validateExcerpt() error {
+	switch {
+	case !s.hasExcerpt():
+		return nil
+	case s.excerptStartSec < 0 || s.excerptEndSec <= s.excerptStartSec:
+		return fmt.Errorf("%w: from %vs to %vs", ErrInvalidExcerpt, s.excerptStartSec, s.excerptEndSec)
+	case s.mapPath != "":
+		return fmt.Errorf("%w: a saved map can not be sliced", ErrInvalidExcerpt)
+	default:
+		return nil
 	}
 }
 
-func (s *Simulation) Init() error {
+// SetSynthesizer makes Init synthesize the WAV file from the MIDI file when no WAV file is given
+func (s *Simulation) SetSynthesizer(synth midi.Synthesizer) {
+	s.synth = synth
+}
+
+// ThinnedOnsets returns the onsets of every square that were dropped from the map as too close together for it, with
+// the reason for each. The times are those of the whole song, also for an excerpt.
+func (s *Simulation) ThinnedOnsets() [][]midi.ThinnedOnset {
+	return s.thinnedOnsets
+}
+
+func (s *Simulation) Init(ctx context.Context) error {
+	if err := s.cfg.Validate(); err != nil {
+		return err
+	}
+	if err := s.validateExcerpt(); err != nil {
+		return err
+	}
+	if s.wavPath == "" && (s.synth == nil || s.midPath == "") {
+		return ErrNoAudio
+	}
+
+	// the map can take long to generate and fail, the window only opens once it is there
+	if err := s.initMap(ctx); err != nil {
+		return err
+	}
+
 	// initialise raylib stuff
-	rl.InitWindow(WINDOW_WIDTH, WINDOW_HEIGHT, "RAY MIDI SIM")
+	rl.InitWindow(int32(s.cfg.WindowWidth), int32(s.cfg.WindowHeight), "RAY MIDI SIM")
 	rl.SetConfigFlags(rl.FlagMsaa4xHint | rl.FlagVsyncHint)
-	rl.SetTargetFPS(FPS)
+	rl.SetTargetFPS(int32(s.cfg.FPS))
 	rl.InitAudioDevice()
 
-	s.music = rl.LoadMusicStream(s.wavPath)
+	if err := s.initMusic(ctx); err != nil {
+		rl.CloseAudioDevice()
+		rl.CloseWindow()
+		return err
+	}
 
-	// initialise midi stuff
-	midiTemp, err := midi.New(s.midPath)
+	return nil
+}
+
+// initMusic loads the WAV file, synthesizing it from the MIDI file first if none was given.
+// For an excerpt the WAV file is sliced, a synthesized one already comes from the sliced MIDI file.
+func (s *Simulation) initMusic(ctx context.Context) error {
+	wavPath := s.wavPath
+
+	if wavPath == "" || s.hasExcerpt() {
+		wavFile, err := os.CreateTemp("", "ray_midi_sim-*.wav")
+		if err != nil {
+			return err
+		}
+		wavFile.Close()
+		s.tempWavPath = wavFile.Name()
+
+		if wavPath == "" {
+			err = s.midi.ToWav(ctx, s.synth, s.tempWavPath)
+			if err != nil {
+				err = fmt.Errorf("synthesizing %s: %w", s.midPath, err)
+			}
+		} else {
+			err = audio.SliceWAV(wavPath, s.tempWavPath, s.excerptStartSec, s.excerptEndSec)
+		}
+		if err != nil {
+			os.Remove(s.tempWavPath)
+			return err
+		}
+
+		wavPath = s.tempWavPath
+	}
+
+	s.music = rl.LoadMusicStream(wavPath)
+	// a looping stream would wrap the played time back to 0 under the clock
+	s.music.Looping = false
+
+	return nil
+}
+
+// initMap loads or generates the map and places the square, it does not need a window or audio device
+func (s *Simulation) initMap(ctx context.Context) error {
+	if s.mapPath != "" {
+		if err := s.loadMap(); err != nil {
+			return err
+		}
+	} else {
+		if err := s.generateMap(ctx); err != nil {
+			return err
+		}
+	}
+
+	// downbeats drive the camera pulse, independently of the notes
+	if s.midi.TrackCount() > 0 {
+		s.downbeats = s.midi.TempoMap().Downbeats(s.midi.Duration())
+	}
+
+	// visuals are seeded from the map as well so a replay looks the same
+	s.rng = rand.New(rand.NewSource(s.generatedMap.Seed()))
+
+	// initialise squares
+	s.squares = nil
+	for squareIdx := range max(1, s.generatedMap.SquareCount()) {
+		start := squareStart(s.cfg.MapParams, squareIdx)
+		s.squares = append(s.squares, NewSquare(s.cfg, start, rl.NewVector2(1, 1), float32(s.cfg.SquareSpeed)))
+	}
+	s.camera = rl.NewCamera2D(s.cfg.WindowCenter(), s.squaresCenter(), 0, 1)
+
+	return nil
+}
+
+func (s *Simulation) generateMap(ctx context.Context) error {
+	sourceHash, err := s.loadTimestamps()
 	if err != nil {
 		return err
 	}
-	s.midi = midiTemp
 
-	// s.midi.TrimByDuration(5)
+	// a random seed asks for a new map every time, only maps of a fixed seed are cached
+	useCache := s.mapCache != nil && s.cfg.Seed != 0
+
+	var cacheKey string
+	if useCache {
+		cacheKey = MapCacheKey(s.noteOnTimestamps, s.cfg.MapParams)
+
+		if cachedMap, ok := s.mapCache.Load(cacheKey); ok {
+			cachedMap.SetSourceHash(sourceHash)
 
-	noteOnTimestamps := s.midi.ExtractNoteOnTimestamps()
-	noteOnTimestampsFiltered := midi.FilterTimestampsByCloseness(noteOnTimestamps, CLOSENESS_THRESHOLD_MS)
-	s.noteOnTimestamps = noteOnTimestampsFiltered
+			s.cfg.MapParams = cachedMap.Params()
+			s.generatedMap = cachedMap
+
+			return nil
+		}
+	}
 
 	// generate map
-	generatedMapTemp, err := GenerateMap(s.noteOnTimestamps, SQUARE_SPEED)
+	generatedMapTemp, err := GenerateMap(ctx, s.noteOnTimestamps, s.cfg, s.onProgress)
 	if err != nil {
 		return err
 	}
+	generatedMapTemp.SetSourceHash(sourceHash)
 	s.generatedMap = generatedMapTemp
 
-	// initialise square
-	s.square = NewSquare(rl.NewVector2(0, 0), rl.NewVector2(1, 1), SQUARE_SPEED)
-	s.camera = rl.NewCamera2D(WINDOW_CENTER_VECTOR, s.square.GetPosition(), 0, 1)
+	if useCache {
+		if err := s.mapCache.Store(cacheKey, s.generatedMap); err != nil {
+			return fmt.Errorf("caching map: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// loadTimestamps reads the onsets of every square from its timestamp source and returns the hash of their data,
+// the hashes of sources with different data are joined by commas
+func (s *Simulation) loadTimestamps() (string, error) {
+	// the MIDI file also gives the downbeats and the audio, even when the onsets come from elsewhere
+	if s.midPath != "" {
+		if err := s.loadMidi(); err != nil {
+			return "", err
+		}
+	}
+
+	srcs := s.sources
+	if len(srcs) == 0 {
+		src, err := s.defaultSource()
+		if err != nil {
+			return "", err
+		}
+		srcs = []source.TimestampSource{src}
+	}
+
+	s.noteOnTimestamps = nil
+	s.thinnedOnsets = nil
+
+	var hashes []string
+	for _, src := range srcs {
+		// the whole song is thinned so an excerpt keeps the onsets it has in the song
+		thinned, err := s.cfg.ThinSource(src)
+		if err != nil {
+			return "", err
+		}
+		src = thinned
+
+		if s.hasExcerpt() {
+			src = source.Slice(src, s.excerptStartSec, s.excerptEndSec)
+		}
+
+		timestamps, err := src.Timestamps()
+		if err != nil {
+			return "", err
+		}
+		s.noteOnTimestamps = append(s.noteOnTimestamps, timestamps)
+		s.thinnedOnsets = append(s.thinnedOnsets, thinned.Removed())
+
+		hash, err := src.Hash()
+		if err != nil {
+			return "", err
+		}
+		if !slices.Contains(hashes, hash) {
+			hashes = append(hashes, hash)
+		}
+	}
+
+	return strings.Join(hashes, ","), nil
+}
+
+// defaultSource takes the notes of the MIDI file, every group of notes starting together is a single bounce.
+// Without a MIDI file it detects the onsets of the WAV file.
+func (s *Simulation) defaultSource() (source.TimestampSource, error) {
+	if s.midPath == "" {
+		return source.NewWAVOnsets(s.wavPath, s.cfg.OnsetParams()), nil
+	}
+
+	pipeline, err := s.cfg.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	src := source.NewMIDI(s.midPath, midi.TrackSelector(s.trackIndexes...), s.cfg.OnsetTolerance())
+	src.SetPipeline(pipeline)
+
+	return src, nil
+}
+
+// loadMidi reads the MIDI file and applies the transforms of the config and the excerpt, so the downbeats and
+// the synthesized audio match the notes the map is generated from
+func (s *Simulation) loadMidi() error {
+	pipeline, err := s.cfg.Pipeline()
+	if err != nil {
+		return err
+	}
+
+	midiTemp, err := midi.New(s.midPath)
+	if err != nil {
+		return err
+	}
+
+	if s.hasExcerpt() {
+		pipeline = pipeline.Slice(s.excerptStartSec, s.excerptEndSec)
+	}
+
+	if err := pipeline.Apply(&midiTemp); err != nil {
+		return fmt.Errorf("%s: %w", s.midPath, err)
+	}
+	s.midi = midiTemp
+
+	return nil
+}
+
+// loadMap loads the saved map, the MIDI file is optional but has to be the one the map was made from if given
+func (s *Simulation) loadMap() error {
+	loadedMap, err := LoadMap(s.mapPath)
+	if err != nil {
+		return err
+	}
+
+	if s.midPath != "" {
+		sourceHash, err := midi.HashFile(s.midPath)
+		if err != nil {
+			return err
+		}
+		if loadedMap.SourceHash() != "" && loadedMap.SourceHash() != sourceHash {
+			return fmt.Errorf("%w: %s", ErrMapSourceMismatch, s.midPath)
+		}
+
+		if err := s.loadMidi(); err != nil {
+			return err
+		}
+	}
+
+	// the map geometry depends on the params it was generated with, not on the ones passed in
+	s.cfg.MapParams = loadedMap.Params()
+	s.generatedMap = loadedMap
+
+	s.noteOnTimestamps = make([][]float64, loadedMap.SquareCount())
+	for _, b := range loadedMap.bounces {
+		s.noteOnTimestamps[b.square] = append(s.noteOnTimestamps[b.square], b.timeSec)
+	}
 
 	return nil
 }
@@ -74,182 +411,219 @@ func (s *Simulation) Init() error {
 func (s *Simulation) update() {
 	rl.UpdateMusicStream(s.music)
 
-	dt := rl.GetFrameTime()
-	s.currentTimeSec = rl.GetTime() - s.startTimeSec
-	s.bounceIdx = s.floatingBounceIdx + s.connectedBounceIdx
+	s.handleInput()
 
-	// update color waves
-	for _, wave := range colorWaves {
-		wave.Update(dt)
+	// zoom in/out with mouse wheel (TEMPORARY FOR TESTING)
+	s.camera.Zoom += rl.GetMouseWheelMove() * 0.05
+
+	// while paused or scrubbing the time stands still, the last step already shows it
+	if s.paused || s.scrubbing {
+		return
 	}
 
-	// start music and square movement
-	if s.currentTimeSec >= 0.0 && !rl.IsMusicStreamPlaying(s.music) {
-		rl.PlayMusicStream(s.music)
+	dt := rl.GetFrameTime()
 
-		s.squareMoving = true
+	// start music
+	if s.clock.AudioSec() >= 0.0 && !s.musicStarted {
+		rl.PlayMusicStream(s.music)
+		s.musicStarted = true
 	}
 
-	// handle bounce
-	if s.bounceIdx < len(s.generatedMap.bounces) && s.currentTimeSec >= float64(s.generatedMap.bounces[s.bounceIdx].timeSec) {
-		currentBounce := s.generatedMap.bounces[s.bounceIdx]
+	// follow the music while it plays, before and after it the clock runs on the frame time
+	if rl.IsMusicStreamPlaying(s.music) {
+		s.clock.Sync(float64(dt), float64(rl.GetMusicTimePlayed(s.music)))
+	} else {
+		s.clock.Advance(float64(dt))
+	}
 
-		s.square.Bounce(currentBounce, s.bounceIdx)
+	s.step(s.clock.TimeSec(), dt)
+}
 
-		if currentBounce.IsFloating() {
-			s.floatingBounceIdx++
-		} else {
-			s.connectedBounceIdx++
-		}
+// step advances the simulation to timeSec, dt is the time since the previous step.
+// The squares are placed from the map at timeSec so every frame is exact, no matter how coarse the steps are.
+func (s *Simulation) step(timeSec float64, dt float32) {
+	s.currentTimeSec = timeSec
 
-		s.bounceIdx++
+	// update color waves
+	for _, wave := range colorWaves {
+		wave.Update(dt)
 	}
 
-	if s.bounceIdx >= len(s.generatedMap.bounces) {
-		s.squareMoving = false
+	state := s.generatedMap.StateAt(timeSec)
+
+	// trigger the effects of the bounces passed since the previous step
+	for ; s.bounceIdx < state.BounceIdx; s.bounceIdx++ {
+		bounce := s.generatedMap.bounces[s.bounceIdx]
+		s.squares[bounce.square].Bounce(bounce, s.bounceIdx, s.rng)
 	}
 
-	// update square movement
-	if s.squareMoving {
-		s.square.Update(dt)
+	s.bounceIdx = state.BounceIdx
+	s.floatingBounceIdx = state.FloatingBounceIdx
+	s.connectedBounceIdx = state.ConnectedBounceIdx
+
+	s.squareMoving = false
+	for i, squareState := range state.Squares {
+		s.squares[i].SetState(squareState)
+		s.squareMoving = s.squareMoving || squareState.Moving
 	}
 
 	// update camera
-	centeredSquarePos := rl.Vector2AddValue(s.square.GetPosition(), SQUARE_SIZE/2)
-	followCameraSmooth(&s.camera, centeredSquarePos, dt)
+	followCameraSmooth(&s.camera, s.squaresCenter(), s.cfg.WindowCenter(), dt)
+}
 
-	// zoom in/out with mouse wheel (TEMPORARY FOR TESTING)
-	s.camera.Zoom += rl.GetMouseWheelMove() * 0.05
+// squaresCenter returns the point the camera follows, the center of the box around every square
+func (s *Simulation) squaresCenter() rl.Vector2 {
+	minPos := s.squares[0].GetPosition()
+	maxPos := minPos
+
+	for i := range s.squares[1:] {
+		pos := s.squares[i+1].GetPosition()
+		minPos = rl.NewVector2(min(minPos.X, pos.X), min(minPos.Y, pos.Y))
+		maxPos = rl.NewVector2(max(maxPos.X, pos.X), max(maxPos.Y, pos.Y))
+	}
+
+	center := rl.Vector2Scale(rl.Vector2Add(minPos, maxPos), 0.5)
+	return rl.Vector2AddValue(center, float32(s.cfg.SquareSize/2))
 }
 
 func (s *Simulation) draw() {
-	cameraRect := GetCameraRect(s.camera, WINDOW_WIDTH, WINDOW_HEIGHT)
-	startX, endX, startY, endY := GetCameraBoundaries(cameraRect, CELL_SIZE)
-
 	rl.BeginDrawing()
+	c := rlcanvas.New()
+	s.drawFrame(c)
+	s.drawTimeline(c)
+	rl.EndDrawing()
+}
+
+// drawFrame draws the current state on c
+func (s *Simulation) drawFrame(c canvas.Canvas) {
+	camera := s.camera
+	camera.Zoom *= 1 + s.beatPulse(s.currentTimeSec)
+
+	cameraRect := GetCameraRect(camera, int32(s.cfg.WindowWidth), int32(s.cfg.WindowHeight))
+	startX, endX, startY, endY := GetCameraBoundaries(cameraRect, int32(s.cfg.CellSize))
+
+	// TODO make background color a constant
+	// rl.ClearBackground(rl.White)
+
+	// clear background with gradient
+	c.DrawRectangleGradientV(canvas.Rect{Width: float32(s.cfg.WindowWidth), Height: float32(s.cfg.WindowHeight)}, rl.NewColor(124, 0, 1, 255), rl.Black)
+	c.BeginCamera(toCanvasCamera(camera))
 	{
-		// TODO make background color a constant
-		// rl.ClearBackground(rl.White)
-
-		// clear background with gradient
-		rl.DrawRectangleGradientV(0, 0, WINDOW_WIDTH, WINDOW_HEIGHT, rl.NewColor(124, 0, 1, 255), rl.Black)
-		rl.BeginMode2D(s.camera)
-		{
-			// toBeDrawn := make([]int, 0)
-
-			// // // draw color waves
-			// for _, bounce := range s.generatedMap.bounces[:s.bounceIdx] {
-			// 	if bounce.IsFloating() {
-			// 		continue
-			// 	}
-
-			// 	// TODO optimise this by only checking the color wave rect that the bounce is in
-			// 	// TODO check center of cell instead of only top left corner (otherwise the expansion will be faster on some cells)
-			// 	// TODO general cleanup/optimisation of code
-			// 	// TODO improve cell finding algorithm
-			// 	// TODO add different colors for different bounces
-			// 	// TODO add lines of color within a color wave
-
-			// 	// TODO image pixel art idea on the color wave expansion
-
-			// 	for i, wave := range colorWaves {
-			// 		// if wave.bounceIdx == bounce.id {
-			// 		// 	// only draw the color wave if it's within the camera view
-			// 		// 	// if !rl.CheckCollisionRecs(wave.rect, cameraRect) {
-			// 		// 	// 	continue
-			// 		// 	// }
-
-			// 		// 	if wave.isExpanding {
-			// 		// 		if len(wave.cells) == len(bounce.reachableCells) {
-			// 		// 			wave.isExpanding = false
-			// 		// 		}
-
-			// 		// 		if !rl.CheckCollisionCircleRec(wave.center, wave.radius, cameraRect) {
-			// 		// 			continue
-			// 		// 		}
-
-			// 		// 		for _, c := range bounce.reachableCells {
-			// 		// 			if rl.CheckCollisionPointCircle(c.pos, wave.center, wave.radius) {
-			// 		// 				wave.AddCell(c)
-			// 		// 			}
-			// 		// 		}
-
-			// 		// 		rl.DrawCircleGradient(int32(wave.center.X), int32(wave.center.Y), wave.radius, rl.Fade(wave.color, 0), rl.Fade(wave.color, 100))
-			// 		// 	}
-
-			// 		// 	cellRects := make([]rl.Rectangle, 0)
-			// 		// 	for _, c := range wave.cells {
-			// 		// 		cellRects = append(cellRects, c.ToRect())
-			// 		// 	}
-
-			// 		// 	for _, c := range wave.cells {
-			// 		// 		rl.DrawRectangleRec(c.ToRect(), wave.color)
-			// 		// 	}
-			// 		// 	// drawGridInsideRects(startX, endX, startY, endY, CELL_SIZE, rl.Maroon, cellRects)
-			// 		// 	// rl.DrawCircleLinesV(wave.center, wave.radius, rl.Black)
-
-			// 		// 	break
-			// 		// }
-
-			// 		if wave.bounceIdx == bounce.id {
-			// 			if !rl.CheckCollisionRecs(wave.rect, cameraRect) {
-			// 				continue
-			// 			}
-
-			// 			// if wave.isExpanding {
-			// 			// 	inflatedRect := rl.NewRectangle(wave.rect.X-CELL_SIZE/2, wave.rect.Y-CELL_SIZE/2, wave.rect.Width+CELL_SIZE, wave.rect.Height+CELL_SIZE)
-			// 			// 	rl.DrawRectangleRec(inflatedRect, rl.Black)
-			// 			// }
-
-			// 			toBeDrawn = append(toBeDrawn, i)
-
-			// 			break
-			// 		}
-			// 	}
-
-			// 	// 	// for _, i := range toBeDrawn {
-			// 	// 	// 	rl.DrawRectangleRec(colorWaves[i].rect, colorWaves[i].color)
-			// 	// 	// }
-
-			// 	// 	// drawGridIncludeExcludeRects(startX, endX, startY, endY, CELL_SIZE, rl.Orange, toBeDrawn, s.generatedMap.safeAreas)
-			// }
-
-			// for _, i := range toBeDrawn {
-			// 	rl.DrawRectangleRec(colorWaves[i].rect, colorWaves[i].color)
-			// }
-
-			// for _, safeArea := range s.generatedMap.safeAreas {
-			// 	rl.DrawRectangleRec(safeArea, rl.NewColor(140, 140, 140, 255))
-			// }
-
-			// for _, i := range toBeDrawn {
-			// 	rl.DrawRectangleLinesEx(colorWaves[i].rect, 1, rl.Black)
-			// }
-
-			// draw grid
-			drawGridOutsideRects(startX, endX, startY, endY, CELL_SIZE, rl.Black, s.generatedMap.safeAreas)
-
-			merged := make([]rl.Rectangle, 0)
-			for _, bounce := range s.generatedMap.bounces {
-				merged = append(merged, bounce.ToRect())
-			}
+		// toBeDrawn := make([]int, 0)
+
+		// // // draw color waves
+		// for _, bounce := range s.generatedMap.bounces[:s.bounceIdx] {
+		// 	if bounce.IsFloating() {
+		// 		continue
+		// 	}
+
+		// 	// TODO optimise this by only checking the color wave rect that the bounce is in
+		// 	// TODO check center of cell instead of only top left corner (otherwise the expansion will be faster on some cells)
+		// 	// TODO general cleanup/optimisation of code
+		// 	// TODO improve cell finding algorithm
+		// 	// TODO add different colors for different bounces
+		// 	// TODO add lines of color within a color wave
+
+		// 	// TODO image pixel art idea on the color wave expansion
+
+		// 	for i, wave := range colorWaves {
+		// 		// if wave.bounceIdx == bounce.id {
+		// 		// 	// only draw the color wave if it's within the camera view
+		// 		// 	// if !rl.CheckCollisionRecs(wave.rect, cameraRect) {
+		// 		// 	// 	continue
+		// 		// 	// }
+
+		// 		// 	if wave.isExpanding {
+		// 		// 		if len(wave.cells) == len(bounce.reachableCells) {
+		// 		// 			wave.isExpanding = false
+		// 		// 		}
+
+		// 		// 		if !rl.CheckCollisionCircleRec(wave.center, wave.radius, cameraRect) {
+		// 		// 			continue
+		// 		// 		}
+
+		// 		// 		for _, c := range bounce.reachableCells {
+		// 		// 			if rl.CheckCollisionPointCircle(c.pos, wave.center, wave.radius) {
+		// 		// 				wave.AddCell(c)
+		// 		// 			}
+		// 		// 		}
+
+		// 		// 		rl.DrawCircleGradient(int32(wave.center.X), int32(wave.center.Y), wave.radius, rl.Fade(wave.color, 0), rl.Fade(wave.color, 100))
+		// 		// 	}
+
+		// 		// 	cellRects := make([]rl.Rectangle, 0)
+		// 		// 	for _, c := range wave.cells {
+		// 		// 		cellRects = append(cellRects, c.ToRect())
+		// 		// 	}
+
+		// 		// 	for _, c := range wave.cells {
+		// 		// 		rl.DrawRectangleRec(c.ToRect(), wave.color)
+		// 		// 	}
+		// 		// 	// drawGridInsideRects(startX, endX, startY, endY, CELL_SIZE, rl.Maroon, cellRects)
+		// 		// 	// rl.DrawCircleLinesV(wave.center, wave.radius, rl.Black)
+
+		// 		// 	break
+		// 		// }
+
+		// 		if wave.bounceIdx == bounce.id {
+		// 			if !rl.CheckCollisionRecs(wave.rect, cameraRect) {
+		// 				continue
+		// 			}
+
+		// 			// if wave.isExpanding {
+		// 			// 	inflatedRect := rl.NewRectangle(wave.rect.X-CELL_SIZE/2, wave.rect.Y-CELL_SIZE/2, wave.rect.Width+CELL_SIZE, wave.rect.Height+CELL_SIZE)
+		// 			// 	rl.DrawRectangleRec(inflatedRect, rl.Black)
+		// 			// }
+
+		// 			toBeDrawn = append(toBeDrawn, i)
+
+		// 			break
+		// 		}
+		// 	}
+
+		// 	// 	// for _, i := range toBeDrawn {
+		// 	// 	// 	rl.DrawRectangleRec(colorWaves[i].rect, colorWaves[i].color)
+		// 	// 	// }
+
+		// 	// 	// drawGridIncludeExcludeRects(startX, endX, startY, endY, CELL_SIZE, rl.Orange, toBeDrawn, s.generatedMap.safeAreas)
+		// }
+
+		// for _, i := range toBeDrawn {
+		// 	rl.DrawRectangleRec(colorWaves[i].rect, colorWaves[i].color)
+		// }
+
+		// for _, safeArea := range s.generatedMap.safeAreas {
+		// 	rl.DrawRectangleRec(safeArea, rl.NewColor(140, 140, 140, 255))
+		// }
+
+		// for _, i := range toBeDrawn {
+		// 	rl.DrawRectangleLinesEx(colorWaves[i].rect, 1, rl.Black)
+		// }
+
+		// draw grid
+		drawGridOutsideRects(c, startX, endX, startY, endY, s.cfg.CellSize, rl.Black, s.generatedMap.safeAreas)
+
+		merged := make([]rl.Rectangle, 0)
+		for _, bounce := range s.generatedMap.bounces {
+			merged = append(merged, bounce.ToRect(s.cfg))
+		}
 
-			drawGridInsideRects(startX, endX, startY, endY, CELL_SIZE, rl.Black, merged[s.bounceIdx:])
-			drawGridInsideRects(startX, endX, startY, endY, CELL_SIZE, rl.Red, merged[:s.bounceIdx])
+		drawGridInsideRects(c, startX, endX, startY, endY, s.cfg.CellSize, rl.Black, merged[s.bounceIdx:])
+		drawGridInsideRects(c, startX, endX, startY, endY, s.cfg.CellSize, rl.Red, merged[:s.bounceIdx])
 
-			// draw floating bounces
-			// drawGridInsideRects(startX, endX, startY, endY, CELL_SIZE, rl.White, s.generatedMap.floatingBounceRects[s.floatingBounceIdx:])
-			// drawGridInsideRects(startX, endX, startY, endY, CELL_SIZE, rl.Maroon, s.generatedMap.floatingBounceRects[:s.floatingBounceIdx])
+		// draw floating bounces
+		// drawGridInsideRects(startX, endX, startY, endY, CELL_SIZE, rl.White, s.generatedMap.floatingBounceRects[s.floatingBounceIdx:])
+		// drawGridInsideRects(startX, endX, startY, endY, CELL_SIZE, rl.Maroon, s.generatedMap.floatingBounceRects[:s.floatingBounceIdx])
 
-			s.square.Draw()
+		for i := range s.squares {
+			s.squares[i].Draw(c)
 		}
-		rl.EndMode2D()
 	}
-	rl.EndDrawing()
+	c.EndCamera()
 }
 
 func (s *Simulation) Run() {
-	s.startTimeSec = rl.GetTime() + START_DELAY_SEC
+	s.clock = NewClock(-s.cfg.StartDelaySec, s.cfg.AudioOffsetMs)
 
 	for !rl.WindowShouldClose() {
 		s.update()
@@ -259,4 +633,8 @@ func (s *Simulation) Run() {
 	rl.CloseAudioDevice()
 	rl.UnloadMusicStream(s.music)
 	rl.CloseWindow()
+
+	if s.tempWavPath != "" {
+		os.Remove(s.tempWavPath)
+	}
 }
@@ -0,0 +1,463 @@
+package sim
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"math/rand"
+	"slices"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// number of solver steps between progress reports and cancellation checks
+const progressInterval = 4096
+
+type Progress struct {
+	NoteIdx    int // index of the note that is currently being placed
+	DeepestIdx int // deepest note index reached so far
+	NoteCount  int
+	Backtracks int // number of placed bounces that had to be undone
+}
+
+type ProgressFunc func(Progress)
+
+// solverNote is a note of one of the squares, the notes of every square are solved together in time order
+type solverNote struct {
+	squareIdx int
+	timeSec   float64
+}
+
+// solverFrame is the state of a single note on the solver stack
+type solverFrame struct {
+	// square snapped onto the note position, before bouncing, and after the bounce that is currently tried
+	square         Square
+	bounced        Square
+	prevSquareRect rl.Rectangle
+
+	// stack index of the previous note of the same square, -1 for its first note
+	prevFrameIdx int
+
+	bounceDirPriority [2]BounceDirection
+	nextDirIdx        int
+
+	// polygonPaths is truncated back to this length when the frame is popped
+	polygonPathsStart int
+}
+
+// solver searches depth first for a bounce at every note so that no path crosses a bounce rect.
+// It uses an explicit stack so that long songs neither overflow nor copy the bounces at every level.
+type solver struct {
+	cfg   Config
+	rng   *rand.Rand
+	notes []solverNote
+
+	// every square before its first note, the stack index of its latest note (-1 before the first one) and the
+	// index of its last note
+	startSquares  []Square
+	lastFrameIdxs []int
+	lastNoteIdxs  []int
+
+	stack        []solverFrame
+	bounces      []Bounce
+	safeAreas    []rl.Rectangle
+	polygonPaths []Polygon
+
+	// indexes of polygonPaths and of the bounce collision rects, ids are the slice indexes
+	polygonPathIndex *spatialIndex
+	bounceRectIndex  *spatialIndex
+
+	// number of notes left to unwind without trying their other bounce direction
+	backtrackSteps int
+
+	progress Progress
+}
+
+func newSolver(squareTimestamps [][]float64, cfg Config, rng *rand.Rand) *solver {
+	var notes []solverNote
+	for squareIdx, timestamps := range squareTimestamps {
+		for _, timeSec := range timestamps {
+			notes = append(notes, solverNote{squareIdx: squareIdx, timeSec: timeSec})
+		}
+	}
+	// stable, so notes at the same time are solved in the order of their squares
+	slices.SortStableFunc(notes, func(a, b solverNote) int {
+		return cmp.Compare(a.timeSec, b.timeSec)
+	})
+
+	sv := &solver{
+		cfg:   cfg,
+		rng:   rng,
+		notes: notes,
+
+		startSquares:  make([]Square, len(squareTimestamps)),
+		lastFrameIdxs: make([]int, len(squareTimestamps)),
+		lastNoteIdxs:  make([]int, len(squareTimestamps)),
+
+		stack:        make([]solverFrame, 0, len(notes)),
+		bounces:      make([]Bounce, 0, len(notes)),
+		safeAreas:    make([]rl.Rectangle, 0, len(notes)),
+		polygonPaths: make([]Polygon, 0, len(notes)),
+
+		polygonPathIndex: newSpatialIndex(spatialBucketSize(cfg)),
+		bounceRectIndex:  newSpatialIndex(spatialBucketSize(cfg)),
+
+		progress: Progress{NoteCount: len(notes)},
+	}
+
+	for squareIdx := range squareTimestamps {
+		sv.startSquares[squareIdx] = NewSquare(cfg, squareStart(cfg.MapParams, squareIdx), rl.NewVector2(1, 1), float32(cfg.SquareSpeed))
+		sv.lastFrameIdxs[squareIdx] = -1
+	}
+	for noteIdx, note := range notes {
+		sv.lastNoteIdxs[note.squareIdx] = noteIdx
+	}
+
+	return sv
+}
+
+func (sv *solver) solve(ctx context.Context, onProgress ProgressFunc) ([]Bounce, error) {
+	if len(sv.notes) < 1 {
+		return nil, ErrNoPathFound
+	}
+
+	childFailed := !sv.push()
+
+	for steps := 1; ; steps++ {
+		if steps%progressInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			sv.report(onProgress)
+		}
+
+		if len(sv.stack) == 0 {
+			return nil, ErrNoPathFound
+		}
+
+		top := &sv.stack[len(sv.stack)-1]
+		noteIdx := len(sv.stack) - 1
+
+		if childFailed {
+			// remove the bounce + safe area that led to the failed note
+			sv.safeAreas = sv.safeAreas[:len(sv.safeAreas)-1]
+			sv.popBounce()
+			sv.progress.Backtracks++
+
+			if sv.backtrackSteps > 0 {
+				sv.backtrackSteps--
+				sv.pop()
+				continue
+			}
+		}
+
+		// both bounce directions failed
+		if top.nextDirIdx >= len(top.bounceDirPriority) {
+			sv.pop()
+			childFailed = true
+			continue
+		}
+
+		dir := top.bounceDirPriority[top.nextDirIdx]
+		top.nextDirIdx++
+
+		// make square bounce in the direction
+		square := top.square
+		square.InvertDirection(dir)
+		top.bounced = square
+
+		noteTimeSec := sv.notes[noteIdx].timeSec
+
+		bounce := NewBounce(
+			len(sv.bounces),
+			noteTimeSec,
+			square.position,
+			square.direction,
+			dir,
+			square.speed,
+		)
+		bounce.square = sv.notes[noteIdx].squareIdx
+
+		// check collision with final bounce rect
+		if noteIdx == len(sv.notes)-1 {
+			if sv.collidesWithPaths(bounce.ToCollisionRect(sv.cfg)) {
+				sv.pop()
+				childFailed = true
+				continue
+			}
+		}
+
+		// save the bounce + safe area
+		sv.safeAreas = append(sv.safeAreas, mergeRect(top.prevSquareRect, square.ToRectangle()))
+		sv.pushBounce(*bounce)
+
+		if noteIdx == len(sv.notes)-1 {
+			sv.progress.NoteIdx = len(sv.notes)
+			sv.report(onProgress)
+
+			return sv.bounces, nil
+		}
+
+		childFailed = !sv.push()
+	}
+}
+
+// push moves the square of the next note from its previous bounce to the note and puts a frame for it on the stack.
+// It returns false if the path towards the note collides with the map so far, or with another square.
+func (sv *solver) push() bool {
+	noteIdx := len(sv.stack)
+	note := sv.notes[noteIdx]
+
+	square := sv.startSquares[note.squareIdx]
+	prevTimeSec := 0.0
+	prevBounceDirPriority := [2]BounceDirection{VerticalBounce, HorizontalBounce}
+
+	prevFrameIdx := sv.lastFrameIdxs[note.squareIdx]
+	if prevFrameIdx >= 0 {
+		prev := sv.stack[prevFrameIdx]
+		square = prev.bounced
+		prevTimeSec = sv.notes[prevFrameIdx].timeSec
+		prevBounceDirPriority = prev.bounceDirPriority
+	}
+
+	dt := note.timeSec - prevTimeSec
+
+	polygonPathsStart := len(sv.polygonPaths)
+
+	prevSquareRect := square.ToRectangle()
+	prevPos := square.position
+
+	square.Update(float32(dt))
+
+	// snap position
+	snappedPos := snapPosition(square.position, float32(sv.cfg.CellSize), float32(sv.cfg.CellSize))
+	square.position = snappedPos
+
+	polygonPath := createPathPolygon(square.direction, prevPos, snappedPos, sv.cfg.SquareSize)
+	sv.pushPolygonPath(polygonPath)
+
+	collision := false
+
+	// check if any bounces exist, if so, check for collisions
+	if len(sv.bounces) > 0 {
+		// path collision check, the last bounce against every path
+		pathCollision := sv.collidesWithPaths(sv.bounces[len(sv.bounces)-1].ToCollisionRect(sv.cfg))
+
+		// bounce rect collision check, the new path against every bounce near it
+		bounceRectCollision := false
+		sv.bounceRectIndex.Query(polygonBounds(polygonPath), func(id int) bool {
+			bounceRectCollision = rectCornersCollideWithPolygon(polygonPath, sv.bounces[id].ToCollisionRect(sv.cfg))
+			return !bounceRectCollision
+		})
+
+		collision = pathCollision || bounceRectCollision
+	}
+
+	// the paths and bounce rects of the other squares are in the indexes already, the squares themselves are not
+	if !collision && len(sv.startSquares) > 1 {
+		collision = sv.collidesWithSquares(note, prevTimeSec, prevPos, snappedPos)
+	}
+
+	if collision {
+		if noteIdx > sv.cfg.MaxRecursionDepth && sv.rng.Float32() < sv.cfg.BacktrackChance {
+			sv.backtrackSteps = sv.cfg.BacktrackAmount
+		}
+
+		// remove polygon path
+		sv.truncatePolygonPaths(polygonPathsStart)
+
+		return false
+	}
+
+	// NO COLLISIONS FOUND
+
+	bounceDirPriority := prevBounceDirPriority
+
+	// randomly choose whether it is a "horizontal" or "vertical" bounce
+	if sv.rng.Float32() < sv.cfg.ChangeDirChance {
+		bounceDirPriority[0], bounceDirPriority[1] = bounceDirPriority[1], bounceDirPriority[0]
+	}
+
+	sv.stack = append(sv.stack, solverFrame{
+		square:            square,
+		prevSquareRect:    prevSquareRect,
+		prevFrameIdx:      prevFrameIdx,
+		bounceDirPriority: bounceDirPriority,
+		polygonPathsStart: polygonPathsStart,
+	})
+	sv.lastFrameIdxs[note.squareIdx] = noteIdx
+
+	sv.progress.NoteIdx = noteIdx
+	sv.progress.DeepestIdx = max(sv.progress.DeepestIdx, noteIdx)
+
+	return true
+}
+
+// pop removes the top frame together with its path
+func (sv *solver) pop() {
+	top := sv.stack[len(sv.stack)-1]
+
+	sv.truncatePolygonPaths(top.polygonPathsStart)
+	sv.lastFrameIdxs[sv.notes[len(sv.stack)-1].squareIdx] = top.prevFrameIdx
+	sv.stack = sv.stack[:len(sv.stack)-1]
+}
+
+// squareMotion is a square moving in a straight line from position at timeSec, until its next bounce
+type squareMotion struct {
+	timeSec  float64
+	position rl.Vector2
+	velocity rl.Vector2
+}
+
+func (sm squareMotion) at(timeSec float64) rl.Vector2 {
+	return rl.Vector2Add(sm.position, rl.Vector2Scale(sm.velocity, float32(timeSec-sm.timeSec)))
+}
+
+// motionsOf returns how the square moves from fromSec on, one motion per bounce it made since, oldest first.
+// A square stops at its last note.
+func (sv *solver) motionsOf(squareIdx int, fromSec float64) []squareMotion {
+	var motions []squareMotion
+
+	frameIdx := sv.lastFrameIdxs[squareIdx]
+	for {
+		var motion squareMotion
+		if frameIdx < 0 {
+			start := sv.startSquares[squareIdx]
+			motion = squareMotion{position: start.position, velocity: rl.Vector2Scale(start.direction, start.speed)}
+		} else {
+			bounced := sv.stack[frameIdx].bounced
+			motion = squareMotion{timeSec: sv.notes[frameIdx].timeSec, position: bounced.position}
+			if frameIdx != sv.lastNoteIdxs[squareIdx] {
+				motion.velocity = rl.Vector2Scale(bounced.direction, bounced.speed)
+			}
+		}
+
+		motions = append(motions, motion)
+
+		if frameIdx < 0 || motion.timeSec <= fromSec {
+			break
+		}
+		frameIdx = sv.stack[frameIdx].prevFrameIdx
+	}
+
+	slices.Reverse(motions)
+	return motions
+}
+
+// collidesWithSquares checks whether the square of the note, moving from fromPos at fromSec to toPos at the note,
+// runs into another square on the way or ends up further than the max square distance from one
+func (sv *solver) collidesWithSquares(note solverNote, fromSec float64, fromPos, toPos rl.Vector2) bool {
+	motion := squareMotion{timeSec: fromSec, position: fromPos}
+	if note.timeSec > fromSec {
+		motion.velocity = rl.Vector2Scale(rl.Vector2Subtract(toPos, fromPos), float32(1/(note.timeSec-fromSec)))
+	}
+
+	for squareIdx := range sv.startSquares {
+		if squareIdx == note.squareIdx {
+			continue
+		}
+
+		motions := sv.motionsOf(squareIdx, fromSec)
+
+		if rl.Vector2Distance(toPos, motions[len(motions)-1].at(note.timeSec)) > float32(sv.cfg.MaxSquareDistance) {
+			return true
+		}
+
+		for i, other := range motions {
+			startSec, endSec := max(fromSec, other.timeSec), note.timeSec
+			if i+1 < len(motions) {
+				endSec = motions[i+1].timeSec
+			}
+
+			if squaresOverlap(motion, other, startSec, endSec, float64(sv.cfg.SquareSize)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// squaresOverlap checks whether two squares of the given size overlap at any time between startSec and endSec.
+// Squares a pixel apart or closer to touching count as touching, the snapping moves them that much.
+func squaresOverlap(a, b squareMotion, startSec, endSec, size float64) bool {
+	if endSec <= startSec {
+		return false
+	}
+
+	aStart, bStart := a.at(startSec), b.at(startSec)
+	dv := rl.Vector2Subtract(a.velocity, b.velocity)
+
+	// on each axis the squares overlap while the distance between them is below the size, the time they
+	// overlap on both axes at once is where the two intervals meet
+	lo, hi := 0.0, endSec-startSec
+	for _, axis := range [][2]float64{
+		{float64(aStart.X - bStart.X), float64(dv.X)},
+		{float64(aStart.Y - bStart.Y), float64(dv.Y)},
+	} {
+		dist, speed := axis[0], axis[1]
+		reach := size - 1
+
+		if speed == 0 {
+			if math.Abs(dist) >= reach {
+				return false
+			}
+			continue
+		}
+
+		enter, leave := (-reach-dist)/speed, (reach-dist)/speed
+		if enter > leave {
+			enter, leave = leave, enter
+		}
+		lo, hi = max(lo, enter), min(hi, leave)
+	}
+
+	return lo < hi
+}
+
+func (sv *solver) pushPolygonPath(polygonPath Polygon) {
+	sv.polygonPathIndex.Insert(len(sv.polygonPaths), polygonBounds(polygonPath))
+	sv.polygonPaths = append(sv.polygonPaths, polygonPath)
+}
+
+func (sv *solver) truncatePolygonPaths(length int) {
+	for id := len(sv.polygonPaths) - 1; id >= length; id-- {
+		sv.polygonPathIndex.Remove(id)
+	}
+	sv.polygonPaths = sv.polygonPaths[:length]
+}
+
+func (sv *solver) pushBounce(bounce Bounce) {
+	sv.bounceRectIndex.Insert(len(sv.bounces), bounce.ToCollisionRect(sv.cfg))
+	sv.bounces = append(sv.bounces, bounce)
+}
+
+func (sv *solver) popBounce() {
+	sv.bounceRectIndex.Remove(len(sv.bounces) - 1)
+	sv.bounces = sv.bounces[:len(sv.bounces)-1]
+}
+
+// collidesWithPaths checks the rect against the paths near it
+func (sv *solver) collidesWithPaths(rect rl.Rectangle) bool {
+	collision := false
+
+	sv.polygonPathIndex.Query(rect, func(id int) bool {
+		collision = rectCornersCollideWithPolygon(sv.polygonPaths[id], rect)
+		return !collision
+	})
+
+	return collision
+}
+
+// spatialBucketSize returns the bucket size of the solver indexes, a few squares wide so
+// short paths and bounce rects only land in a handful of buckets
+func spatialBucketSize(cfg Config) float32 {
+	return float32(cfg.SquareSize * 4)
+}
+
+func (sv *solver) report(onProgress ProgressFunc) {
+	if onProgress != nil {
+		onProgress(sv.progress)
+	}
+}
@@ -0,0 +1,191 @@
+package sim
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// solveWith runs the solver, with indexes of a single bucket if linear is set. A single bucket holds every item in
+// insertion order, so every query scans all paths or bounce rects like the generator did before it had an index.
+func solveWith(t testing.TB, timestamps [][]float64, cfg Config, linear bool) ([]Bounce, []Polygon) {
+	t.Helper()
+
+	sv := newSolver(timestamps, cfg, rand.New(rand.NewSource(cfg.Seed)))
+	if linear {
+		sv.polygonPathIndex = newSpatialIndex(math.MaxFloat32)
+		sv.bounceRectIndex = newSpatialIndex(math.MaxFloat32)
+	}
+
+	bounces, err := sv.solve(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bounces, sv.polygonPaths
+}
+
+func TestSolverMatchesLinearScan(t *testing.T) {
+	for _, seed := range []int64{1, 2, 42} {
+		timestamps := [][]float64{testTimestamps(500, seed)}
+		cfg := testConfig(seed)
+
+		indexed, indexedPaths := solveWith(t, timestamps, cfg, false)
+		linear, linearPaths := solveWith(t, timestamps, cfg, true)
+
+		if len(indexed) != len(linear) || len(indexedPaths) != len(linearPaths) {
+			t.Fatalf("seed %d: %d bounces and %d paths, linear scan %d and %d",
+				seed, len(indexed), len(indexedPaths), len(linear), len(linearPaths))
+		}
+		for i := range indexed {
+			a, b := indexed[i], linear[i]
+			if a.position != b.position || a.nextDirection != b.nextDirection || a.bounceDirection != b.bounceDirection {
+				t.Fatalf("seed %d: bounce %d is %+v, linear scan %+v", seed, i, a, b)
+			}
+		}
+	}
+}
+
+// a solved map has no path crossing a bounce rect, checked against every pair
+func TestSolverPathsAvoidBounceRects(t *testing.T) {
+	cfg := testConfig(7)
+	bounces, paths := solveWith(t, [][]float64{testTimestamps(300, 7)}, cfg, false)
+
+	for i, path := range paths {
+		for j, bounce := range bounces {
+			if rectCornersCollideWithPolygon(path, bounce.ToCollisionRect(cfg)) {
+				t.Fatalf("path %d crosses bounce rect %d", i, j)
+			}
+		}
+	}
+}
+
+func TestSquaresOverlap(t *testing.T) {
+	still := func(x, y float32) squareMotion {
+		return squareMotion{position: rl.NewVector2(x, y)}
+	}
+	moving := func(x, y, vx, vy float32) squareMotion {
+		return squareMotion{position: rl.NewVector2(x, y), velocity: rl.NewVector2(vx, vy)}
+	}
+
+	tests := []struct {
+		name             string
+		a, b             squareMotion
+		startSec, endSec float64
+		want             bool
+	}{
+		{"still and overlapping", still(0, 0), still(30, 20), 0, 1, true},
+		{"still and touching", still(0, 0), still(50, 0), 0, 1, false},
+		{"a pixel apart counts as touching", still(0, 0), still(49.5, 0), 0, 1, false},
+		{"side by side in parallel", moving(0, 0, 400, 400), moving(50, 0, 400, 400), 0, 10, false},
+		// 200 pixels apart closing in at 200 pixels per second, they are 49 pixels apart after 0.755s
+		{"head on", moving(0, 0, 100, 0), moving(200, 0, -100, 0), 0, 0.8, true},
+		{"head on, stopped before they meet", moving(0, 0, 100, 0), moving(200, 0, -100, 0), 0, 0.7, false},
+		{"head on, started after they passed", moving(0, 0, 100, 0), moving(200, 0, -100, 0), 1.3, 2, false},
+		// both pass the origin, a after a second and b after three
+		{"crossing paths at different times", moving(-100, 0, 100, 0), moving(0, -300, 0, 100), 0, 4, false},
+		{"crossing paths at the same time", moving(-100, 0, 100, 0), moving(0, -100, 0, 100), 0, 4, true},
+		{"empty interval", still(0, 0), still(0, 0), 1, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := squaresOverlap(tt.a, tt.b, tt.startSec, tt.endSec, 50); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if got := squaresOverlap(tt.b, tt.a, tt.startSec, tt.endSec, 50); got != tt.want {
+				t.Errorf("swapped: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollidesWithSquares(t *testing.T) {
+	// square 1 starts at 100,-100 and is at 500,300 a second later, both notes are still to be placed
+	tests := []struct {
+		name              string
+		toPos             rl.Vector2
+		maxSquareDistance int
+		want              bool
+	}{
+		{"alongside the other square", rl.NewVector2(400, 400), 1000, false},
+		{"onto the other square", rl.NewVector2(500, 300), 1000, true},
+		{"too far from the other square", rl.NewVector2(-400, 1200), 1000, true},
+		{"far but allowed", rl.NewVector2(-400, 1200), 2000, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(1)
+			cfg.MaxSquareDistance = tt.maxSquareDistance
+
+			sv := newSolver([][]float64{{1}, {1}}, cfg, rand.New(rand.NewSource(1)))
+			note := solverNote{squareIdx: 0, timeSec: 1}
+
+			if got := sv.collidesWithSquares(note, 0, rl.NewVector2(0, 0), tt.toPos); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// the other square is followed along the direction of its latest bounce, and stops at its last one
+func TestCollidesWithSquaresAfterBounces(t *testing.T) {
+	cfg := testConfig(1)
+	cfg.MaxSquareDistance = 10_000
+
+	sv := newSolver([][]float64{{0.5, 1.5}, {0.5, 1.5}}, cfg, rand.New(rand.NewSource(1)))
+	if _, err := sv.solve(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the notes are in time order, square 1 has the second and the last one
+	bounced := sv.stack[1].bounced
+	last := sv.stack[3].bounced.position
+	at := func(timeSec float64) rl.Vector2 {
+		return rl.Vector2Add(bounced.position, rl.Vector2Scale(bounced.direction, bounced.speed*float32(timeSec-0.5)))
+	}
+	unbounced := rl.Vector2Add(squareStart(cfg.MapParams, 1), rl.NewVector2(1.25*400, 1.25*400))
+
+	tests := []struct {
+		name    string
+		pos     rl.Vector2
+		timeSec float64
+		want    bool
+	}{
+		{"where it went after its bounce", at(1.25), 1.25, true},
+		{"where it would be without the bounce", unbounced, 1.25, false},
+		{"where it stopped", last, 2, true},
+		{"where it would be without stopping", at(2), 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// square 0 waits at the position for a tenth of a second until its note
+			note := solverNote{squareIdx: 0, timeSec: tt.timeSec}
+			if got := sv.collidesWithSquares(note, tt.timeSec-0.1, tt.pos, tt.pos); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// compares the index against the linear scan it replaced, GenerateMap adds the post-processing on top
+func BenchmarkSolve(b *testing.B) {
+	timestamps := [][]float64{testTimestamps(2000, 1)}
+	cfg := testConfig(42)
+
+	for _, bm := range []struct {
+		name   string
+		linear bool
+	}{{"index", false}, {"linear scan", true}} {
+		b.Run(bm.name, func(b *testing.B) {
+			for range b.N {
+				solveWith(b, timestamps, cfg, bm.linear)
+			}
+		})
+	}
+}
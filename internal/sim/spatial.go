@@ -0,0 +1,144 @@
+package sim
+
+import (
+	"math"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+type spatialItem struct {
+	rect    rl.Rectangle
+	present bool
+
+	// query stamp, used to report an item only once when it spans multiple buckets
+	stamp uint32
+}
+
+// spatialIndex is a uniform grid of buckets over the bounding rects of items with dense integer ids.
+// A region query only has to look at the items in the buckets the region overlaps.
+type spatialIndex struct {
+	bucketSize float32
+	buckets    map[[2]int][]int
+	items      []spatialItem
+
+	queryStamp uint32
+}
+
+func newSpatialIndex(bucketSize float32) *spatialIndex {
+	return &spatialIndex{
+		bucketSize: bucketSize,
+		buckets:    make(map[[2]int][]int),
+	}
+}
+
+// bucketRange returns the inclusive range of buckets a rect overlaps, rects touching a bucket edge are in both buckets
+func (si *spatialIndex) bucketRange(rect rl.Rectangle) (minBx, maxBx, minBy, maxBy int) {
+	minBx = int(math.Floor(float64(rect.X / si.bucketSize)))
+	maxBx = int(math.Floor(float64((rect.X + rect.Width) / si.bucketSize)))
+	minBy = int(math.Floor(float64(rect.Y / si.bucketSize)))
+	maxBy = int(math.Floor(float64((rect.Y + rect.Height) / si.bucketSize)))
+
+	return minBx, maxBx, minBy, maxBy
+}
+
+func (si *spatialIndex) Insert(id int, rect rl.Rectangle) {
+	for id >= len(si.items) {
+		si.items = append(si.items, spatialItem{})
+	}
+	si.items[id] = spatialItem{rect: rect, present: true}
+
+	minBx, maxBx, minBy, maxBy := si.bucketRange(rect)
+	for bx := minBx; bx <= maxBx; bx++ {
+		for by := minBy; by <= maxBy; by++ {
+			key := [2]int{bx, by}
+			si.buckets[key] = append(si.buckets[key], id)
+		}
+	}
+}
+
+// Remove takes the item out of its buckets, removing the most recently inserted items first is the cheapest
+func (si *spatialIndex) Remove(id int) {
+	if id >= len(si.items) || !si.items[id].present {
+		return
+	}
+	item := &si.items[id]
+	item.present = false
+
+	minBx, maxBx, minBy, maxBy := si.bucketRange(item.rect)
+	for bx := minBx; bx <= maxBx; bx++ {
+		for by := minBy; by <= maxBy; by++ {
+			key := [2]int{bx, by}
+			bucket := si.buckets[key]
+
+			for i := len(bucket) - 1; i >= 0; i-- {
+				if bucket[i] == id {
+					bucket = append(bucket[:i], bucket[i+1:]...)
+					break
+				}
+			}
+
+			if len(bucket) == 0 {
+				delete(si.buckets, key)
+			} else {
+				si.buckets[key] = bucket
+			}
+		}
+	}
+}
+
+// Query calls fn once for every item whose bounding rect overlaps or touches rect, until fn returns false
+func (si *spatialIndex) Query(rect rl.Rectangle, fn func(id int) bool) {
+	si.queryStamp++
+	if si.queryStamp == 0 {
+		// wrapped around, old stamps could match again
+		for i := range si.items {
+			si.items[i].stamp = 0
+		}
+		si.queryStamp = 1
+	}
+
+	minBx, maxBx, minBy, maxBy := si.bucketRange(rect)
+	for bx := minBx; bx <= maxBx; bx++ {
+		for by := minBy; by <= maxBy; by++ {
+			for _, id := range si.buckets[[2]int{bx, by}] {
+				item := &si.items[id]
+				if item.stamp == si.queryStamp {
+					continue
+				}
+				item.stamp = si.queryStamp
+
+				if !rectsTouch(item.rect, rect) {
+					continue
+				}
+
+				if !fn(id) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// rectsTouch is like rl.CheckCollisionRecs but also true for rects that only share an edge
+func rectsTouch(a, b rl.Rectangle) bool {
+	return a.X <= b.X+b.Width && a.X+a.Width >= b.X &&
+		a.Y <= b.Y+b.Height && a.Y+a.Height >= b.Y
+}
+
+func polygonBounds(polygon Polygon) rl.Rectangle {
+	if len(polygon) == 0 {
+		return rl.Rectangle{}
+	}
+
+	minX, minY := polygon[0].X, polygon[0].Y
+	maxX, maxY := minX, minY
+
+	for _, p := range polygon[1:] {
+		minX = min(minX, p.X)
+		minY = min(minY, p.Y)
+		maxX = max(maxX, p.X)
+		maxY = max(maxY, p.Y)
+	}
+
+	return rl.NewRectangle(minX, minY, maxX-minX, maxY-minY)
+}
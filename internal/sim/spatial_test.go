@@ -0,0 +1,140 @@
+package sim
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// queryIDs returns the sorted ids Query reports for rect
+func queryIDs(si *spatialIndex, rect rl.Rectangle) []int {
+	var ids []int
+	si.Query(rect, func(id int) bool {
+		ids = append(ids, id)
+		return true
+	})
+	slices.Sort(ids)
+
+	return ids
+}
+
+func TestSpatialIndexQuery(t *testing.T) {
+	si := newSpatialIndex(100)
+	si.Insert(0, rl.NewRectangle(10, 10, 20, 20))
+	si.Insert(1, rl.NewRectangle(50, 50, 200, 200)) // spans 9 buckets
+	si.Insert(2, rl.NewRectangle(-150, -150, 20, 20))
+	si.Insert(3, rl.NewRectangle(30, 0, 10, 10)) // shares an edge with 0
+
+	tests := []struct {
+		name string
+		rect rl.Rectangle
+		want []int
+	}{
+		{"inside one rect", rl.NewRectangle(15, 15, 1, 1), []int{0}},
+		{"item spanning buckets is reported once", rl.NewRectangle(0, 0, 300, 300), []int{0, 1, 3}},
+		{"negative coordinates", rl.NewRectangle(-140, -140, 5, 5), []int{2}},
+		{"touching edges count", rl.NewRectangle(30, 30, 20, 20), []int{0, 1}},
+		{"empty region", rl.NewRectangle(500, -500, 10, 10), nil},
+		{"same bucket but apart", rl.NewRectangle(80, 0, 5, 5), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryIDs(si, tt.rect); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpatialIndexQueryStops(t *testing.T) {
+	si := newSpatialIndex(100)
+	for id := range 10 {
+		si.Insert(id, rl.NewRectangle(float32(id), 0, 10, 10))
+	}
+
+	calls := 0
+	si.Query(rl.NewRectangle(0, 0, 20, 20), func(id int) bool {
+		calls++
+		return false
+	})
+
+	if calls != 1 {
+		t.Errorf("fn called %d times after returning false, want 1", calls)
+	}
+}
+
+// the solver removes the most recently inserted ids when it backtracks and inserts the same ids again
+func TestSpatialIndexRemoveOnBacktrack(t *testing.T) {
+	si := newSpatialIndex(50)
+	everything := rl.NewRectangle(-1000, -1000, 2000, 2000)
+
+	for id := range 5 {
+		si.Insert(id, rl.NewRectangle(float32(id*40), 0, 60, 60))
+	}
+
+	si.Remove(4)
+	si.Remove(3)
+	if got := queryIDs(si, everything); !slices.Equal(got, []int{0, 1, 2}) {
+		t.Fatalf("after removing 4 and 3 got %v", got)
+	}
+
+	// removing twice or an id that was never inserted does nothing
+	si.Remove(3)
+	si.Remove(99)
+
+	si.Insert(3, rl.NewRectangle(-500, -500, 10, 10))
+	if got := queryIDs(si, rl.NewRectangle(95, 0, 30, 10)); !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("old rect of 3 still reported: %v", got)
+	}
+	if got := queryIDs(si, rl.NewRectangle(-495, -495, 1, 1)); !slices.Equal(got, []int{3}) {
+		t.Errorf("new rect of 3 not reported: %v", got)
+	}
+
+	for id := 3; id >= 0; id-- {
+		si.Remove(id)
+	}
+	if got := queryIDs(si, everything); got != nil {
+		t.Errorf("got %v from an empty index", got)
+	}
+	if len(si.buckets) != 0 {
+		t.Errorf("%d empty buckets left", len(si.buckets))
+	}
+}
+
+// random inserts and removes, every query has to match a scan over all items
+func TestSpatialIndexMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	si := newSpatialIndex(40)
+
+	var rects []rl.Rectangle
+	randomRect := func() rl.Rectangle {
+		return rl.NewRectangle(rng.Float32()*1000-500, rng.Float32()*1000-500, rng.Float32()*150, rng.Float32()*150)
+	}
+
+	for range 2000 {
+		if len(rects) > 0 && rng.Float32() < 0.3 {
+			si.Remove(len(rects) - 1)
+			rects = rects[:len(rects)-1]
+		} else {
+			rect := randomRect()
+			si.Insert(len(rects), rect)
+			rects = append(rects, rect)
+		}
+
+		query := randomRect()
+
+		var want []int
+		for id, rect := range rects {
+			if rectsTouch(rect, query) {
+				want = append(want, id)
+			}
+		}
+
+		if got := queryIDs(si, query); !slices.Equal(got, want) {
+			t.Fatalf("query %v: got %v, want %v", query, got, want)
+		}
+	}
+}
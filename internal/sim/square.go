@@ -4,10 +4,14 @@ import (
 	"math"
 	"math/rand"
 
+	"ray_midi_sim/internal/canvas"
+
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
 type Square struct {
+	cfg Config
+
 	position  rl.Vector2
 	direction rl.Vector2
 	speed     float32
@@ -33,16 +37,15 @@ func (s *Square) InvertDirection(bounceDirection BounceDirection) {
 	}
 }
 
-func (s *Square) Bounce(bounce Bounce, bounceIdx int) {
+func (s *Square) Bounce(bounce Bounce, bounceIdx int, rng *rand.Rand) {
 	prevDirection := s.direction
 
 	s.position = bounce.position
 	s.direction = bounce.nextDirection
 	s.speed = bounce.nextSpeed
 
-	// Increase this duration to slow down the bounce animation
 	s.bounceAnimTimer = 0
-	s.bounceAnimDuration = 0.5
+	s.bounceAnimDuration = bounceAnimDurationSec
 
 	// Record the bounce direction to determine squash & stretch orientation
 	s.bounceDirection = bounce.bounceDirection
@@ -86,14 +89,25 @@ func (s *Square) Bounce(bounce Bounce, bounceIdx int) {
 		ALL_COLORS := []rl.Color{
 			rl.Pink,
 		}
-		color := ALL_COLORS[rand.Intn(len(ALL_COLORS))]
+		color := ALL_COLORS[rng.Intn(len(ALL_COLORS))]
 
-		cw := NewColorWave(s.position, CELL_SIZE, 700, rl.GetTime(), bounceIdx, expandDirection, color, 200)
+		cw := NewColorWave(s.position, float32(s.cfg.CellSize), 700, rl.GetTime(), bounceIdx, expandDirection, color, 200)
 
 		colorWaves = append(colorWaves, &cw)
 	}
 }
 
+// SetState puts the square where the state says, including the progress of the bounce animation
+func (s *Square) SetState(state SquareState) {
+	s.position = state.Position
+	s.direction = state.Direction
+	s.speed = state.Speed
+
+	s.bounceDirection = state.BounceDirection
+	s.bounceAnimTimer = state.BounceAnimSec
+	s.bounceAnimDuration = bounceAnimDurationSec
+}
+
 func (s *Square) Update(dt float32) {
 	// Regular movement
 	s.position.X += s.direction.X * s.speed * dt
@@ -108,7 +122,7 @@ func (s *Square) Update(dt float32) {
 	}
 }
 
-func (s *Square) Draw() {
+func (s *Square) Draw(c canvas.Canvas) {
 	// Default scales
 	scaleX := float32(1.0)
 	scaleY := float32(1.0)
@@ -139,14 +153,17 @@ func (s *Square) Draw() {
 		}
 	}
 
+	squareSize := float32(s.cfg.SquareSize)
+	halfSquareSize := float32(s.cfg.SquareSize / 2)
+
 	// Calculate how large the rectangle is after scaling
-	scaledWidth := SQUARE_SIZE * scaleX
-	scaledHeight := SQUARE_SIZE * scaleY
+	scaledWidth := squareSize * scaleX
+	scaledHeight := squareSize * scaleY
 
 	// Offset so the scaled rectangle is still centered at s.position
 	drawPos := rl.NewVector2(
-		s.position.X+(SQUARE_SIZE/2-scaledWidth/2),
-		s.position.Y+(SQUARE_SIZE/2-scaledHeight/2),
+		s.position.X+(halfSquareSize-scaledWidth/2),
+		s.position.Y+(halfSquareSize-scaledHeight/2),
 	)
 
 	sizeVector := rl.NewVector2(scaledWidth, scaledHeight)
@@ -154,22 +171,27 @@ func (s *Square) Draw() {
 	outlineThickness := float32(3.0)
 
 	// Draw the square's outline
-	rl.DrawRectangleV(drawPos, rl.NewVector2(scaledWidth, scaledHeight), rl.White)
+	c.DrawRectangle(canvas.Rect{X: drawPos.X, Y: drawPos.Y, Width: scaledWidth, Height: scaledHeight}, rl.White)
 
 	// Draw the square
-	rl.DrawRectangleV(
-		rl.NewVector2(drawPos.X+outlineThickness, drawPos.Y+outlineThickness),
-		rl.NewVector2(sizeVector.X-outlineThickness*2, sizeVector.Y-outlineThickness*2),
+	c.DrawRectangle(
+		canvas.Rect{
+			X:      drawPos.X + outlineThickness,
+			Y:      drawPos.Y + outlineThickness,
+			Width:  sizeVector.X - outlineThickness*2,
+			Height: sizeVector.Y - outlineThickness*2,
+		},
 		rl.Red,
 	)
 }
 
 func (s Square) ToRectangle() rl.Rectangle {
-	return rl.NewRectangle(s.position.X, s.position.Y, SQUARE_SIZE, SQUARE_SIZE)
+	return rl.NewRectangle(s.position.X, s.position.Y, float32(s.cfg.SquareSize), float32(s.cfg.SquareSize))
 }
 
-func NewSquare(position rl.Vector2, direction rl.Vector2, speed float32) Square {
+func NewSquare(cfg Config, position rl.Vector2, direction rl.Vector2, speed float32) Square {
 	return Square{
+		cfg:       cfg,
 		position:  position,
 		direction: direction,
 		speed:     speed,
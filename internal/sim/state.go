@@ -0,0 +1,91 @@
+package sim
+
+import (
+	"sort"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// length of the squash and stretch animation after a bounce, increase it to slow down the animation
+const bounceAnimDurationSec = 0.5
+
+// MapState is where every square is at a point in time, computed from the bounces alone
+type MapState struct {
+	Squares []SquareState
+
+	// number of bounces of all squares up to and including the time, split by their classification as well
+	BounceIdx          int
+	FloatingBounceIdx  int
+	ConnectedBounceIdx int
+}
+
+// SquareState is where a square is at a point in time
+type SquareState struct {
+	Position  rl.Vector2
+	Direction rl.Vector2
+	Speed     float32
+	Moving    bool // false before the start and after the last bounce
+
+	// direction of the latest bounce and the time since it, drives the squash and stretch animation
+	BounceDirection BounceDirection
+	BounceAnimSec   float32
+}
+
+// StateAt returns the state of every square at timeSec. The squares start where they do in the generator, moving down
+// right at the square speed, and each stops at its last bounce.
+func (m Map) StateAt(timeSec float64) MapState {
+	bounceIdx := sort.Search(len(m.bounces), func(i int) bool {
+		return m.bounces[i].timeSec > timeSec
+	})
+
+	state := MapState{BounceIdx: bounceIdx}
+
+	if bounceIdx < len(m.floatingBounceCounts) {
+		state.FloatingBounceIdx = m.floatingBounceCounts[bounceIdx]
+		state.ConnectedBounceIdx = bounceIdx - state.FloatingBounceIdx
+	}
+
+	for squareIdx := range m.squareBounceIdxs {
+		state.Squares = append(state.Squares, m.squareStateAt(squareIdx, timeSec))
+	}
+
+	return state
+}
+
+func (m Map) squareStateAt(squareIdx int, timeSec float64) SquareState {
+	bounceIdxs := m.squareBounceIdxs[squareIdx]
+	bounceIdx := sort.Search(len(bounceIdxs), func(i int) bool {
+		return m.bounces[bounceIdxs[i]].timeSec > timeSec
+	})
+
+	state := SquareState{
+		Position:      squareStart(m.params, squareIdx),
+		Direction:     rl.NewVector2(1, 1),
+		Speed:         float32(m.params.SquareSpeed),
+		BounceAnimSec: bounceAnimDurationSec,
+	}
+
+	if bounceIdx == 0 {
+		if timeSec > 0 {
+			state.Moving = true
+			state.Position = rl.Vector2Add(state.Position, rl.Vector2Scale(state.Direction, state.Speed*float32(timeSec)))
+		}
+		return state
+	}
+
+	bounce := m.bounces[bounceIdxs[bounceIdx-1]]
+	sinceBounceSec := float32(timeSec - bounce.timeSec)
+
+	state.Direction = bounce.nextDirection
+	state.Speed = bounce.nextSpeed
+	state.Position = bounce.position
+	state.BounceDirection = bounce.bounceDirection
+	state.BounceAnimSec = min(sinceBounceSec, bounceAnimDurationSec)
+
+	if bounceIdx < len(bounceIdxs) {
+		state.Moving = true
+		state.Position = rl.Vector2Add(bounce.position, rl.Vector2Scale(bounce.nextDirection, bounce.nextSpeed*sinceBounceSec))
+	}
+
+	return state
+}
@@ -0,0 +1,97 @@
+package sim
+
+import (
+	"reflect"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// twoSquareMap has two squares bouncing twice each at hand picked times, square 1 starting at squareStart
+func twoSquareMap() Map {
+	m := Map{
+		params: MapParams{SquareSize: 50, SquareSpeed: 400},
+		bounces: []Bounce{
+			{square: 1, timeSec: 0.5, position: rl.NewVector2(300, 100), nextDirection: rl.NewVector2(-1, 1), bounceDirection: HorizontalBounce, nextSpeed: 400},
+			{square: 0, timeSec: 1, position: rl.NewVector2(400, 400), nextDirection: rl.NewVector2(1, -1), bounceDirection: VerticalBounce, nextSpeed: 200},
+			{square: 1, timeSec: 1.5, position: rl.NewVector2(-100, 500), nextDirection: rl.NewVector2(-1, -1), bounceDirection: VerticalBounce, nextSpeed: 400},
+			{square: 0, timeSec: 2, position: rl.NewVector2(600, 200), nextDirection: rl.NewVector2(-1, -1), bounceDirection: HorizontalBounce, nextSpeed: 400},
+		},
+	}
+	m.indexSquares()
+
+	return m
+}
+
+func TestStateAt(t *testing.T) {
+	m := twoSquareMap()
+
+	tests := []struct {
+		name      string
+		timeSec   float64
+		bounceIdx int
+		want      []SquareState
+	}{
+		{
+			name:    "before the start",
+			timeSec: -1,
+			want: []SquareState{
+				{Position: rl.NewVector2(0, 0), Direction: rl.NewVector2(1, 1), Speed: 400, BounceAnimSec: bounceAnimDurationSec},
+				{Position: rl.NewVector2(100, -100), Direction: rl.NewVector2(1, 1), Speed: 400, BounceAnimSec: bounceAnimDurationSec},
+			},
+		},
+		{
+			name:    "both on their way from the start",
+			timeSec: 0.25,
+			want: []SquareState{
+				{Position: rl.NewVector2(100, 100), Direction: rl.NewVector2(1, 1), Speed: 400, Moving: true, BounceAnimSec: bounceAnimDurationSec},
+				{Position: rl.NewVector2(200, 0), Direction: rl.NewVector2(1, 1), Speed: 400, Moving: true, BounceAnimSec: bounceAnimDurationSec},
+			},
+		},
+		{
+			name:      "one has bounced",
+			timeSec:   0.75,
+			bounceIdx: 1,
+			want: []SquareState{
+				{Position: rl.NewVector2(300, 300), Direction: rl.NewVector2(1, 1), Speed: 400, Moving: true, BounceAnimSec: bounceAnimDurationSec},
+				{Position: rl.NewVector2(200, 200), Direction: rl.NewVector2(-1, 1), Speed: 400, Moving: true, BounceDirection: HorizontalBounce, BounceAnimSec: 0.25},
+			},
+		},
+		{
+			name:      "one stopped at its last bounce",
+			timeSec:   1.5,
+			bounceIdx: 3,
+			want: []SquareState{
+				{Position: rl.NewVector2(500, 300), Direction: rl.NewVector2(1, -1), Speed: 200, Moving: true, BounceDirection: VerticalBounce, BounceAnimSec: 0.5},
+				{Position: rl.NewVector2(-100, 500), Direction: rl.NewVector2(-1, -1), Speed: 400, BounceDirection: VerticalBounce},
+			},
+		},
+		{
+			name:      "after the end",
+			timeSec:   3,
+			bounceIdx: 4,
+			want: []SquareState{
+				{Position: rl.NewVector2(600, 200), Direction: rl.NewVector2(-1, -1), Speed: 400, BounceDirection: HorizontalBounce, BounceAnimSec: bounceAnimDurationSec},
+				{Position: rl.NewVector2(-100, 500), Direction: rl.NewVector2(-1, -1), Speed: 400, BounceDirection: VerticalBounce, BounceAnimSec: bounceAnimDurationSec},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := m.StateAt(tt.timeSec)
+			if len(state.Squares) != len(tt.want) {
+				t.Fatalf("got %d squares, want %d", len(state.Squares), len(tt.want))
+			}
+
+			if state.BounceIdx != tt.bounceIdx {
+				t.Errorf("got bounce index %d, want %d", state.BounceIdx, tt.bounceIdx)
+			}
+			for squareIdx, want := range tt.want {
+				if got := state.Squares[squareIdx]; !reflect.DeepEqual(got, want) {
+					t.Errorf("square %d:\ngot  %+v\nwant %+v", squareIdx, got, want)
+				}
+			}
+		})
+	}
+}
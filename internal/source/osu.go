@@ -0,0 +1,80 @@
+package source
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidOsu = errors.New("invalid osu! beatmap")
+
+// Osu reads the start times of the hit objects of an osu! beatmap, they are relative to the start of its audio file
+type Osu struct {
+	file
+}
+
+func NewOsu(path string) Osu {
+	return Osu{file: file{path}}
+}
+
+func (s Osu) Timestamps() ([]float64, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		timestamps    []float64
+		section       string
+		hasHitObjects bool
+	)
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			section = text[1 : len(text)-1]
+			hasHitObjects = hasHitObjects || section == "HitObjects"
+			continue
+		}
+
+		if section != "HitObjects" {
+			continue
+		}
+
+		// x,y,time,type,hitSound,objectParams,hitSample with the time in milliseconds
+		fields := strings.Split(text, ",")
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("%s: line %d: %w: hit object with %d fields", s.path, line, ErrInvalidOsu, len(fields))
+		}
+
+		timeMs, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w: hit object time %q", s.path, line, ErrInvalidOsu, fields[2])
+		}
+
+		timestamps = append(timestamps, timeMs/1000)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	if !hasHitObjects {
+		return nil, fmt.Errorf("%s: %w: no [HitObjects] section", s.path, ErrInvalidOsu)
+	}
+
+	timestamps, err = normalize(timestamps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	return timestamps, nil
+}
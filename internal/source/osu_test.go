@@ -0,0 +1,27 @@
+package source
+
+import "testing"
+
+func TestOsu(t *testing.T) {
+	const header = "osu file format v14\n\n[General]\nAudioFilename: audio.mp3\n\n[TimingPoints]\n0,500,4,2,0,100,1,0\n\n"
+
+	tests := []parserTest{
+		{
+			name:    "hit objects",
+			content: header + "[HitObjects]\n256,192,1500,1,0,0:0:0:0:\n100,100,500,5,0,0:0:0:0:\n// a comment\n300,50,2250,2,0,B|400:50,1,100\n",
+			want:    []float64{0.5, 1.5, 2.25},
+		},
+		{
+			name:    "sections after the hit objects are skipped",
+			content: header + "[HitObjects]\n0,0,1000,1,0\n[Extra]\nnot,a,hit,object,at,all\n",
+			want:    []float64{1},
+		},
+		{name: "empty hit objects", content: header + "[HitObjects]\n"},
+		{name: "no hit objects section", content: header, wantErr: ErrInvalidOsu},
+		{name: "too few fields", content: header + "[HitObjects]\n256,192,1500\n", wantErr: ErrInvalidOsu},
+		{name: "malformed time", content: header + "[HitObjects]\n256,192,soon,1,0\n", wantErr: ErrInvalidOsu},
+		{name: "negative time", content: header + "[HitObjects]\n256,192,-20,1,0\n", wantErr: ErrInvalidTimestamp},
+	}
+
+	runParserTests(t, "map.osu", tests, func(path string) TimestampSource { return NewOsu(path) })
+}
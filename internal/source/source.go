@@ -0,0 +1,245 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"ray_midi_sim/internal/audio"
+	"ray_midi_sim/internal/midi"
+)
+
+var (
+	ErrUnknownFormat    = errors.New("unknown timestamp format")
+	ErrInvalidTimestamp = errors.New("invalid timestamp")
+	ErrInvalidColumn    = errors.New("invalid CSV column")
+)
+
+// TimestampSource provides the onsets in seconds a map is generated from
+type TimestampSource interface {
+	// Timestamps returns the onsets sorted, without duplicates
+	Timestamps() ([]float64, error)
+
+	// Hash identifies the data the timestamps come from, it is stored along with the map
+	Hash() (string, error)
+}
+
+// Formats are the names Open accepts, the file extension picks one if none is given
+var Formats = []string{"midi", "wav", "csv", "text", "osu"}
+
+// Options configure the sources that need more than a path
+type Options struct {
+	Selector          midi.Selector     // notes of a MIDI file
+	Pipeline          midi.Pipeline     // transforms applied to a MIDI file before its notes are taken
+	OnsetToleranceSec float64           // notes of a MIDI file starting within this are one onset
+	Onset             audio.OnsetParams // onset detection in a WAV file
+	CSVColumn         int               // zero based column of a CSV file holding the timestamps
+}
+
+// Open returns the source for the file at path, format is one of Formats or empty to pick it by the extension
+func Open(path, format string, opts Options) (TimestampSource, error) {
+	if format == "" {
+		format = formatOf(path)
+	}
+
+	switch format {
+	case "midi":
+		src := NewMIDI(path, opts.Selector, opts.OnsetToleranceSec)
+		src.SetPipeline(opts.Pipeline)
+		return src, nil
+	case "wav":
+		return NewWAVOnsets(path, opts.Onset), nil
+	case "csv":
+		if opts.CSVColumn < 0 {
+			return nil, fmt.Errorf("%w %d, columns count from 0", ErrInvalidColumn, opts.CSVColumn)
+		}
+		return NewCSV(path, opts.CSVColumn), nil
+	case "text":
+		return NewText(path), nil
+	case "osu":
+		return NewOsu(path), nil
+	default:
+		return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownFormat, format, strings.Join(Formats, ", "))
+	}
+}
+
+func formatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mid", ".midi", ".smf":
+		return "midi"
+	case ".wav", ".wave":
+		return "wav"
+	case ".csv":
+		return "csv"
+	case ".txt":
+		return "text"
+	case ".osu":
+		return "osu"
+	default:
+		return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+}
+
+// file holds the path of a file based source, the hash is the one of the whole file
+type file struct {
+	path string
+}
+
+func (f file) Hash() (string, error) {
+	return midi.HashFile(f.path)
+}
+
+// MIDI groups the selected notes of a MIDI file by their onset, after running the file through the pipeline
+type MIDI struct {
+	file
+	selector     midi.Selector
+	toleranceSec float64
+	pipeline     midi.Pipeline
+}
+
+func NewMIDI(path string, selector midi.Selector, toleranceSec float64) MIDI {
+	return MIDI{file: file{path}, selector: selector, toleranceSec: toleranceSec}
+}
+
+func (s *MIDI) SetPipeline(pipeline midi.Pipeline) {
+	s.pipeline = pipeline
+}
+
+func (s MIDI) Timestamps() ([]float64, error) {
+	groups, _, err := s.NoteGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	return midi.OnsetTimes(groups), nil
+}
+
+// NoteGroups returns the notes behind the timestamps, along with the tempo map of the file they are in
+func (s MIDI) NoteGroups() ([]midi.NoteGroup, *midi.TempoMap, error) {
+	m, err := midi.New(s.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.pipeline.Apply(&m); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	tempoMap := m.TempoMap()
+	return m.ExtractNoteGroups(s.selector, s.toleranceSec), &tempoMap, nil
+}
+
+// WAVOnsets detects the onsets of a WAV file
+type WAVOnsets struct {
+	file
+	params audio.OnsetParams
+}
+
+func NewWAVOnsets(path string, params audio.OnsetParams) WAVOnsets {
+	return WAVOnsets{file: file{path}, params: params}
+}
+
+func (s WAVOnsets) Timestamps() ([]float64, error) {
+	pcm, err := audio.ReadWAV(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	return audio.DetectOnsets(pcm, s.params), nil
+}
+
+// Sliced keeps the timestamps of another source from startSec up to endSec, moved back so startSec is at 0.
+// It goes with a MIDI file and audio sliced the same way, its hash is the one of the other source.
+type Sliced struct {
+	TimestampSource
+	startSec, endSec float64
+}
+
+func Slice(src TimestampSource, startSec, endSec float64) Sliced {
+	return Sliced{TimestampSource: src, startSec: startSec, endSec: endSec}
+}
+
+func (s Sliced) Timestamps() ([]float64, error) {
+	timestamps, err := s.TimestampSource.Timestamps()
+	if err != nil {
+		return nil, err
+	}
+
+	var sliced []float64
+	for _, timestamp := range timestamps {
+		if timestamp >= s.startSec && timestamp < s.endSec {
+			sliced = append(sliced, timestamp-s.startSec)
+		}
+	}
+
+	return sliced, nil
+}
+
+// noteGrouper is a source that knows the notes behind its timestamps
+type noteGrouper interface {
+	NoteGroups() ([]midi.NoteGroup, *midi.TempoMap, error)
+}
+
+// Thinned drops the onsets of another source that are closer together than minGapSec, see midi.Thin. The notes behind
+// the onsets rank them if the source knows them, otherwise the earlier onset is kept. Its hash is the one of the other
+// source.
+type Thinned struct {
+	TimestampSource
+	minGapSec  float64
+	importance midi.Importance
+
+	removed []midi.ThinnedOnset
+}
+
+func Thin(src TimestampSource, minGapSec float64, importance midi.Importance) *Thinned {
+	return &Thinned{TimestampSource: src, minGapSec: minGapSec, importance: importance}
+}
+
+func (s *Thinned) Timestamps() ([]float64, error) {
+	var (
+		groups   []midi.NoteGroup
+		tempoMap *midi.TempoMap
+	)
+
+	if grouper, ok := s.TimestampSource.(noteGrouper); ok {
+		var err error
+		groups, tempoMap, err = grouper.NoteGroups()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		timestamps, err := s.TimestampSource.Timestamps()
+		if err != nil {
+			return nil, err
+		}
+
+		groups = make([]midi.NoteGroup, len(timestamps))
+		for i, timestamp := range timestamps {
+			groups[i] = midi.NoteGroup{Time: timestamp}
+		}
+	}
+
+	groups, s.removed = midi.Thin(groups, s.minGapSec, s.importance, tempoMap)
+
+	return midi.OnsetTimes(groups), nil
+}
+
+// Removed returns the onsets the last call to Timestamps dropped, with the reason for each
+func (s *Thinned) Removed() []midi.ThinnedOnset {
+	return s.removed
+}
+
+// normalize sorts the timestamps and drops duplicates, negative or non finite timestamps are an error
+func normalize(timestamps []float64) ([]float64, error) {
+	for _, timestamp := range timestamps {
+		if timestamp < 0 || math.IsNaN(timestamp) || math.IsInf(timestamp, 0) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTimestamp, timestamp)
+		}
+	}
+
+	slices.Sort(timestamps)
+	return slices.Compact(timestamps), nil
+}
@@ -0,0 +1,92 @@
+package source
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// errAny stands for any error in a parserTest
+var errAny = errors.New("any error")
+
+// parserTest is a file with the timestamps a source should read from it, or the error it should fail with
+type parserTest struct {
+	name    string
+	content string
+	want    []float64
+	wantErr error
+}
+
+func runParserTests(t *testing.T, fileName string, tests []parserTest, newSource func(path string) TimestampSource) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newSource(writeTempFile(t, fileName, tt.content)).Timestamps()
+
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				if tt.wantErr != errAny && !errors.Is(err, tt.wantErr) {
+					t.Errorf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenFormat(t *testing.T) {
+	tests := []struct {
+		path, format string
+		want         TimestampSource
+	}{
+		{"song.MID", "", MIDI{}},
+		{"song.wav", "", WAVOnsets{}},
+		{"onsets.csv", "", CSV{}},
+		{"onsets.txt", "", Text{}},
+		{"map.osu", "", Osu{}},
+		{"onsets.dat", "text", Text{}},
+	}
+
+	for _, tt := range tests {
+		src, err := Open(tt.path, tt.format, Options{})
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+
+		if reflect.TypeOf(src) != reflect.TypeOf(tt.want) {
+			t.Errorf("%s: got a %T, want a %T", tt.path, src, tt.want)
+		}
+	}
+
+	if _, err := Open("onsets.dat", "", Options{}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("got %v, want ErrUnknownFormat", err)
+	}
+	if _, err := Open("onsets.csv", "", Options{CSVColumn: -1}); !errors.Is(err, ErrInvalidColumn) {
+		t.Errorf("got %v, want ErrInvalidColumn", err)
+	}
+}
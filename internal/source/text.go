@@ -0,0 +1,120 @@
+package source
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CSV reads the timestamps in seconds from a column of a CSV file, a header row is skipped
+type CSV struct {
+	file
+	column int
+}
+
+func NewCSV(path string, column int) CSV {
+	return CSV{file: file{path}, column: column}
+}
+
+func (s CSV) Timestamps() ([]float64, error) {
+	if s.column < 0 {
+		return nil, fmt.Errorf("%s: %w %d", s.path, ErrInvalidColumn, s.column)
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+
+	var timestamps []float64
+
+	for row := 1; ; row++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.path, err)
+		}
+
+		if s.column >= len(record) {
+			return nil, fmt.Errorf("%s: row %d has no column %d", s.path, row, s.column)
+		}
+
+		timestamp, err := strconv.ParseFloat(strings.TrimSpace(record[s.column]), 64)
+		if err != nil {
+			// the first row can be a header
+			if row == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s: row %d: %w: %q", s.path, row, ErrInvalidTimestamp, record[s.column])
+		}
+
+		timestamps = append(timestamps, timestamp)
+	}
+
+	timestamps, err = normalize(timestamps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	return timestamps, nil
+}
+
+// Text reads a plain list of timestamps in seconds, separated by whitespace or commas.
+// Everything after a # on a line is a comment.
+type Text struct {
+	file
+}
+
+func NewText(path string) Text {
+	return Text{file: file{path}}
+}
+
+func (s Text) Timestamps() ([]float64, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var timestamps []float64
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+
+		fields := strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || r == ';' || r == ' ' || r == '\t'
+		})
+
+		for _, field := range fields {
+			timestamp, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: line %d: %w: %q", s.path, line, ErrInvalidTimestamp, field)
+			}
+			timestamps = append(timestamps, timestamp)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	timestamps, err = normalize(timestamps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	return timestamps, nil
+}
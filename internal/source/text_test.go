@@ -0,0 +1,47 @@
+package source
+
+import "testing"
+
+func TestCSV(t *testing.T) {
+	tests := []parserTest{
+		{name: "single column", content: "0.5\n0.25\n1\n", want: []float64{0.25, 0.5, 1}},
+		{name: "header row", content: "time,label\n0.5,a\n1.5,b\n", want: []float64{0.5, 1.5}},
+		{name: "comments and spaces", content: "# onsets\n 2, x\n1 ,y\n", want: []float64{1, 2}},
+		{name: "duplicates", content: "1\n1\n0\n", want: []float64{0, 1}},
+		{name: "empty", content: ""},
+		{name: "malformed row", content: "time\n0.5\nsoon\n", wantErr: ErrInvalidTimestamp},
+		{name: "negative", content: "0.5\n-1\n", wantErr: ErrInvalidTimestamp},
+		{name: "not a number", content: "0\nNaN\n", wantErr: ErrInvalidTimestamp},
+		{name: "unterminated quote", content: "0.5\n\"1\n", wantErr: errAny},
+	}
+
+	runParserTests(t, "onsets.csv", tests, func(path string) TimestampSource { return NewCSV(path, 0) })
+
+	t.Run("second column", func(t *testing.T) {
+		runParserTests(t, "onsets.csv", []parserTest{
+			{name: "values", content: "a,0.75\nb,0.25\n", want: []float64{0.25, 0.75}},
+			{name: "missing column", content: "a,0.75\nb\n", wantErr: errAny},
+		}, func(path string) TimestampSource { return NewCSV(path, 1) })
+	})
+
+	t.Run("negative column", func(t *testing.T) {
+		runParserTests(t, "onsets.csv", []parserTest{
+			{name: "values", content: "a,0.75\nb,0.25\n", wantErr: ErrInvalidColumn},
+		}, func(path string) TimestampSource { return NewCSV(path, -1) })
+	})
+}
+
+func TestText(t *testing.T) {
+	tests := []parserTest{
+		{name: "one per line", content: "0.5\n1\n1.5\n", want: []float64{0.5, 1, 1.5}},
+		{name: "separators", content: "0.5, 1;1.5\t2 2.5\n", want: []float64{0.5, 1, 1.5, 2, 2.5}},
+		{name: "comments", content: "# intro\n1 # first\n\n0.5\n", want: []float64{0.5, 1}},
+		{name: "unsorted with duplicates", content: "3 1 2 1", want: []float64{1, 2, 3}},
+		{name: "empty", content: "# nothing\n"},
+		{name: "malformed field", content: "0.5\n1s\n", wantErr: ErrInvalidTimestamp},
+		{name: "negative", content: "-0.5\n", wantErr: ErrInvalidTimestamp},
+		{name: "infinite", content: "1 +Inf\n", wantErr: ErrInvalidTimestamp},
+	}
+
+	runParserTests(t, "onsets.txt", tests, func(path string) TimestampSource { return NewText(path) })
+}
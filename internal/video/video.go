@@ -0,0 +1,167 @@
+package video
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FrameWriter receives the frames of a video in order
+type FrameWriter interface {
+	WriteFrame(frame *image.RGBA) error
+	Close() error
+}
+
+// PNGSequence writes every frame to its own numbered PNG file in a directory
+type PNGSequence struct {
+	dir      string
+	frameIdx int
+}
+
+func NewPNGSequence(dir string) (*PNGSequence, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &PNGSequence{dir: dir}, nil
+}
+
+func (p *PNGSequence) WriteFrame(frame *image.RGBA) error {
+	path := filepath.Join(p.dir, fmt.Sprintf("frame_%06d.png", p.frameIdx))
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	// the frames are usually encoded again right after, compressing them hard is wasted time
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+
+	err = encoder.Encode(file, frame)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	p.frameIdx++
+
+	return nil
+}
+
+func (p *PNGSequence) Close() error {
+	return nil
+}
+
+// Pipe writes the frames as raw RGBA to the stdin of an encoder process, for example ffmpeg
+type Pipe struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+
+	// set once the process was waited for, after that only the first error is reported again
+	done bool
+	err  error
+}
+
+func NewPipe(name string, args ...string) (*Pipe, error) {
+	p := &Pipe{cmd: exec.Command(name, args...)}
+	p.cmd.Stderr = &p.stderr
+
+	stdin, err := p.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	p.stdin = stdin
+
+	if err := p.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *Pipe) WriteFrame(frame *image.RGBA) error {
+	if p.done {
+		return p.err
+	}
+
+	width := frame.Rect.Dx() * 4
+
+	if frame.Stride == width {
+		if _, err := p.stdin.Write(frame.Pix[:width*frame.Rect.Dy()]); err != nil {
+			return p.wait(err)
+		}
+		return nil
+	}
+
+	for y := range frame.Rect.Dy() {
+		row := frame.Pix[y*frame.Stride : y*frame.Stride+width]
+		if _, err := p.stdin.Write(row); err != nil {
+			return p.wait(err)
+		}
+	}
+
+	return nil
+}
+
+// Close ends the input of the encoder and waits for it to finish writing the video
+func (p *Pipe) Close() error {
+	return p.wait(nil)
+}
+
+// wait stops the encoder and adds its output to the error, the error alone rarely says why it stopped.
+// The encoder exiting early usually is the cause of a write error, so its exit status is preferred.
+func (p *Pipe) wait(err error) error {
+	if p.done {
+		return p.err
+	}
+	p.done = true
+
+	p.stdin.Close()
+	if waitErr := p.cmd.Wait(); waitErr != nil {
+		err = waitErr
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	output := strings.TrimSpace(p.stderr.String())
+	if output == "" {
+		p.err = fmt.Errorf("%s: %w", p.cmd.Path, err)
+		return p.err
+	}
+
+	// the last lines are the ones explaining the failure
+	lines := strings.Split(output, "\n")
+	if len(lines) > 5 {
+		lines = lines[len(lines)-5:]
+	}
+
+	p.err = fmt.Errorf("%s: %w\n%s", p.cmd.Path, err, strings.Join(lines, "\n"))
+	return p.err
+}
+
+// FFmpegArgs returns the ffmpeg arguments to encode the raw frames of a Pipe into outPath
+func FFmpegArgs(width, height, fps int, outPath string) []string {
+	return []string{
+		"-y",
+		"-loglevel", "error",
+		"-f", "rawvideo",
+		"-pix_fmt", "rgba",
+		"-s", fmt.Sprintf("%dx%d", width, height),
+		"-r", strconv.Itoa(fps),
+		"-i", "-",
+		"-pix_fmt", "yuv420p",
+		outPath,
+	}
+}
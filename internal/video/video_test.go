@@ -0,0 +1,189 @@
+package video
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testFrame returns a frame of the given size filled with a color that tells frames apart
+func testFrame(width, height int, shade uint8) *image.RGBA {
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			frame.SetRGBA(x, y, color.RGBA{R: shade, G: uint8(x), B: uint8(y), A: 255})
+		}
+	}
+
+	return frame
+}
+
+func TestPNGSequence(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "frames", "nested")
+	seq, err := NewPNGSequence(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := []*image.RGBA{testFrame(4, 3, 10), testFrame(4, 3, 20), testFrame(4, 3, 30)}
+	for _, frame := range frames {
+		if err := seq.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := seq.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"frame_000000.png", "frame_000001.png", "frame_000002.png"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got files %q, want %q", names, want)
+	}
+
+	for i, frame := range frames {
+		f, err := os.Open(filepath.Join(dir, names[i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", names[i], err)
+		}
+
+		if decoded.Bounds() != frame.Bounds() {
+			t.Fatalf("%s: got bounds %v, want %v", names[i], decoded.Bounds(), frame.Bounds())
+		}
+		for y := range 3 {
+			for x := range 4 {
+				if got, want := color.RGBAModel.Convert(decoded.At(x, y)), frame.At(x, y); got != want {
+					t.Fatalf("%s: pixel %d,%d is %v, want %v", names[i], x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestFFmpegArgs(t *testing.T) {
+	want := []string{
+		"-y",
+		"-loglevel", "error",
+		"-f", "rawvideo",
+		"-pix_fmt", "rgba",
+		"-s", "720x1280",
+		"-r", "60",
+		"-i", "-",
+		"-pix_fmt", "yuv420p",
+		"out.mp4",
+	}
+	if got := FFmpegArgs(720, 1280, 60, "out.mp4"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// the raw frames of a Pipe come before the input, the output options after it
+	args := FFmpegArgs(1920, 1080, 30, "video.mkv")
+	input := slices.Index(args, "-i")
+	for _, pair := range [][2]string{{"-f", "rawvideo"}, {"-pix_fmt", "rgba"}, {"-s", "1920x1080"}, {"-r", "30"}} {
+		if idx := slices.Index(args, pair[0]); idx < 0 || idx > input || args[idx+1] != pair[1] {
+			t.Errorf("got %q, want %s %s before the input", args, pair[0], pair[1])
+		}
+	}
+	if args[len(args)-3] != "-pix_fmt" || args[len(args)-2] != "yuv420p" || args[len(args)-1] != "video.mkv" {
+		t.Errorf("got %q, want yuv420p into video.mkv at the end", args)
+	}
+}
+
+func TestPipe(t *testing.T) {
+	outPath := filepath.Join(t.TempDir(), "frames.raw")
+	p, err := NewPipe("sh", "-c", `cat > "$0"`, outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a sub image has a stride wider than its rows, only the rows are written
+	whole := testFrame(6, 3, 10)
+	frames := []*image.RGBA{testFrame(4, 3, 20), whole.SubImage(image.Rect(1, 1, 5, 3)).(*image.RGBA)}
+
+	var want bytes.Buffer
+	for _, frame := range frames {
+		if err := p.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+		for y := frame.Rect.Min.Y; y < frame.Rect.Max.Y; y++ {
+			for x := frame.Rect.Min.X; x < frame.Rect.Max.X; x++ {
+				c := frame.RGBAAt(x, y)
+				want.Write([]byte{c.R, c.G, c.B, c.A})
+			}
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("got %d bytes, want the %d bytes of the frames", len(got), want.Len())
+	}
+}
+
+func TestPipeFailure(t *testing.T) {
+	// an encoder that gives up right away and explains why on stderr
+	var script strings.Builder
+	for i := 1; i <= 7; i++ {
+		fmt.Fprintf(&script, "echo line %d >&2; ", i)
+	}
+	script.WriteString("exit 3")
+
+	p, err := NewPipe("sh", "-c", script.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the frames fill the pipe until the write fails, or are lost unread
+	frame := testFrame(256, 256, 0)
+	var writeErr error
+	for range 100 {
+		if writeErr = p.WriteFrame(frame); writeErr != nil {
+			break
+		}
+	}
+
+	closeErr := p.Close()
+	if closeErr == nil {
+		t.Fatal("expected an error")
+	}
+	if writeErr != nil && writeErr.Error() != closeErr.Error() {
+		t.Errorf("the write failed with %q, closing with %q", writeErr, closeErr)
+	}
+
+	msg := closeErr.Error()
+	if !strings.Contains(msg, "exit status 3") {
+		t.Errorf("got %q, want the exit status", msg)
+	}
+	// only the last five lines of stderr are kept
+	for i := 1; i <= 7; i++ {
+		line := fmt.Sprintf("line %d", i)
+		if strings.Contains(msg, line) != (i > 2) {
+			t.Errorf("got %q, want the lines 3 to 7 of stderr", msg)
+			break
+		}
+	}
+}